@@ -0,0 +1,746 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+var (
+	errNotDirectory = errors.New("not a directory")
+	errNoBackups    = errors.New("backups are kept for config files only, not for databases")
+)
+
+func (a *app) ls(args []string) error {
+	dir, err := a.dirArg(args)
+	if err != nil {
+		return err
+	}
+
+	entries := a.manager.ListDirectory(dir.ID)
+	if a.json {
+		return a.printJSON(entries)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	for i := range entries {
+		name := a.manager.DisplayEntry(&entries[i])
+		if entries[i].IsDir {
+			name += "/"
+		}
+
+		if entries[i].Link != 0 {
+			name += " -> " + strconv.Itoa(entries[i].Link)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\n", entries[i].ID, name, entries[i].Exec)
+	}
+
+	return w.Flush() //nolint:wrapcheck
+}
+
+func (a *app) tree(args []string) error {
+	dir, err := a.dirArg(args)
+	if err != nil {
+		return err
+	}
+
+	entries := a.subtree(dir.ID)
+	if a.json {
+		return a.printJSON(entries)
+	}
+
+	a.printTree(entries, "")
+
+	return nil
+}
+
+func (a *app) search(args []string) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	limit := flags.Int("n", 20, "") //nolint:gomnd
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) //nolint:errorlint
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: expected QUERY", errUsage)
+	}
+
+	results := a.manager.Search(flags.Arg(0), *limit)
+	if a.json {
+		return a.printJSON(results)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	for i := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", results[i].Entry.ID, results[i].Path, results[i].Entry.Exec)
+	}
+
+	return w.Flush() //nolint:wrapcheck
+}
+
+func (a *app) top(args []string) error {
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	limit := flags.Int("n", 20, "") //nolint:gomnd
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) //nolint:errorlint
+	}
+
+	if flags.NArg() != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	// Commands used in the current directory rank higher.
+	wd, _ := os.Getwd()
+
+	entries := a.manager.MostUseful(*limit, wd)
+	if a.json {
+		return a.printJSON(entries)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	for i := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", entries[i].Entry.ID, entries[i].Path, entries[i].Usage.Count,
+			entries[i].Usage.LastUsed.Format(time.DateTime), entries[i].Entry.Exec)
+	}
+
+	return w.Flush() //nolint:wrapcheck
+}
+
+func (a *app) subtree(id int) []favorites.Entry {
+	entries := a.manager.ListDirectory(id)
+	for i := range entries {
+		if entries[i].IsDir {
+			entries[i].Entries = a.subtree(entries[i].ID)
+		}
+	}
+
+	return entries
+}
+
+func (a *app) printTree(entries []favorites.Entry, indent string) {
+	for i := range entries {
+		if entries[i].IsDir {
+			fmt.Fprintf(a.stdout, "%s%s/ [%d]\n", indent, entries[i].Name, entries[i].ID)
+			a.printTree(entries[i].Entries, indent+"  ")
+
+			continue
+		}
+
+		fmt.Fprintf(a.stdout, "%s%s [%d]\n", indent, a.manager.DisplayEntry(&entries[i]), entries[i].ID)
+	}
+}
+
+func (a *app) add(args []string) error {
+	flags, before := newFlagSet("add")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) //nolint:errorlint
+	}
+
+	if flags.NArg() != 3 { //nolint:gomnd
+		return fmt.Errorf("%w: expected DIR NAME EXEC", errUsage)
+	}
+
+	dir, next, err := a.placement(flags.Arg(0), *before)
+	if err != nil {
+		return err
+	}
+
+	id, err := a.manager.AddCommand(flags.Arg(1), flags.Arg(2), dir.ID, next)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.printID(id)
+}
+
+func (a *app) mkdir(args []string) error {
+	flags, before := newFlagSet("mkdir")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) //nolint:errorlint
+	}
+
+	if flags.NArg() != 2 { //nolint:gomnd
+		return fmt.Errorf("%w: expected DIR NAME", errUsage)
+	}
+
+	dir, next, err := a.placement(flags.Arg(0), *before)
+	if err != nil {
+		return err
+	}
+
+	id, err := a.manager.AddDir(flags.Arg(1), dir.ID, next)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.printID(id)
+}
+
+func (a *app) mksmart(args []string) error {
+	flags, before := newFlagSet("mksmart")
+	query := favorites.SmartQuery{} //nolint:exhaustruct
+	flags.StringVar(&query.Tags, "tags", "", "tag `QUERY` of the listed commands")
+	flags.StringVar(&query.Text, "text", "", "`TEXT` the listed commands fuzzy match")
+	flags.StringVar(&query.UsedWithin, "used", "", "list commands used within the `DURATION`")
+	flags.IntVar(&query.Limit, "n", 0, "list at most `LIMIT` commands")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) //nolint:errorlint
+	}
+
+	if flags.NArg() != 2 { //nolint:gomnd
+		return fmt.Errorf("%w: expected DIR NAME", errUsage)
+	}
+
+	dir, next, err := a.placement(flags.Arg(0), *before)
+	if err != nil {
+		return err
+	}
+
+	id, err := a.manager.AddSmartDir(flags.Arg(1), query, dir.ID, next)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.printID(id)
+}
+
+func (a *app) ln(args []string) error {
+	flags, before := newFlagSet("ln")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) //nolint:errorlint
+	}
+
+	if flags.NArg() != 2 && flags.NArg() != 3 { //nolint:gomnd
+		return fmt.Errorf("%w: expected REF DIR [NAME]", errUsage)
+	}
+
+	target, err := a.resolve(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	dir, next, err := a.placement(flags.Arg(1), *before)
+	if err != nil {
+		return err
+	}
+
+	id, err := a.manager.AddLink(flags.Arg(2), target.ID, dir.ID, next)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.printID(id)
+}
+
+func (a *app) mv(args []string) error {
+	flags, before := newFlagSet("mv")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) //nolint:errorlint
+	}
+
+	if flags.NArg() != 2 { //nolint:gomnd
+		return fmt.Errorf("%w: expected REF DIR", errUsage)
+	}
+
+	target, err := a.resolve(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	dir, next, err := a.placement(flags.Arg(1), *before)
+	if err != nil {
+		return err
+	}
+
+	return a.manager.MoveEntry(target.ID, dir.ID, next) //nolint:wrapcheck
+}
+
+func (a *app) cp(args []string) error {
+	flags, before := newFlagSet("cp")
+	rename := flags.String("rename", "", "rename pattern of the copy if its name is taken, like \"{name} ({n})\"")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) //nolint:errorlint
+	}
+
+	if flags.NArg() != 2 { //nolint:gomnd
+		return fmt.Errorf("%w: expected REF DIR", errUsage)
+	}
+
+	target, err := a.resolve(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	dir, next, err := a.placement(flags.Arg(1), *before)
+	if err != nil {
+		return err
+	}
+
+	var opts []favorites.CopyOption
+	if *rename != "" {
+		opts = append(opts, favorites.CopyWithRename(*rename))
+	}
+
+	id, err := a.manager.CopyEntry(target.ID, dir.ID, next, opts...)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.printID(id)
+}
+
+func (a *app) rm(args []string) error {
+	target, err := a.refArg(args, "REF")
+	if err != nil {
+		return err
+	}
+
+	if target.IsDir {
+		return a.manager.DeleteDir(target.ID) //nolint:wrapcheck
+	}
+
+	return a.manager.DeleteCommand(target.ID) //nolint:wrapcheck
+}
+
+func (a *app) rename(args []string) error {
+	if len(args) != 2 { //nolint:gomnd
+		return fmt.Errorf("%w: expected REF NAME", errUsage)
+	}
+
+	target, err := a.resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	return a.manager.RenameEntry(target.ID, args[1]) //nolint:wrapcheck
+}
+
+func (a *app) editExec(args []string) error {
+	if len(args) != 2 { //nolint:gomnd
+		return fmt.Errorf("%w: expected REF EXEC", errUsage)
+	}
+
+	target, err := a.resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	return a.manager.ModifyExec(target.ID, args[1]) //nolint:wrapcheck
+}
+
+func (a *app) undo(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	return a.manager.Undo() //nolint:wrapcheck
+}
+
+func (a *app) redo(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	return a.manager.Redo() //nolint:wrapcheck
+}
+
+func (a *app) tag(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected REF [TAG]...", errUsage)
+	}
+
+	target, err := a.resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	return a.manager.SetTags(target.ID, args[1:]) //nolint:wrapcheck
+}
+
+func (a *app) tags(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	tags := a.manager.Tags()
+	if a.json {
+		return a.printJSON(tags)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	for _, tag := range tags {
+		fmt.Fprintf(w, "%s\t%d\n", tag.Tag, tag.Count)
+	}
+
+	return w.Flush() //nolint:wrapcheck
+}
+
+func (a *app) tagged(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected QUERY", errUsage)
+	}
+
+	// The query may come as one argument or as several words.
+	entries, err := a.manager.QueryTags(strings.Join(args, " "))
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if a.json {
+		return a.printJSON(entries)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	for i := range entries {
+		name := a.manager.DisplayEntry(&entries[i])
+		if entries[i].IsDir {
+			name += "/"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", entries[i].ID, name, strings.Join(entries[i].Tags, ","), entries[i].Exec)
+	}
+
+	return w.Flush() //nolint:wrapcheck
+}
+
+func (a *app) renameTag(args []string) error {
+	if len(args) != 2 { //nolint:gomnd
+		return fmt.Errorf("%w: expected OLD NEW", errUsage)
+	}
+
+	return a.manager.RenameTag(args[0], args[1]) //nolint:wrapcheck
+}
+
+func (a *app) trash(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	items := a.manager.ListTrash()
+	if a.json {
+		return a.printJSON(items)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	for i := range items {
+		name := a.manager.DisplayEntry(&items[i].Entry)
+		if items[i].Entry.IsDir {
+			name += "/"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\n", items[i].Entry.ID, name, items[i].DeletedAt.Format(time.DateTime))
+	}
+
+	return w.Flush() //nolint:wrapcheck
+}
+
+func (a *app) untrash(args []string) error {
+	id, err := trashIDArg(args)
+	if err != nil {
+		return err
+	}
+
+	return a.manager.Restore(id) //nolint:wrapcheck
+}
+
+func (a *app) purge(args []string) error {
+	id, err := trashIDArg(args)
+	if err != nil {
+		return err
+	}
+
+	return a.manager.Purge(id) //nolint:wrapcheck
+}
+
+// trashIDArg returns the ID of a trashed entry, paths do not resolve to them.
+func trashIDArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%w: expected ID", errUsage)
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not an entry ID", errUsage, args[0])
+	}
+
+	return id, nil
+}
+
+func (a *app) run(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	timeout := flags.Duration("timeout", 0, "")
+	dir := flags.String("dir", "", "")
+	env := keyValues{}
+	params := keyValues{}
+
+	flags.Var(&env, "env", "")
+	flags.Var(&params, "p", "")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err) //nolint:errorlint
+	}
+
+	target, err := a.refArg(flags.Args(), "REF")
+	if err != nil {
+		return err
+	}
+
+	opts := []favorites.RunOption{favorites.RunWithParams(params.values())}
+	if *timeout > 0 {
+		opts = append(opts, favorites.RunWithTimeout(*timeout))
+	}
+
+	if *dir != "" {
+		opts = append(opts, favorites.RunInDir(*dir))
+	}
+
+	if len(env) > 0 {
+		opts = append(opts, favorites.RunWithEnv(env...))
+	}
+
+	result, err := a.manager.Run(context.Background(), target.ID, opts...)
+	if result == nil {
+		return err //nolint:wrapcheck
+	}
+
+	a.exitCode = result.ExitCode
+	if a.exitCode < 0 {
+		a.exitCode = exitCodeFailure
+	}
+
+	if a.json {
+		if jsonErr := a.printJSON(result); jsonErr != nil {
+			return jsonErr
+		}
+	} else {
+		fmt.Fprint(a.stdout, result.Stdout)
+		fmt.Fprint(a.stderr, result.Stderr)
+	}
+
+	return err //nolint:wrapcheck
+}
+
+func (a *app) backups(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("%w: unexpected arguments", errUsage)
+	}
+
+	if isDatabase(a.configPath) {
+		return fmt.Errorf("%s: %w", a.configPath, errNoBackups)
+	}
+
+	backups, err := favorites.ListBackups(a.configPath)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if a.json {
+		return a.printJSON(backups)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	for _, backup := range backups {
+		state := "ok"
+		if !backup.Valid {
+			state = "corrupt"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\n", backup.Index, backup.ModTime.Format(time.DateTime), state)
+	}
+
+	return w.Flush() //nolint:wrapcheck
+}
+
+func (a *app) restore(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: expected N", errUsage)
+	}
+
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("%w: %q is not a backup number", errUsage, args[0])
+	}
+
+	if isDatabase(a.configPath) {
+		return fmt.Errorf("%s: %w", a.configPath, errNoBackups)
+	}
+
+	return favorites.RestoreBackup(a.configPath, index) //nolint:wrapcheck
+}
+
+// convert copies the tree between configs of any formats, an existing DST is replaced keeping a backup.
+func (a *app) convert(args []string) error {
+	if len(args) != 2 { //nolint:gomnd
+		return fmt.Errorf("%w: expected SRC DST", errUsage)
+	}
+
+	if _, err := os.Stat(args[0]); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	src, closeSrc, err := openStore(a.log, args[0], favorites.FormatAuto)
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+
+	doc, err := src.Load()
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	dst, closeDst, err := openStore(a.log, args[1], favorites.FormatAuto)
+	if err != nil {
+		return err
+	}
+	defer closeDst()
+
+	// Saving fails unless the current content has been loaded.
+	if _, err = dst.Load(); err != nil {
+		return fmt.Errorf("%s: %w", args[1], err)
+	}
+
+	return dst.Save(doc) //nolint:wrapcheck
+}
+
+// resolve finds an entry by its ID or by a slash-separated path of names. Root has ID 0.
+func (a *app) resolve(ref string) (favorites.Entry, error) {
+	id, err := strconv.Atoi(ref)
+	if err != nil {
+		if id, err = a.manager.ResolvePath(ref); err != nil {
+			return favorites.Entry{}, err //nolint:exhaustruct,wrapcheck
+		}
+	}
+
+	if id == 0 {
+		return rootEntry(), nil
+	}
+
+	return a.manager.GetEntry(id) //nolint:wrapcheck
+}
+
+func (a *app) resolveDir(ref string) (favorites.Entry, error) {
+	dir, err := a.resolve(ref)
+	if err != nil {
+		return dir, err
+	}
+
+	if !dir.IsDir {
+		return dir, fmt.Errorf("%s: %w", ref, errNotDirectory)
+	}
+
+	return dir, nil
+}
+
+// placement resolves the parent dir and the optional sibling to insert before.
+func (a *app) placement(dirRef, beforeRef string) (favorites.Entry, int, error) {
+	dir, err := a.resolveDir(dirRef)
+	if err != nil {
+		return dir, 0, err
+	}
+
+	if beforeRef == "" {
+		return dir, 0, nil
+	}
+
+	next, err := a.resolve(beforeRef)
+	if err != nil {
+		return dir, 0, err
+	}
+
+	return dir, next.ID, nil
+}
+
+func (a *app) dirArg(args []string) (favorites.Entry, error) {
+	switch len(args) {
+	case 0:
+		return rootEntry(), nil
+	case 1:
+		return a.resolveDir(args[0])
+	default:
+		return favorites.Entry{}, fmt.Errorf("%w: expected at most one DIR", errUsage) //nolint:exhaustruct
+	}
+}
+
+func (a *app) refArg(args []string, name string) (favorites.Entry, error) {
+	if len(args) != 1 {
+		return favorites.Entry{}, fmt.Errorf("%w: expected %s", errUsage, name) //nolint:exhaustruct
+	}
+
+	return a.resolve(args[0])
+}
+
+func (a *app) printID(id int) error {
+	if a.json {
+		return a.printJSON(map[string]int{"id": id})
+	}
+
+	_, err := fmt.Fprintln(a.stdout, id)
+
+	return err //nolint:wrapcheck
+}
+
+func (a *app) printJSON(v any) error {
+	encoder := json.NewEncoder(a.stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v) //nolint:wrapcheck
+}
+
+func rootEntry() favorites.Entry {
+	return favorites.Entry{IsDir: true} //nolint:exhaustruct
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	return flags, flags.String("before", "", "insert before this sibling")
+}
+
+// keyValues collects repeated KEY=VALUE flags.
+type keyValues []string
+
+func (kv *keyValues) String() string {
+	return strings.Join(*kv, ",")
+}
+
+func (kv *keyValues) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("%w: %q is not KEY=VALUE", errUsage, value)
+	}
+
+	*kv = append(*kv, value)
+
+	return nil
+}
+
+func (kv *keyValues) values() map[string]string {
+	result := make(map[string]string, len(*kv))
+
+	for _, pair := range *kv {
+		key, value, _ := strings.Cut(pair, "=")
+		result[key] = value
+	}
+
+	return result
+}
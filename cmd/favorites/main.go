@@ -0,0 +1,255 @@
+// Command favorites manages a favorites library of shell commands from the terminal.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/favorites"
+	"github.com/gerladeno/favorites-mechanics/pkg/sqlitestore"
+)
+
+const (
+	envConfig        = "FAVORITES_CONFIG"
+	envSyncPeriod    = "FAVORITES_SYNC_PERIOD"
+	maxDisplayLen    = 60
+	exitCodeFailure  = 1
+	exitCodeUsage    = 2
+	configDirPerm    = 0o755
+	defaultSyncEvery = time.Minute
+	configBackups    = 3
+)
+
+var errUsage = errors.New("usage")
+
+type app struct {
+	log        *logrus.Logger
+	manager    *favorites.Manager
+	configPath string
+	json       bool
+	stdout     io.Writer
+	stderr     io.Writer
+	exitCode   int
+}
+
+type command struct {
+	run   func(a *app, args []string) error
+	usage string
+	// offline commands work with the config file directly, so they run even if it cannot be loaded.
+	offline bool
+}
+
+var commands = map[string]command{
+	"ls":         {run: (*app).ls, usage: "ls [DIR]"},
+	"tree":       {run: (*app).tree, usage: "tree [DIR]"},
+	"search":     {run: (*app).search, usage: "search [-n LIMIT] QUERY"},
+	"top":        {run: (*app).top, usage: "top [-n LIMIT]"},
+	"add":        {run: (*app).add, usage: "add [-before REF] DIR NAME EXEC"},
+	"mkdir":      {run: (*app).mkdir, usage: "mkdir [-before REF] DIR NAME"},
+	"ln":         {run: (*app).ln, usage: "ln [-before REF] REF DIR [NAME]"},
+	"mv":         {run: (*app).mv, usage: "mv [-before REF] REF DIR"},
+	"cp":         {run: (*app).cp, usage: "cp [-before REF] [-rename PATTERN] REF DIR"},
+	"rm":         {run: (*app).rm, usage: "rm REF"},
+	"rename":     {run: (*app).rename, usage: "rename REF NAME"},
+	"edit-exec":  {run: (*app).editExec, usage: "edit-exec REF EXEC"},
+	"tag":        {run: (*app).tag, usage: "tag REF [TAG]..."},
+	"tags":       {run: (*app).tags, usage: "tags"},
+	"tagged":     {run: (*app).tagged, usage: "tagged QUERY"},
+	"rename-tag": {run: (*app).renameTag, usage: "rename-tag OLD NEW"},
+	"undo":       {run: (*app).undo, usage: "undo"},
+	"redo":       {run: (*app).redo, usage: "redo"},
+	"trash":      {run: (*app).trash, usage: "trash"},
+	"untrash":    {run: (*app).untrash, usage: "untrash ID"},
+	"purge":      {run: (*app).purge, usage: "purge ID"},
+	"mksmart": {
+		run:   (*app).mksmart,
+		usage: "mksmart [-before REF] [-tags QUERY] [-text TEXT] [-used DURATION] [-n LIMIT] DIR NAME",
+	},
+	"run": {
+		run:   (*app).run,
+		usage: "run [-timeout D] [-dir DIR] [-env KEY=VALUE]... [-p NAME=VALUE]... REF",
+	},
+	"backups": {run: (*app).backups, usage: "backups", offline: true},
+	"restore": {run: (*app).restore, usage: "restore N", offline: true},
+	"convert": {run: (*app).convert, usage: "convert SRC DST", offline: true},
+}
+
+func main() {
+	os.Exit(runMain(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func runMain(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("favorites", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { printUsage(flags) }
+
+	configPath := flags.String("config", envOr(envConfig, defaultConfigPath()),
+		"path to the config file, an SQLite database if it ends with .db, .sqlite or .sqlite3, env "+envConfig)
+	syncPeriod := flags.Duration("sync-period", defaultSyncEvery,
+		"period of re-reading the config file, env "+envSyncPeriod)
+	asJSON := flags.Bool("json", false, "print results as JSON")
+	format := flags.String("format", favorites.FormatAuto.String(),
+		"format of the config file: auto by the extension, yaml, json or toml")
+	cascadeLinks := flags.Bool("cascade-links", false,
+		"delete links with the command they point at, instead of keeping them dangling")
+
+	if value, ok := os.LookupEnv(envSyncPeriod); ok {
+		if err := flags.Set("sync-period", value); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", envSyncPeriod, err)
+
+			return exitCodeUsage
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return exitCodeUsage
+	}
+
+	configFormat, err := favorites.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+
+		return exitCodeUsage
+	}
+
+	if flags.NArg() == 0 {
+		printUsage(flags)
+
+		return exitCodeUsage
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", flags.Arg(0))
+		printUsage(flags)
+
+		return exitCodeUsage
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*configPath), configDirPerm); err != nil {
+		fmt.Fprintln(stderr, err)
+
+		return exitCodeFailure
+	}
+
+	log := logrus.New()
+	log.SetOutput(stderr)
+	log.SetLevel(logrus.WarnLevel)
+
+	a := &app{
+		log: log, manager: nil, configPath: *configPath, json: *asJSON,
+		stdout: stdout, stderr: stderr, exitCode: 0,
+	}
+
+	if !cmd.offline {
+		store, closeStore, err := openStore(log, *configPath, configFormat)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+
+			return exitCodeFailure
+		}
+
+		defer closeStore()
+
+		linkPolicy := favorites.LinkKeep
+		if *cascadeLinks {
+			linkPolicy = favorites.LinkCascade
+		}
+
+		// A single command does not live long enough to benefit from watching the config.
+		manager, err := favorites.NewManager(context.Background(), log,
+			favorites.NewOptions(false, *configPath, *syncPeriod, maxDisplayLen, favorites.WithStore(store),
+				favorites.WithDisableWatch(true), favorites.WithLinkPolicy(linkPolicy)))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+
+			return exitCodeFailure
+		}
+
+		defer manager.Close()
+
+		a.manager = manager
+	}
+
+	if err := cmd.run(a, flags.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, "%v\nusage: favorites %s\n", err, cmd.usage)
+
+			return exitCodeUsage
+		}
+
+		fmt.Fprintln(stderr, err)
+
+		return exitCodeFailure
+	}
+
+	return a.exitCode
+}
+
+func printUsage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintln(out, "usage: favorites [flags] COMMAND [args]")
+	fmt.Fprintln(out, "\nREF is an entry ID or a slash-separated path like /ops/db/backup, DIR is a REF of a directory.")
+	fmt.Fprintln(out, `A slash or a backslash in a name is escaped with a backslash: /ops/tcp\/udp.`)
+	fmt.Fprintln(out, "\ncommands:")
+
+	for _, name := range []string{
+		"ls", "tree", "search", "top", "add", "mkdir", "mksmart", "ln", "mv", "cp", "rm", "rename", "edit-exec",
+		"tag", "tags", "tagged", "rename-tag", "undo", "redo", "trash", "untrash", "purge", "run",
+		"backups", "restore", "convert",
+	} {
+		fmt.Fprintln(out, "  "+commands[name].usage)
+	}
+
+	fmt.Fprintln(out, "\nflags:")
+	flags.PrintDefaults()
+}
+
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// openStore opens the config, an SQLite database or a file in the format.
+func openStore(log *logrus.Logger, path string, format favorites.Format) (favorites.Store, func(), error) {
+	if !isDatabase(path) {
+		return favorites.NewFileStore(log, path, configBackups, format), func() {}, nil
+	}
+
+	store, err := sqlitestore.New(path)
+	if err != nil {
+		return nil, nil, err //nolint:wrapcheck
+	}
+
+	return store, func() { _ = store.Close() }, nil
+}
+
+// isDatabase reports whether the config is an SQLite database rather than a file.
+func isDatabase(configPath string) bool {
+	switch filepath.Ext(configPath) {
+	case ".db", ".sqlite", ".sqlite3":
+		return true
+	default:
+		return false
+	}
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+
+	return filepath.Join(dir, "favorites", "favorites.yaml")
+}
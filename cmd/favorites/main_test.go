@@ -0,0 +1,174 @@
+//nolint:paralleltest,funlen,exhaustruct
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// cli runs the commands against a config of its own.
+type cli struct {
+	t          *testing.T
+	configPath string
+}
+
+func newCLI(t *testing.T, name string) *cli {
+	t.Helper()
+	t.Setenv(envConfig, "")
+	t.Setenv(envSyncPeriod, defaultSyncEvery.String())
+
+	return &cli{t: t, configPath: filepath.Join(t.TempDir(), name)}
+}
+
+// run runs the command and returns its exit code, stdout and stderr.
+func (c *cli) run(args ...string) (int, string, string) {
+	c.t.Helper()
+
+	var stdout, stderr bytes.Buffer
+
+	code := runMain(append([]string{"-config", c.configPath}, args...), &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+// mustRun runs the command and fails unless it succeeds.
+func (c *cli) mustRun(args ...string) string {
+	c.t.Helper()
+
+	code, stdout, stderr := c.run(args...)
+	require.Equal(c.t, 0, code, "%v: %s", args, stderr)
+
+	return stdout
+}
+
+func TestCommands(t *testing.T) {
+	// setup creates /ops with /ops/deploy and a /fail command.
+	setup := [][]string{
+		{"mkdir", "/", "ops"},
+		{"add", "/ops", "deploy", "echo deploy {{env}}"},
+		{"add", "/", "fail", "echo oops >&2; exit 3"},
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{name: "ls root", args: []string{"ls"}, stdout: "1  ops/  \n3  fail  echo oops >&2; exit 3\n"},
+		{name: "ls dir by path", args: []string{"ls", "/ops"}, stdout: "2  deploy  echo deploy {{env}}\n"},
+		{name: "ls dir by ID", args: []string{"ls", "1"}, stdout: "2  deploy  echo deploy {{env}}\n"},
+		{name: "ls json", args: []string{"-json", "ls", "/ops"}, stdout: `"exec": "echo deploy {{env}}"`},
+		{name: "ls command", args: []string{"ls", "/fail"}, code: exitCodeFailure, stderr: "/fail: not a directory"},
+		{name: "ls missing", args: []string{"ls", "/nope"}, code: exitCodeFailure, stderr: "not found"},
+		{name: "ls extra arguments", args: []string{"ls", "/", "/"}, code: exitCodeUsage, stderr: "usage: favorites ls"},
+		{name: "tree", args: []string{"tree"}, stdout: "ops/ [1]\n  deploy [2]\nfail [3]\n"},
+		{name: "search", args: []string{"search", "dep"}, stdout: "2  /ops/deploy"},
+		{name: "search without query", args: []string{"search"}, code: exitCodeUsage, stderr: "expected QUERY"},
+		{name: "add", args: []string{"add", "-before", "/ops/deploy", "/ops", "build", "make"}, stdout: "4\n"},
+		{name: "add json", args: []string{"-json", "add", "/", "x", "true"}, stdout: "{\n  \"id\": 4\n}\n"},
+		{
+			name: "add to command", args: []string{"add", "/fail", "x", "true"},
+			code: exitCodeFailure, stderr: "not a directory",
+		},
+		{name: "add without exec", args: []string{"add", "/", "x"}, code: exitCodeUsage, stderr: "expected DIR NAME EXEC"},
+		{
+			name: "add unknown flag", args: []string{"add", "-x", "/", "x", "y"},
+			code: exitCodeUsage, stderr: "usage: favorites add",
+		},
+		{name: "mkdir", args: []string{"mkdir", "/ops", "db"}, stdout: "4\n"},
+		{name: "mv", args: []string{"mv", "/fail", "/ops"}},
+		{name: "mv into itself", args: []string{"mv", "/ops", "/ops"}, code: exitCodeFailure, stderr: "into itself"},
+		{name: "cp", args: []string{"cp", "-rename", "{name} ({n})", "/ops", "/"}, stdout: "4\n"},
+		{name: "ln", args: []string{"ln", "/ops/deploy", "/", "ship"}, stdout: "4\n"},
+		{name: "ln to dir", args: []string{"ln", "/ops", "/"}, code: exitCodeFailure, stderr: "not a command"},
+		{name: "rm", args: []string{"rm", "/ops"}},
+		{name: "rm root", args: []string{"rm", "/"}, code: exitCodeFailure},
+		{name: "rename", args: []string{"rename", "/fail", "ok"}},
+		{name: "rename without name", args: []string{"rename", "/fail"}, code: exitCodeUsage, stderr: "expected REF NAME"},
+		{name: "edit-exec", args: []string{"edit-exec", "3", "true"}},
+		{name: "tag", args: []string{"tag", "/ops/deploy", "prod", "db"}},
+		{name: "tag invalid", args: []string{"tag", "/ops/deploy", "a b"}, code: exitCodeFailure, stderr: "invalid tag"},
+		{name: "tagged invalid", args: []string{"tagged", "a", "and"}, code: exitCodeFailure, stderr: "invalid"},
+		{name: "tagged without query", args: []string{"tagged"}, code: exitCodeUsage, stderr: "expected QUERY"},
+		{name: "rename-tag missing", args: []string{"rename-tag", "x", "y"}, code: exitCodeFailure, stderr: "not found"},
+		{name: "redo nothing", args: []string{"redo"}, code: exitCodeFailure, stderr: "nothing to redo"},
+		{name: "untrash not an ID", args: []string{"untrash", "/ops"}, code: exitCodeUsage, stderr: "not an entry ID"},
+		{name: "purge missing", args: []string{"purge", "1"}, code: exitCodeFailure, stderr: "not found"},
+		{name: "run", args: []string{"run", "-p", "env=prod", "/ops/deploy"}, stdout: "deploy prod\n"},
+		{name: "run exit code", args: []string{"run", "/fail"}, code: 3, stderr: "oops\n"},
+		{name: "run missing param", args: []string{"run", "/ops/deploy"}, code: exitCodeFailure, stderr: "env"},
+		{name: "run bad param", args: []string{"run", "-p", "env", "/ops/deploy"}, code: exitCodeUsage},
+		{name: "run dir", args: []string{"run", "/ops"}, code: exitCodeFailure},
+		{name: "mksmart", args: []string{"mksmart", "-tags", "prod", "/", "prod"}, stdout: "4\n"},
+		{name: "mksmart bad query", args: []string{"mksmart", "-tags", "(", "/", "x"}, code: exitCodeFailure},
+		{name: "restore not a number", args: []string{"restore", "x"}, code: exitCodeUsage, stderr: "not a backup number"},
+		{name: "restore missing", args: []string{"restore", "9"}, code: exitCodeFailure, stderr: "not found"},
+		{name: "no command", args: nil, code: exitCodeUsage, stderr: "usage: favorites [flags] COMMAND"},
+		{name: "unknown command", args: []string{"nope"}, code: exitCodeUsage, stderr: `unknown command "nope"`},
+		{name: "unknown format", args: []string{"-format", "xml", "ls"}, code: exitCodeUsage, stderr: "xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCLI(t, "favorites.yaml")
+			for _, args := range setup {
+				c.mustRun(args...)
+			}
+
+			code, stdout, stderr := c.run(tt.args...)
+			require.Equal(t, tt.code, code, stderr)
+			require.Contains(t, stderr, tt.stderr)
+
+			if tt.code == 0 {
+				require.Contains(t, stdout, tt.stdout)
+			}
+		})
+	}
+}
+
+func TestBackups(t *testing.T) {
+	t.Run("file configs are restored", func(t *testing.T) {
+		c := newCLI(t, "favorites.yaml")
+		c.mustRun("add", "/", "x", "true")
+		c.mustRun("add", "/", "y", "true")
+
+		require.Regexp(t, `^1 .* ok\n`, c.mustRun("backups"))
+
+		c.mustRun("restore", "1")
+		require.Equal(t, "1  x  true\n", c.mustRun("ls"))
+	})
+
+	t.Run("databases have no backups", func(t *testing.T) {
+		c := newCLI(t, "favorites.db")
+		c.mustRun("add", "/", "x", "true")
+
+		for _, args := range [][]string{{"backups"}, {"restore", "1"}} {
+			code, stdout, stderr := c.run(args...)
+			require.Equal(t, exitCodeFailure, code, args)
+			require.Empty(t, stdout)
+			require.Contains(t, stderr, "config files only")
+		}
+	})
+
+	t.Run("configs are converted", func(t *testing.T) {
+		c := newCLI(t, "favorites.yaml")
+		c.mustRun("add", "/", "x", "true")
+
+		for _, name := range []string{"favorites.json", "favorites.db"} {
+			dst := filepath.Join(filepath.Dir(c.configPath), name)
+			c.mustRun("convert", c.configPath, dst)
+
+			converted := &cli{t: t, configPath: dst}
+			require.Equal(t, "1  x  true\n", converted.mustRun("ls"))
+		}
+
+		code, _, stderr := c.run("convert", "missing.yaml", c.configPath)
+		require.Equal(t, exitCodeFailure, code)
+		require.Contains(t, stderr, "missing.yaml")
+	})
+}
@@ -1,38 +1,80 @@
 package favorites
 
-func (m *Manager) AddCommand(name, exec string, parentID int, nextID int) {
+import "fmt"
+
+// AddCommand adds a command to the parentID dir before the nextID entry, or to the end if nextID is 0.
+// Either name or exec must be non-empty. Returns ID of the new command.
+func (m *Manager) AddCommand(name, exec string, parentID int, nextID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addCommand(name, exec, parentID, nextID)
+}
+
+func (m *Manager) addCommand(name, exec string, parentID int, nextID int) (int, error) {
 	if name == "" && exec == "" {
-		return
+		return 0, fmt.Errorf("command without name and exec: %w", ErrInvalidName)
+	}
+
+	dir, next, err := m.getPlacement(parentID, nextID)
+	if err != nil {
+		return 0, err
 	}
 
 	defer m.notifySinker()
 
-	dir := m.getDirByID(parentID)
-	next := m.getEntryByID(nextID)
 	node := dir.AddElement(m.newEntry(name, exec, false, parentID), nil, next)
 	m.registerEntry(node)
+	m.recordPut(node)
+	m.record(OpAddCommand, HistoryChange{After: m.state(node, false)}) //nolint:exhaustruct
+
+	return node.Value.ID, nil
 }
 
-func (m *Manager) DeleteCommand(id int) {
-	node := m.getEntryByID(id)
-	if node == nil {
-		return
+func (m *Manager) DeleteCommand(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteCommand(id)
+}
+
+func (m *Manager) deleteCommand(id int) error {
+	node, err := m.getCommand(id)
+	if err != nil {
+		return err
 	}
 
 	defer m.notifySinker()
 
-	dir := m.getDirByID(node.Value.ParentID)
-	dir.DeleteElement(node)
-	m.unregisterEntry(node.Value.ID)
+	m.trashWithLinks(OpDeleteCommand, node)
+
+	return nil
+}
+
+// ModifyExec replaces the exec of the command, of the target if it is a link.
+func (m *Manager) ModifyExec(id int, exec string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.modifyExec(id, exec)
 }
 
-func (m *Manager) ModifyExec(id int, exec string) {
-	node := m.getEntryByID(id)
-	if node == nil {
-		return
+func (m *Manager) modifyExec(id int, exec string) error {
+	node, err := m.getLinkedCommand(id)
+	if err != nil {
+		return err
+	}
+
+	if node.Value.Name == "" && exec == "" {
+		return fmt.Errorf("entry %d: command without name and exec: %w", node.Value.ID, ErrInvalidName)
 	}
 
 	defer m.notifySinker()
 
+	before := m.state(node, false)
 	node.Value.Exec = exec
+	m.recordPut(node)
+	m.record(OpModifyExec, HistoryChange{Before: before, After: m.state(node, false)}) //nolint:exhaustruct
+
+	return nil
 }
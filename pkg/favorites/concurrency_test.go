@@ -0,0 +1,165 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+const (
+	stressWorkers = 8
+	stressOps     = 300
+)
+
+// snapshot is the tree without timestamps, which lose precision in the config file.
+func snapshot(manager *favorites2.Manager, id int) []string {
+	var result []string
+
+	for _, e := range manager.ListDirectory(id) {
+		result = append(result, fmt.Sprintf("%d %d %s %s %v", e.ID, e.ParentID, e.Name, e.Exec, e.IsDir))
+		if e.IsDir {
+			result = append(result, snapshot(manager, e.ID)...)
+		}
+	}
+
+	return result
+}
+
+func stress(manager *favorites2.Manager, rnd *rand.Rand, maxID *int) {
+	id := func() int { return rnd.Intn(*maxID + 2) }
+	name := func() string { return fmt.Sprintf("e%d", rnd.Intn(20)) }
+
+	switch rnd.Intn(20) {
+	case 0, 1:
+		if newID, err := manager.AddDir(name(), id(), 0); err == nil && newID > *maxID {
+			*maxID = newID
+		}
+	case 2, 3, 4:
+		if newID, err := manager.AddCommand(name(), "echo {{x:1}}", id(), id()); err == nil && newID > *maxID {
+			*maxID = newID
+		}
+	case 5, 6:
+		_ = manager.MoveEntry(id(), id(), id())
+	case 7:
+		_ = manager.RenameEntry(id(), name())
+	case 8:
+		_ = manager.ModifyExec(id(), name())
+	case 9:
+		_ = manager.SetParams(id(), []favorites2.Param{{Name: "x", Type: favorites2.ParamInt, Default: "2"}})
+	case 10:
+		_ = manager.DeleteCommand(id())
+	case 11:
+		_ = manager.DeleteDir(id())
+	case 12:
+		_, _ = manager.AddCommandByPath(name(), "true", "/"+name(), "")
+	case 13:
+		_ = manager.MoveEntryByPath("/"+name(), "/"+name(), "")
+	case 14:
+		_, _ = manager.ListDirectoryByPath("/" + name())
+	case 15:
+		if p, err := manager.EntryPath(id()); err == nil {
+			_, _ = manager.ResolvePath(p)
+		}
+	case 16:
+		_, _ = manager.GetEntry(id())
+		_, _ = manager.Render(id(), nil)
+	case 17:
+		manager.CheckIntegrity()
+	case 18:
+		manager.SyncOut()
+	default:
+		manager.ListDirectory(id())
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	t.Run("unique ids", func(t *testing.T) {
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+		require.NoError(t, err)
+
+		dirID, err := manager.AddDir("shared", 0, 0)
+		require.NoError(t, err)
+
+		ids := make([][]int, stressWorkers)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < stressWorkers; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				for j := 0; j < stressOps; j++ {
+					id, err := manager.AddCommand(fmt.Sprintf("%d-%d", i, j), "true", dirID, 0)
+					if err != nil {
+						panic(err)
+					}
+
+					ids[i] = append(ids[i], id)
+				}
+			}(i)
+		}
+
+		wg.Wait()
+
+		seen := make(map[int]bool)
+
+		for _, worker := range ids {
+			for _, id := range worker {
+				require.False(t, seen[id], "duplicate ID %d", id)
+				seen[id] = true
+			}
+		}
+
+		require.Len(t, manager.ListDirectory(dirID), stressWorkers*stressOps)
+		require.Empty(t, manager.CheckIntegrity())
+	})
+
+	t.Run("mixed operations with syncer", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Millisecond, 40))
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < stressWorkers; i++ {
+			wg.Add(1)
+
+			go func(seed int64) {
+				defer wg.Done()
+
+				rnd := rand.New(rand.NewSource(seed)) //nolint:gosec
+				maxID := 0
+
+				for j := 0; j < stressOps; j++ {
+					stress(manager, rnd, &maxID)
+				}
+			}(int64(i))
+		}
+
+		wg.Wait()
+		manager.Close()
+
+		require.Empty(t, manager.CheckIntegrity())
+
+		reloaded, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40))
+		require.NoError(t, err)
+		reloaded.Close()
+
+		require.Equal(t, snapshot(manager, 0), snapshot(reloaded, 0))
+	})
+}
@@ -0,0 +1,127 @@
+package favorites
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/list"
+)
+
+// CopyOption configures a single CopyEntry call.
+type CopyOption func(cfg *copyConfig)
+
+type copyConfig struct {
+	renamePattern string
+}
+
+// CopyWithRename renames the copy if its name is taken in the target dir. The pattern is
+// rendered with {name} replaced with the name and {n} with 2, 3 and so on until the name is free,
+// like "{name} ({n})". A pattern without {n}, like "{name} copy", is applied again and again,
+// so it must have {name} and something else. Copies of unnamed commands are not renamed.
+func CopyWithRename(pattern string) CopyOption {
+	return func(cfg *copyConfig) {
+		cfg.renamePattern = pattern
+	}
+}
+
+// CopyEntry copies the entry, with its subtree if it is a dir, to the parentID dir before the
+// nextID entry, or to the end if nextID is 0. The copies get new IDs and timestamps and keep
+// the order of the entries. A link in a copied dir to a command copied with it points at the
+// copy. Usage is not copied. Returns ID of the copy.
+func (m *Manager) CopyEntry(id, parentID, nextID int, opts ...CopyOption) (int, error) {
+	cfg := copyConfig{renamePattern: ""}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.copyEntry(id, parentID, nextID, cfg)
+}
+
+func (m *Manager) copyEntry(id, parentID, nextID int, cfg copyConfig) (int, error) {
+	node := m.getEntryByID(id)
+	if node == nil {
+		return 0, fmt.Errorf("entry %d: %w", id, ErrNotFound)
+	}
+
+	dir, next, err := m.getPlacement(parentID, nextID)
+	if err != nil {
+		return 0, err
+	}
+
+	if cfg.renamePattern != "" && !validRenamePattern(cfg.renamePattern) {
+		return 0, fmt.Errorf("rename pattern %q: %w", cfg.renamePattern, ErrInvalidName)
+	}
+
+	name := node.Value.Name
+	if cfg.renamePattern != "" && name != "" {
+		name = freeName(dir, name, cfg.renamePattern)
+	}
+
+	defer m.notifySinker()
+
+	// The subtree is taken before anything is added, so a dir can be copied into itself.
+	source := m.entry2ExternalEntry(node.Value, true)
+	source.Name = name
+	copies := make(map[int]*list.Node[entry])
+
+	root := dir.AddElement(m.copyTree(source, parentID, copies), nil, next)
+	m.registerEntry(root)
+	copies[source.ID] = root
+
+	for _, copied := range copies {
+		if target, ok := copies[copied.Value.Link]; ok {
+			copied.Value.Link = target.Value.ID
+		}
+	}
+
+	m.recordPutTree(root)
+	m.record(OpCopy, HistoryChange{After: m.state(root, true)}) //nolint:exhaustruct
+
+	return root.Value.ID, nil
+}
+
+// copyTree returns a copy of the entry with new IDs, registering the entries of its subtree.
+// copies are the nodes of the copies by the IDs of the originals.
+func (m *Manager) copyTree(source Entry, parentID int, copies map[int]*list.Node[entry]) entry {
+	e := m.newEntry(source.Name, source.Exec, source.IsDir, parentID)
+	e.Params, e.Tags, e.Link = cloneParams(source.Params), append([]string(nil), source.Tags...), source.Link
+	e.Smart = source.Smart.clone()
+
+	for _, child := range source.Entries {
+		node := e.Entries.AddElement(m.copyTree(child, e.ID, copies), nil, nil)
+		m.registerEntry(node)
+		copies[child.ID] = node
+	}
+
+	return e
+}
+
+// validRenamePattern reports whether rendering the pattern again and again gives new names.
+func validRenamePattern(pattern string) bool {
+	return strings.Contains(pattern, "{n}") || strings.Contains(pattern, "{name}") && pattern != "{name}"
+}
+
+// freeName renders the pattern, see CopyWithRename, until the name is not taken in the dir.
+func freeName(dir *list.DeLinkedList[entry], name, pattern string) string {
+	taken := make(map[string]bool, dir.Len())
+	for elem := dir.Head; elem != nil; elem = elem.Next {
+		taken[elem.Value.Name] = true
+	}
+
+	candidate := name
+
+	for n := 2; taken[candidate]; n++ {
+		base := name
+		if !strings.Contains(pattern, "{n}") {
+			base = candidate
+		}
+
+		candidate = strings.NewReplacer("{name}", base, "{n}", strconv.Itoa(n)).Replace(pattern)
+	}
+
+	return candidate
+}
@@ -0,0 +1,163 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestCopyEntry(t *testing.T) {
+	newManager := func(t *testing.T) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	// newTree creates /psql and /ops with backup, db/migrate, a link to backup and a link to psql.
+	newTree := func(t *testing.T, manager *favorites2.Manager) map[string]int {
+		t.Helper()
+
+		psql, err := manager.AddCommand("psql", "psql", 0, 0)
+		require.NoError(t, err)
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		backup, err := manager.AddCommand("backup", "pg_dump {{db}}", ops, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.SetTags(backup, []string{"prod"}))
+		require.NoError(t, manager.SetParams(backup, []favorites2.Param{{Name: "db", Default: "main", Choices: []string{"main"}}})) //nolint:exhaustruct
+		db, err := manager.AddDir("db", ops, 0)
+		require.NoError(t, err)
+		migrate, err := manager.AddCommand("migrate", "goose up", db, 0)
+		require.NoError(t, err)
+		again, err := manager.AddLink("again", backup, ops, 0)
+		require.NoError(t, err)
+		shell, err := manager.AddLink("shell", psql, ops, 0)
+		require.NoError(t, err)
+
+		return map[string]int{
+			"psql": psql, "ops": ops, "backup": backup, "db": db, "migrate": migrate, "again": again, "shell": shell,
+		}
+	}
+
+	t.Run("subtrees are copied with new IDs", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager)
+
+		copied, err := manager.CopyEntry(ids["ops"], 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"psql", "ops", "ops"}, names(manager.ListDirectory(0)))
+
+		original, copies := exportTree(manager, ids["ops"]), exportTree(manager, copied)
+		require.Equal(t, names(original), names(copies))
+		require.Equal(t, names(original[1].Entries), names(copies[1].Entries))
+
+		for i := range copies {
+			require.NotEqual(t, original[i].ID, copies[i].ID)
+			require.Equal(t, copied, copies[i].ParentID)
+			require.True(t, copies[i].CreatedAt.After(original[i].CreatedAt))
+
+			e, err := manager.GetEntry(copies[i].ID)
+			require.NoError(t, err)
+			require.Equal(t, copies[i].Name, e.Name)
+		}
+
+		require.Equal(t, original[0].Tags, copies[0].Tags)
+		require.Equal(t, original[0].Params, copies[0].Params)
+
+		// The copy shares no slices with the original, changing them in place leaves it as is.
+		copies[0].Tags[0], copies[0].Params[0].Choices[0] = "changed", "changed"
+		original = exportTree(manager, ids["ops"])
+		require.Equal(t, []string{"prod"}, original[0].Tags)
+		require.Equal(t, []favorites2.Param{{Name: "db", Default: "main", Choices: []string{"main"}}}, original[0].Params)
+		require.Equal(t, []string{"backup", "backup"}, names(manager.ListByTag("prod")))
+
+		// The link to a copied command points at the copy, the link to psql still at psql.
+		require.Equal(t, copies[0].ID, copies[2].Link)
+		require.Equal(t, ids["psql"], copies[3].Link)
+		require.Equal(t, "pg_dump {{db}}", copies[2].Exec)
+
+		require.Empty(t, manager.CheckIntegrity())
+	})
+
+	t.Run("copies are placed and renamed", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager)
+
+		copied, err := manager.CopyEntry(ids["backup"], ids["ops"], ids["db"])
+		require.NoError(t, err)
+		require.Equal(t, []string{"backup", "backup", "db", "again", "shell"}, names(manager.ListDirectory(ids["ops"])))
+
+		_, err = manager.CopyEntry(ids["backup"], ids["ops"], 0, favorites2.CopyWithRename("{name} ({n})"))
+		require.NoError(t, err)
+		_, err = manager.CopyEntry(ids["backup"], ids["ops"], 0, favorites2.CopyWithRename("{name} ({n})"))
+		require.NoError(t, err)
+		_, err = manager.CopyEntry(copied, ids["ops"], 0, favorites2.CopyWithRename("{name} copy"))
+		require.NoError(t, err)
+		_, err = manager.CopyEntry(copied, ids["ops"], 0, favorites2.CopyWithRename("{name} copy"))
+		require.NoError(t, err)
+		_, err = manager.CopyEntry(ids["migrate"], ids["ops"], 0, favorites2.CopyWithRename("{name} copy"))
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"backup", "backup", "db", "again", "shell", "backup (2)", "backup (3)", "backup copy", "backup copy copy",
+			"migrate",
+		}, names(manager.ListDirectory(ids["ops"])))
+
+		for _, pattern := range []string{"{name}", "copy"} {
+			_, err = manager.CopyEntry(ids["backup"], 0, 0, favorites2.CopyWithRename(pattern))
+			require.ErrorIs(t, err, favorites2.ErrInvalidName, pattern)
+		}
+
+		_, err = manager.CopyEntry(100, 0, 0)
+		require.ErrorIs(t, err, favorites2.ErrNotFound)
+		_, err = manager.CopyEntry(ids["backup"], ids["psql"], 0)
+		require.ErrorIs(t, err, favorites2.ErrNotADirectory)
+	})
+
+	t.Run("dirs are copied into themselves", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager)
+
+		copied, err := manager.CopyEntry(ids["db"], ids["db"], 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"migrate", "db"}, names(manager.ListDirectory(ids["db"])))
+		require.Equal(t, []string{"migrate"}, names(manager.ListDirectory(copied)))
+		require.Empty(t, manager.CheckIntegrity())
+	})
+
+	t.Run("copies are undone and sent as events", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager)
+
+		s := manager.Subscribe()
+		defer s.Close()
+
+		copied, err := manager.CopyEntry(ids["ops"], 0, ids["psql"])
+		require.NoError(t, err)
+
+		e := <-s.C
+		require.Equal(t, favorites2.EventAdded, e.Kind)
+		require.Equal(t, copied, e.ID)
+		require.Len(t, e.After.Entries, 4)
+		require.Empty(t, s.C)
+		require.Equal(t, favorites2.OpCopy, manager.History().Undo[len(manager.History().Undo)-1].Op)
+
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []string{"psql", "ops"}, names(manager.ListDirectory(0)))
+		require.Equal(t, []string{"backup"}, names(manager.ListByTag("prod")))
+
+		require.NoError(t, manager.Redo())
+		require.Equal(t, []string{"ops", "psql", "ops"}, names(manager.ListDirectory(0)))
+		require.Equal(t, []string{"backup", "db", "again", "shell"}, names(manager.ListDirectory(copied)))
+		require.Empty(t, manager.CheckIntegrity())
+	})
+}
@@ -1,35 +1,78 @@
 package favorites
 
-func (m *Manager) AddDir(name string, parentID int, nextID int) {
+import (
+	"fmt"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/list"
+)
+
+// AddDir adds a dir to the parentID dir before the nextID entry, or to the end if nextID is 0.
+// Returns ID of the new dir.
+func (m *Manager) AddDir(name string, parentID int, nextID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addDir(name, parentID, nextID)
+}
+
+func (m *Manager) addDir(name string, parentID int, nextID int) (int, error) {
 	if name == "" {
-		return
+		return 0, fmt.Errorf("dir without name: %w", ErrInvalidName)
+	}
+
+	dir, next, err := m.getPlacement(parentID, nextID)
+	if err != nil {
+		return 0, err
 	}
 
 	defer m.notifySinker()
 
-	dir := m.getDirByID(parentID)
-	next := m.getEntryByID(nextID)
 	node := dir.AddElement(m.newEntry(name, "", true, parentID), nil, next)
 	m.registerEntry(node)
+	m.recordPut(node)
+	m.record(OpAddDir, HistoryChange{After: m.state(node, false)}) //nolint:exhaustruct
+
+	return node.Value.ID, nil
 }
 
-func (m *Manager) DeleteDir(id int) {
+func (m *Manager) DeleteDir(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteDirByID(id)
+}
+
+func (m *Manager) deleteDirByID(id int) error {
 	node := m.getEntryByID(id)
 	if node == nil {
-		return
+		return fmt.Errorf("entry %d: %w", id, ErrNotFound)
+	}
+
+	if !node.Value.IsDir {
+		return fmt.Errorf("entry %d: %w", id, ErrNotADirectory)
 	}
 
 	defer m.notifySinker()
 
-	for _, elem := range node.Value.Entries.List() {
-		if elem.IsDir {
-			m.DeleteDir(elem.ID)
+	m.trashWithLinks(OpDeleteDir, node)
+
+	return nil
+}
+
+func (m *Manager) deleteDir(node *list.Node[entry]) {
+	for elem := node.Value.Entries.Head; elem != nil; elem = elem.Next {
+		if elem.Value.IsDir {
+			m.deleteDir(elem)
+
+			continue
 		}
 
-		m.unregisterEntry(elem.ID)
+		m.unregisterEntry(elem.Value.ID)
+		m.recordDelete(elem.Value.ID)
 	}
 
 	dir := m.getDirByID(node.Value.ParentID)
 	dir.DeleteElement(node)
 	m.unregisterEntry(node.Value.ID)
+	m.recordDelete(node.Value.ID)
 }
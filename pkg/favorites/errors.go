@@ -0,0 +1,40 @@
+package favorites
+
+import "errors"
+
+var (
+	ErrNotFound        = errors.New("entry not found")
+	ErrNotADirectory   = errors.New("entry is not a directory")
+	ErrInvalidName     = errors.New("invalid name")
+	ErrCycle           = errors.New("entry cannot be moved into itself or its descendant")
+	ErrNotASibling     = errors.New("next entry is not in the target directory")
+	ErrNotACommand     = errors.New("entry is not a command")
+	ErrEmptyCommand    = errors.New("command is empty")
+	ErrRunTimeout      = errors.New("command timed out")
+	ErrInvalidParam    = errors.New("invalid parameter")
+	ErrMissingParam    = errors.New("missing parameter")
+	ErrUnknownParam    = errors.New("unknown parameter")
+	ErrInvalidPath     = errors.New("invalid path")
+	ErrAmbiguousPath   = errors.New("ambiguous path")
+	ErrBackupNotFound  = errors.New("backup not found")
+	ErrInvalidBackup   = errors.New("backup is not a valid config")
+	ErrNotModified     = errors.New("not modified since the last sync")
+	ErrModified        = errors.New("modified by someone else since the last sync")
+	ErrUnsupported     = errors.New("not supported by the store")
+	ErrUnknownFormat   = errors.New("unknown config format")
+	ErrEmptyDocument   = errors.New("empty document")
+	ErrNewerVersion    = errors.New("written by a newer version")
+	ErrInvalidDocument = errors.New("invalid document")
+	ErrNothingToUndo   = errors.New("nothing to undo")
+	ErrNothingToRedo   = errors.New("nothing to redo")
+	ErrHistoryConflict = errors.New("history does not match the tree")
+	ErrTxInvalid       = errors.New("transaction leaves the tree inconsistent")
+	ErrTxDone          = errors.New("transaction has finished")
+	ErrInvalidTag      = errors.New("invalid tag")
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrInvalidQuery    = errors.New("invalid tag query")
+	ErrSmartDir        = errors.New("entry is a smart directory")
+	ErrInvalidSmart    = errors.New("invalid smart directory query")
+	ErrNotEmpty        = errors.New("directory is not empty")
+	ErrDanglingLink    = errors.New("link target not found")
+)
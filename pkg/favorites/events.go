@@ -0,0 +1,273 @@
+package favorites
+
+import "reflect"
+
+// defaultEventBuffer is the number of events a subscriber may lag behind by default.
+const defaultEventBuffer = 64
+
+// EventKind is the kind of Event.
+type EventKind int
+
+const (
+	// EventAdded is sent for a created, copied or restored entry. A copied or restored dir comes
+	// with its subtree in After.Entries, no events are sent for the entries in it.
+	EventAdded EventKind = iota
+	// EventRemoved is sent for a deleted entry. Deleting a dir deletes its subtree, no events
+	// are sent for the entries in it.
+	EventRemoved
+	// EventMoved is sent for an entry placed in another dir or another position.
+	EventMoved
+	EventRenamed
+	EventExecChanged
+	EventParamsChanged
+	EventTagsChanged
+	// EventQueryChanged is sent for a changed query of a smart dir, or a dir made smart or plain.
+	// No events are sent when the results of a smart dir change.
+	EventQueryChanged
+	// EventReloaded is sent to every subscriber when changes made by someone else are loaded
+	// into the tree, it should be read again. ID, Before and After are not set.
+	EventReloaded
+	// EventOverflow is sent when events have been dropped because the subscriber has not
+	// received them in time. The tree should be read again.
+	EventOverflow
+)
+
+var eventKindNames = map[EventKind]string{
+	EventAdded:         "added",
+	EventRemoved:       "removed",
+	EventMoved:         "moved",
+	EventRenamed:       "renamed",
+	EventExecChanged:   "exec changed",
+	EventParamsChanged: "params changed",
+	EventTagsChanged:   "tags changed",
+	EventQueryChanged:  "query changed",
+	EventReloaded:      "reloaded",
+	EventOverflow:      "overflow",
+}
+
+func (k EventKind) String() string {
+	return eventKindNames[k]
+}
+
+// Event is a change of the tree. Before and After are the entry before and after the change,
+// Before is nil for EventAdded, After is nil for EventRemoved.
+type Event struct {
+	Kind   EventKind
+	ID     int
+	Before *Entry
+	After  *Entry
+}
+
+// SubscribeOption configures a subscription.
+type SubscribeOption func(cfg *subscribeConfig)
+
+type subscribeConfig struct {
+	buffer    int
+	dir       int
+	scoped    bool
+	recursive bool
+}
+
+// SubscribeWithBuffer sets the number of events the subscriber may lag behind, 64 by default.
+// Events that do not fit are dropped and an EventOverflow is sent instead.
+func SubscribeWithBuffer(n int) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.buffer = n
+	}
+}
+
+// SubscribeToDir limits events to the entries of the dir, with its subtree if recursive.
+// A moved entry is in the dir if it is there either before or after the move.
+func SubscribeToDir(id int, recursive bool) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.dir, cfg.scoped, cfg.recursive = id, true, recursive
+	}
+}
+
+// Subscription receives events of a Manager on C until it is closed.
+type Subscription struct {
+	C <-chan Event
+
+	m        *Manager
+	c        chan Event
+	cfg      subscribeConfig
+	overflow bool
+}
+
+// Subscribe returns a subscription to changes of the tree, made by the Manager or loaded from the store.
+// Events are sent in the order of the changes, undoing a change sends the events of the reverse one.
+func (m *Manager) Subscribe(opts ...SubscribeOption) *Subscription {
+	cfg := subscribeConfig{buffer: defaultEventBuffer} //nolint:exhaustruct
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	c := make(chan Event, cfg.buffer)
+	s := &Subscription{C: c, m: m, c: c, cfg: cfg} //nolint:exhaustruct
+
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	if m.subscribers == nil {
+		m.subscribers = make(map[*Subscription]struct{})
+	}
+
+	m.subscribers[s] = struct{}{}
+
+	return s
+}
+
+// Close stops the subscription and closes C.
+func (s *Subscription) Close() {
+	s.m.subMu.Lock()
+	defer s.m.subMu.Unlock()
+
+	if _, ok := s.m.subscribers[s]; ok {
+		delete(s.m.subscribers, s)
+		close(s.c)
+	}
+}
+
+// send never blocks, the Manager's lock is held. subMu must be held.
+func (s *Subscription) send(event Event) {
+	if s.overflow {
+		select {
+		case s.c <- Event{Kind: EventOverflow}: //nolint:exhaustruct
+			s.overflow = false
+		default:
+			return
+		}
+	}
+
+	select {
+	case s.c <- event:
+	default:
+		s.overflow = true
+	}
+}
+
+// publish sends the events of the changes applied to the tree. mu must be held.
+func (m *Manager) publish(changes []HistoryChange) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	if len(m.subscribers) == 0 {
+		return
+	}
+
+	for _, change := range changes {
+		for _, event := range changeEvents(change) {
+			for s := range m.subscribers {
+				if m.inScope(s.cfg, event) {
+					s.send(event)
+				}
+			}
+		}
+	}
+}
+
+// publishReload sends EventReloaded to every subscriber.
+func (m *Manager) publishReload() {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	for s := range m.subscribers {
+		s.send(Event{Kind: EventReloaded}) //nolint:exhaustruct
+	}
+}
+
+// changeEvents returns the events of a change of an entry, none for a change of metadata.
+func changeEvents(change HistoryChange) []Event {
+	if change.Key != "" {
+		return nil
+	}
+
+	// The states are shared with the history, events get copies.
+	var before, after *Entry
+
+	if change.Before != nil {
+		e := change.Before.Entry
+		before = &e
+	}
+
+	if change.After != nil {
+		e := change.After.Entry
+		after = &e
+	}
+
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		return []Event{{Kind: EventAdded, ID: after.ID, Before: nil, After: after}}
+	case after == nil:
+		return []Event{{Kind: EventRemoved, ID: before.ID, Before: before, After: nil}}
+	}
+
+	event := func(kind EventKind) Event {
+		return Event{Kind: kind, ID: after.ID, Before: before, After: after}
+	}
+
+	var events []Event
+
+	if before.ParentID != after.ParentID || change.Before.NextID != change.After.NextID {
+		events = append(events, event(EventMoved))
+	}
+
+	if before.Name != after.Name {
+		events = append(events, event(EventRenamed))
+	}
+
+	if before.Exec != after.Exec {
+		events = append(events, event(EventExecChanged))
+	}
+
+	if !reflect.DeepEqual(before.Params, after.Params) {
+		events = append(events, event(EventParamsChanged))
+	}
+
+	if !tagsEqual(before.Tags, after.Tags) {
+		events = append(events, event(EventTagsChanged))
+	}
+
+	if !smartEqual(before.Smart, after.Smart) {
+		events = append(events, event(EventQueryChanged))
+	}
+
+	return events
+}
+
+// inScope reports whether the subscriber gets the event. mu must be held.
+func (m *Manager) inScope(cfg subscribeConfig, event Event) bool {
+	if !cfg.scoped {
+		return true
+	}
+
+	for _, e := range []*Entry{event.Before, event.After} {
+		if e != nil && m.inDir(e.ParentID, cfg.dir, cfg.recursive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inDir reports whether the parentID dir is the dir or, if recursive, is in its subtree.
+func (m *Manager) inDir(parentID, dir int, recursive bool) bool {
+	if !recursive {
+		return parentID == dir
+	}
+
+	for id := parentID; ; {
+		if id == dir {
+			return true
+		}
+
+		node := m.getEntryByID(id)
+		if node == nil {
+			return false
+		}
+
+		id = node.Value.ParentID
+	}
+}
@@ -0,0 +1,184 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestEvents(t *testing.T) {
+	newManager := func(t *testing.T) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	type event struct {
+		kind favorites2.EventKind
+		id   int
+	}
+
+	// drain returns the events received so far.
+	drain := func(s *favorites2.Subscription) []event {
+		var events []event
+
+		for {
+			select {
+			case e := <-s.C:
+				events = append(events, event{e.Kind, e.ID})
+			default:
+				return events
+			}
+		}
+	}
+
+	t.Run("operations send typed events", func(t *testing.T) {
+		manager := newManager(t)
+		s := manager.Subscribe()
+
+		defer s.Close()
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		x, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.MoveEntry(x, ops, 0))
+		require.NoError(t, manager.RenameEntry(x, "y"))
+		require.NoError(t, manager.ModifyExec(x, "false"))
+		require.NoError(t, manager.SetParams(x, []favorites2.Param{{Name: "p"}})) //nolint:exhaustruct
+		manager.SetMetadata("owner", "ops")
+		require.NoError(t, manager.DeleteDir(ops))
+		require.NoError(t, manager.Undo())
+
+		require.Equal(t, []event{
+			{favorites2.EventAdded, ops},
+			{favorites2.EventAdded, x},
+			{favorites2.EventMoved, x},
+			{favorites2.EventRenamed, x},
+			{favorites2.EventExecChanged, x},
+			{favorites2.EventParamsChanged, x},
+			{favorites2.EventRemoved, ops},
+			{favorites2.EventAdded, ops},
+		}, drain(s))
+
+		require.NoError(t, manager.RenameEntry(x, "z"))
+
+		e := <-s.C
+		require.Equal(t, favorites2.EventRenamed, e.Kind)
+		require.Equal(t, "y", e.Before.Name)
+		require.Equal(t, "z", e.After.Name)
+		require.Equal(t, ops, e.After.ParentID)
+	})
+
+	t.Run("transactions send events when committed", func(t *testing.T) {
+		manager := newManager(t)
+		s := manager.Subscribe()
+
+		defer s.Close()
+
+		var x int
+
+		require.NoError(t, manager.Tx(func(tx *favorites2.Tx) error {
+			var err error
+
+			x, err = tx.AddCommand("x", "true", 0, 0)
+			require.NoError(t, err)
+			require.Empty(t, drain(s))
+
+			return tx.RenameEntry(x, "y")
+		}))
+
+		require.Equal(t, []event{{favorites2.EventAdded, x}, {favorites2.EventRenamed, x}}, drain(s))
+	})
+
+	t.Run("events are filtered by dir", func(t *testing.T) {
+		manager := newManager(t)
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		db, err := manager.AddDir("db", ops, 0)
+		require.NoError(t, err)
+
+		direct := manager.Subscribe(favorites2.SubscribeToDir(ops, false))
+		defer direct.Close()
+
+		recursive := manager.Subscribe(favorites2.SubscribeToDir(ops, true))
+		defer recursive.Close()
+
+		x, err := manager.AddCommand("x", "true", db, 0)
+		require.NoError(t, err)
+		y, err := manager.AddCommand("y", "true", 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.MoveEntry(y, ops, 0))
+		require.NoError(t, manager.MoveEntry(y, 0, 0))
+
+		require.Equal(t, []event{{favorites2.EventMoved, y}, {favorites2.EventMoved, y}}, drain(direct))
+		require.Equal(t, []event{
+			{favorites2.EventAdded, x}, {favorites2.EventMoved, y}, {favorites2.EventMoved, y},
+		}, drain(recursive))
+	})
+
+	t.Run("slow subscriber gets an overflow", func(t *testing.T) {
+		manager := newManager(t)
+		s := manager.Subscribe(favorites2.SubscribeWithBuffer(2))
+
+		for _, name := range []string{"a", "b", "c", "d"} {
+			_, err := manager.AddCommand(name, "true", 0, 0)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, []event{{favorites2.EventAdded, 1}, {favorites2.EventAdded, 2}}, drain(s))
+
+		_, err := manager.AddCommand("e", "true", 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, []event{{favorites2.EventOverflow, 0}, {favorites2.EventAdded, 5}}, drain(s))
+
+		s.Close()
+		s.Close()
+
+		_, ok := <-s.C
+		require.False(t, ok)
+
+		_, err = manager.AddCommand("f", "true", 0, 0)
+		require.NoError(t, err)
+	})
+
+	t.Run("changes loaded from the store send reloaded", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		newFileManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			return manager
+		}
+
+		ours := newFileManager()
+		s := ours.Subscribe(favorites2.SubscribeToDir(100, false))
+
+		defer s.Close()
+
+		theirs := newFileManager()
+		_, err := theirs.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		theirs.SyncOut()
+
+		ours.SyncIn()
+		require.Equal(t, []event{{favorites2.EventReloaded, 0}}, drain(s))
+
+		ours.SyncIn()
+		require.Empty(t, drain(s))
+	})
+}
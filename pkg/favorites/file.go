@@ -0,0 +1,541 @@
+package favorites
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	configFilePerm = 0o644
+	// racyWindow is how long after a change the file modification time is not trusted,
+	// as another change within the timestamp granularity would keep it.
+	racyWindow = 2 * time.Second
+)
+
+var errConfigChanged = errors.New("config file has been changed during sync")
+
+// revision identifies the config file content as last seen by the Manager.
+type revision struct {
+	hash    [sha256.Size]byte
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+// sameStat reports whether the file is surely unchanged without reading it.
+func (r revision) sameStat(info os.FileInfo) bool {
+	return !r.checked.IsZero() && r.modTime.Equal(info.ModTime()) && r.size == info.Size() &&
+		r.checked.Sub(r.modTime) > racyWindow
+}
+
+// readConfigFile returns the file content and its revision, nil content if the file does not exist.
+func readConfigFile(path string) ([]byte, revision, error) {
+	var rev revision
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, rev, nil
+		}
+
+		return nil, rev, fmt.Errorf("os.Open(path): %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, rev, fmt.Errorf("file.Stat(): %w", err)
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, rev, fmt.Errorf("io.ReadAll(file): %w", err)
+	}
+
+	return data, revision{
+		hash:    sha256.Sum256(data),
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		checked: time.Now(),
+	}, nil
+}
+
+// Backup is a rotated copy of the config file, Index 1 is the most recent one.
+type Backup struct {
+	Index   int       `json:"index"`
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"modTime"`
+	// Valid reports whether the backup parses as a config file.
+	Valid bool `json:"valid"`
+}
+
+func backupPath(configPath string, index int) string {
+	return configPath + "." + strconv.Itoa(index)
+}
+
+// FileStore keeps the tree in a YAML, JSON or TOML file, by default the format of its extension,
+// see FormatOf. Writes are atomic, the replaced file is kept as a rotated backup, and FileStores
+// writing the same file, even in different processes, take turns.
+type FileStore struct {
+	log      logger
+	path     string
+	backups  int
+	format   Format
+	mu       sync.Mutex
+	revision revision
+	loaded   bool
+}
+
+// NewFileStore returns a store of the file at path in the format keeping at most backups of it.
+func NewFileStore(log logger, path string, backups int, format Format) *FileStore {
+	return &FileStore{log: log, path: path, backups: backups, format: format.of(path)} //nolint:exhaustruct
+}
+
+func (s *FileStore) Load() (Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A file deleted after it has been loaded is not taken for an empty tree.
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && s.loaded && s.revision.sameStat(info) {
+		return s.notModified()
+	}
+
+	if err != nil {
+		return Document{}, fmt.Errorf("os.Stat(s.path): %w", err) //nolint:exhaustruct
+	}
+
+	data, rev, err := readConfigFile(s.path)
+	if err != nil {
+		return Document{}, err //nolint:exhaustruct
+	}
+
+	if data == nil {
+		return s.notModified()
+	}
+
+	if s.loaded && rev.hash == s.revision.hash {
+		s.revision = rev
+
+		return Document{}, ErrNotModified //nolint:exhaustruct
+	}
+
+	doc, err := UnmarshalDocument(data, s.format)
+	if err != nil {
+		return doc, err
+	}
+
+	s.revision, s.loaded = rev, true
+
+	return doc, nil
+}
+
+func (s *FileStore) notModified() (Document, error) {
+	if s.loaded {
+		return Document{}, ErrNotModified //nolint:exhaustruct
+	}
+
+	s.loaded = true
+
+	return Document{}, nil //nolint:exhaustruct
+}
+
+// LoadHistory reads the history from the file next to the config file, see historyPath.
+func (s *FileStore) LoadHistory() (History, error) {
+	var history History
+
+	data, err := os.ReadFile(historyPath(s.path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return history, nil
+		}
+
+		return history, fmt.Errorf("os.ReadFile(historyPath(s.path)): %w", err)
+	}
+
+	return history, unmarshal(data, &history, s.format)
+}
+
+// SaveHistory writes the history, the last writer wins.
+func (s *FileStore) SaveHistory(history History) error {
+	data, err := marshal(history, s.format)
+	if err != nil {
+		return err
+	}
+
+	return writeConfigFile(historyPath(s.path), data, 0, s.format, nil)
+}
+
+func historyPath(configPath string) string {
+	return configPath + ".history"
+}
+
+// usageFile is the content of the usage file.
+type usageFile struct {
+	Usage []Usage `yaml:"usage" json:"usage" toml:"usage"`
+}
+
+// LoadUsage reads the usage from the file next to the config file, see usagePath.
+func (s *FileStore) LoadUsage() ([]Usage, error) {
+	var file usageFile
+
+	data, err := os.ReadFile(usagePath(s.path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("os.ReadFile(usagePath(s.path)): %w", err)
+	}
+
+	if err = unmarshal(data, &file, s.format); err != nil {
+		return nil, err
+	}
+
+	return file.Usage, nil
+}
+
+// AddUsage adds the uses to the usage file under its lock.
+func (s *FileStore) AddUsage(uses []Usage) ([]Usage, error) {
+	unlock, err := lockConfig(usagePath(s.path))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	usage, err := s.LoadUsage()
+	if err != nil || len(uses) == 0 {
+		return usage, err
+	}
+
+	usage = AddUsage(usage, uses)
+
+	data, err := marshal(usageFile{Usage: usage}, s.format)
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, writeConfigFile(usagePath(s.path), data, 0, s.format, nil)
+}
+
+func usagePath(configPath string) string {
+	return configPath + ".usage"
+}
+
+// Save writes the tree unless the file has been changed since the last Load or Save.
+// A corrupt file is overwritten, a file written by a newer version is not.
+func (s *FileStore) Save(doc Document) error {
+	data, err := MarshalDocument(doc, s.format)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockConfig(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var expected [sha256.Size]byte
+
+	current, err := os.ReadFile(s.path)
+
+	switch {
+	case err == nil:
+		expected = sha256.Sum256(current)
+
+		_, decodeErr := UnmarshalDocument(current, s.format)
+
+		switch {
+		case errors.Is(decodeErr, ErrNewerVersion):
+			return fmt.Errorf("%s: %w", s.path, decodeErr)
+		case decodeErr == nil && expected != s.revision.hash:
+			return fmt.Errorf("%s: %w", s.path, ErrModified)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("os.ReadFile(s.path): %w", err)
+	}
+
+	if err = writeConfigFile(s.path, data, s.backups, s.format, &expected); err != nil {
+		if errors.Is(err, errConfigChanged) {
+			return fmt.Errorf("%s: %w", s.path, ErrModified)
+		}
+
+		return err
+	}
+
+	// The file is not stat'ed here, another process may have replaced it already.
+	s.revision = revision{hash: sha256.Sum256(data)} //nolint:exhaustruct
+	s.loaded = true
+
+	return nil
+}
+
+// RestoreBackup replaces the file with the backup index, the next Load returns its content.
+// The replaced file, if valid, becomes the most recent backup.
+func (s *FileStore) RestoreBackup(index int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := restoreBackup(s.path, index, s.backups, s.format); err != nil {
+		return err
+	}
+
+	s.revision, s.loaded = revision{}, false //nolint:exhaustruct
+
+	return nil
+}
+
+// writeConfigFile replaces the file at path with data so that the file is either old or new
+// after a crash: data goes to a temp file in the same directory, which is synced and renamed
+// over the original. The permissions of the original are preserved. If the original differs from
+// data and decodes as a config in the format, it becomes backup 1 and older backups are shifted,
+// keeping at most backups. A corrupt original is overwritten without a backup, so it never pushes
+// a valid one out. If expected is not nil, the write fails with errConfigChanged unless the file
+// has that hash just before the rename.
+func writeConfigFile(path string, data []byte, backups int, format Format, expected *[sha256.Size]byte) error {
+	perm := os.FileMode(configFilePerm)
+
+	current, err := os.ReadFile(path)
+
+	switch {
+	case err == nil:
+		if bytes.Equal(current, data) {
+			return nil
+		}
+
+		if info, statErr := os.Stat(path); statErr == nil {
+			perm = info.Mode().Perm()
+		}
+
+		if _, decodeErr := UnmarshalDocument(current, format); decodeErr == nil && backups > 0 {
+			if err = rotateBackups(path, backups); err != nil {
+				return err
+			}
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("os.ReadFile(path): %w", err)
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp(dir): %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return fmt.Errorf("tmp.Write(data): %w", err)
+	}
+
+	if err = tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("tmp.Chmod(perm): %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("tmp.Sync(): %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("tmp.Close(): %w", err)
+	}
+
+	if expected != nil {
+		if err = checkUnchanged(path, *expected); err != nil {
+			return err
+		}
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("os.Rename(tmp, path): %w", err)
+	}
+
+	syncDir(dir)
+
+	return nil
+}
+
+// checkUnchanged narrows the window in which a writer not taking the lock, like a text editor,
+// gets its change overwritten to the time between the check and the rename.
+func checkUnchanged(path string, expected [sha256.Size]byte) error {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("os.ReadFile(path): %w", err)
+	}
+
+	if sha256.Sum256(current) != expected {
+		return errConfigChanged
+	}
+
+	return nil
+}
+
+// syncDir makes the rename durable. Not every platform can sync a directory, so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// rotateBackups shifts path.1..path.(n-1) to path.2..path.n and makes path.1 a copy of path.
+func rotateBackups(path string, n int) error {
+	for i := n - 1; i >= 1; i-- {
+		err := os.Rename(backupPath(path, i), backupPath(path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("os.Rename(backup %d): %w", i, err)
+		}
+	}
+
+	first := backupPath(path, 1)
+	if err := os.Remove(first); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("os.Remove(backup 1): %w", err)
+	}
+
+	// The original is renamed over later, so a hard link keeps its content without copying.
+	if err := os.Link(path, first); err == nil {
+		return nil
+	}
+
+	return copyFile(path, first)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("os.Open(src): %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("in.Stat(): %w", err)
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("os.OpenFile(dst): %w", err)
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+
+		return fmt.Errorf("io.Copy(out, in): %w", err)
+	}
+
+	if err = out.Close(); err != nil {
+		return fmt.Errorf("out.Close(): %w", err)
+	}
+
+	return nil
+}
+
+// ListBackups returns the backups of the config file, the most recent first.
+// Backups are validated in the format of the config file extension.
+func ListBackups(configPath string) ([]Backup, error) {
+	dir, base := filepath.Split(configPath)
+	if dir == "" {
+		dir = "."
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadDir(dir): %w", err)
+	}
+
+	var backups []Backup
+
+	for _, file := range files {
+		suffix, ok := strings.CutPrefix(file.Name(), base+".")
+		if !ok || !file.Type().IsRegular() {
+			continue
+		}
+
+		index, err := strconv.Atoi(suffix)
+		if err != nil || index < 1 {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			return nil, fmt.Errorf("file.Info(): %w", err)
+		}
+
+		data, err := os.ReadFile(backupPath(configPath, index))
+		if err != nil {
+			return nil, fmt.Errorf("os.ReadFile(backup %d): %w", index, err)
+		}
+
+		_, decodeErr := UnmarshalDocument(data, FormatOf(configPath))
+
+		backups = append(backups, Backup{
+			Index:   index,
+			Path:    backupPath(configPath, index),
+			ModTime: info.ModTime(),
+			Valid:   decodeErr == nil,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Index < backups[j].Index })
+
+	return backups, nil
+}
+
+// RestoreBackup replaces the config file with the backup index. It is meant for a corrupt
+// config file the Manager fails to load, so the current file is overwritten without a backup.
+func RestoreBackup(configPath string, index int) error {
+	return restoreBackup(configPath, index, 0, FormatOf(configPath))
+}
+
+func restoreBackup(configPath string, index, backups int, format Format) error {
+	data, err := os.ReadFile(backupPath(configPath, index))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("backup %d: %w", index, ErrBackupNotFound)
+		}
+
+		return fmt.Errorf("os.ReadFile(backup): %w", err)
+	}
+
+	if _, err = UnmarshalDocument(data, format); err != nil {
+		return fmt.Errorf("backup %d: %w: %v", index, ErrInvalidBackup, err) //nolint:errorlint
+	}
+
+	unlock, err := lockConfig(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return writeConfigFile(configPath, data, backups, format, nil)
+}
@@ -0,0 +1,115 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestConfigFile(t *testing.T) {
+	newManager := func(configPath string, opts ...favorites2.OptOptionsSetter) *favorites2.Manager {
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40, opts...))
+		require.NoError(t, err)
+		manager.Close()
+
+		return manager
+	}
+
+	t.Run("atomic write keeps permissions", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "favorites.yaml")
+		manager := newManager(configPath)
+
+		_, err := manager.AddCommand("first", "true", 0, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+		require.NoError(t, os.Chmod(configPath, 0o600))
+
+		_, err = manager.AddCommand("second", "true", 0, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+
+		info, err := os.Stat(configPath)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+
+		for _, file := range files {
+			require.False(t, strings.Contains(file.Name(), ".tmp-"), "temp file %s left", file.Name())
+		}
+
+		require.Len(t, newManager(configPath).ListDirectory(0), 2)
+	})
+
+	t.Run("backups are rotated", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		manager := newManager(configPath, favorites2.WithBackups(2))
+
+		for _, name := range []string{"a", "b", "c", "d"} {
+			_, err := manager.AddCommand(name, "true", 0, 0)
+			require.NoError(t, err)
+			manager.SyncOut()
+		}
+
+		// Nothing changed, no new backup.
+		manager.SyncOut()
+
+		backups, err := favorites2.ListBackups(configPath)
+		require.NoError(t, err)
+		require.Len(t, backups, 2)
+		require.Equal(t, 1, backups[0].Index)
+		require.Equal(t, 2, backups[1].Index)
+		require.True(t, backups[0].Valid)
+
+		require.NoError(t, manager.RestoreBackup(2))
+		require.Len(t, manager.ListDirectory(0), 2)
+
+		require.NoError(t, manager.RestoreBackup(1))
+		require.Len(t, manager.ListDirectory(0), 4)
+
+		require.ErrorIs(t, manager.RestoreBackup(5), favorites2.ErrBackupNotFound)
+	})
+
+	t.Run("restore corrupt config", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		manager := newManager(configPath)
+
+		for _, name := range []string{"a", "b"} {
+			_, err := manager.AddCommand(name, "true", 0, 0)
+			require.NoError(t, err)
+			manager.SyncOut()
+		}
+
+		require.NoError(t, os.WriteFile(configPath, []byte("- id: 1\n  name: [a"), 0o600))
+		_, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40))
+		require.Error(t, err)
+
+		require.NoError(t, os.WriteFile(configPath, nil, 0o600))
+		_, err = favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40))
+		require.Error(t, err)
+
+		require.NoError(t, os.WriteFile(configPath+".2", []byte("{"), 0o600))
+		backups, err := favorites2.ListBackups(configPath)
+		require.NoError(t, err)
+		require.Len(t, backups, 2)
+		require.False(t, backups[1].Valid)
+		require.ErrorIs(t, favorites2.RestoreBackup(configPath, 2), favorites2.ErrInvalidBackup)
+
+		require.NoError(t, favorites2.RestoreBackup(configPath, 1))
+		require.Len(t, newManager(configPath).ListDirectory(0), 1)
+	})
+}
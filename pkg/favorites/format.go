@@ -0,0 +1,144 @@
+package favorites
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an encoding of the config file.
+type Format int
+
+const (
+	// FormatAuto chooses the format by the file extension, see FormatOf.
+	FormatAuto Format = iota
+	FormatYAML
+	FormatJSON
+	FormatTOML
+)
+
+var formatNames = map[Format]string{
+	FormatAuto: "auto",
+	FormatYAML: "yaml",
+	FormatJSON: "json",
+	FormatTOML: "toml",
+}
+
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat returns the format named like Format.String returns.
+func ParseFormat(name string) (Format, error) {
+	for format, formatName := range formatNames {
+		if strings.EqualFold(name, formatName) {
+			return format, nil
+		}
+	}
+
+	return FormatAuto, fmt.Errorf("%q: %w", name, ErrUnknownFormat)
+}
+
+// FormatOf returns the format of the file by its extension: .json, .toml, YAML otherwise.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatYAML
+	}
+}
+
+// of resolves FormatAuto for the file at path.
+func (f Format) of(path string) Format {
+	if f == FormatAuto {
+		return FormatOf(path)
+	}
+
+	return f
+}
+
+// MarshalDocument encodes the tree in the format, FormatAuto means YAML.
+// The document is written as of SchemaVersion.
+func MarshalDocument(doc Document, format Format) ([]byte, error) {
+	doc.Version = SchemaVersion
+
+	return marshal(doc, format)
+}
+
+func marshal(v any, format Format) ([]byte, error) {
+	switch format {
+	case FormatAuto, FormatYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("yaml.Marshal(v): %w", err)
+		}
+
+		return data, nil
+	case FormatJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("json.MarshalIndent(v): %w", err)
+		}
+
+		return append(data, '\n'), nil
+	case FormatTOML:
+		var buf bytes.Buffer
+
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, fmt.Errorf("toml.NewEncoder(buf).Encode(v): %w", err)
+		}
+
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("%v: %w", format, ErrUnknownFormat)
+	}
+}
+
+// UnmarshalDocument decodes the tree in the format, FormatAuto means YAML. Documents of older
+// schema versions are migrated, newer ones fail with ErrNewerVersion. Unlike the underlying
+// decoders it fails on empty input, so a truncated file is never taken for an empty library.
+func UnmarshalDocument(data []byte, format Format) (Document, error) {
+	var doc Document
+
+	data, err := upgrade(data, format)
+	if err != nil {
+		return doc, err
+	}
+
+	err = unmarshal(data, &doc, format)
+
+	return doc, err
+}
+
+func unmarshal(data []byte, v any, format Format) error {
+	switch format {
+	case FormatAuto, FormatYAML:
+		if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+			return fmt.Errorf("yaml.NewDecoder(data).Decode(v): %w", err)
+		}
+	case FormatJSON:
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("json.Unmarshal(data, v): %w", err)
+		}
+	case FormatTOML:
+		if _, err := toml.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+			return fmt.Errorf("toml.NewDecoder(data).Decode(v): %w", err)
+		}
+	default:
+		return fmt.Errorf("%v: %w", format, ErrUnknownFormat)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestFormats(t *testing.T) {
+	formats := []favorites2.Format{favorites2.FormatYAML, favorites2.FormatJSON, favorites2.FormatTOML}
+
+	// library returns a tree using every field of entries and params.
+	library := func(t *testing.T) favorites2.Document {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40, favorites2.WithGlobalIDs(true)))
+		require.NoError(t, err)
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		db, err := manager.AddDir("db", ops, 0)
+		require.NoError(t, err)
+		_, err = manager.AddDir("empty", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("", "uptime", 0, ops)
+		require.NoError(t, err)
+		backup, err := manager.AddCommand("backup \"quoted\"", "pg_dump {{db}} -n {{n:1}}", db, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.SetParams(backup, []favorites2.Param{
+			{Name: "db", Type: favorites2.ParamString, Choices: []string{"main", "stats"}}, //nolint:exhaustruct
+			{Name: "n", Type: favorites2.ParamInt, Default: "1", Pattern: "^[0-9]+$"},      //nolint:exhaustruct
+		}))
+		require.NoError(t, manager.SetTags(backup, []string{"prod", "db"}))
+
+		createdAfter := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		_, err = manager.AddSmartDir("recent prod", favorites2.SmartQuery{
+			Tags: "prod AND NOT readonly", Text: "dump", UsedWithin: "168h", CreatedAfter: &createdAfter, Limit: 5,
+		}, ops, 0)
+		require.NoError(t, err)
+
+		return favorites2.Document{NextID: 10, Entries: exportTree(manager, 0)}
+	}
+
+	t.Run("round trips keep the tree", func(t *testing.T) {
+		doc := library(t)
+
+		want, err := favorites2.MarshalDocument(doc, favorites2.FormatYAML)
+		require.NoError(t, err)
+
+		for _, from := range formats {
+			for _, to := range formats {
+				data, err := favorites2.MarshalDocument(doc, from)
+				require.NoError(t, err)
+
+				decoded, err := favorites2.UnmarshalDocument(data, from)
+				require.NoError(t, err, from)
+
+				data, err = favorites2.MarshalDocument(decoded, to)
+				require.NoError(t, err)
+
+				decoded, err = favorites2.UnmarshalDocument(data, to)
+				require.NoError(t, err, to)
+
+				got, err := favorites2.MarshalDocument(decoded, favorites2.FormatYAML)
+				require.NoError(t, err)
+				require.Equal(t, string(want), string(got), "%v to %v", from, to)
+			}
+		}
+	})
+
+	t.Run("format is chosen by the extension", func(t *testing.T) {
+		dir := t.TempDir()
+		doc := library(t)
+
+		for _, name := range []string{"favorites.yaml", "favorites.json", "favorites.toml"} {
+			configPath := filepath.Join(dir, name)
+			store := favorites2.NewFileStore(logrus.New(), configPath, 3, favorites2.FormatAuto)
+
+			_, err := store.Load()
+			require.NoError(t, err)
+			require.NoError(t, store.Save(doc))
+
+			data, err := os.ReadFile(configPath)
+			require.NoError(t, err)
+
+			_, err = favorites2.UnmarshalDocument(data, favorites2.FormatOf(configPath))
+			require.NoError(t, err)
+
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			require.Equal(t, []string{"", "ops", "empty"}, names(manager.ListDirectory(0)))
+			require.Empty(t, manager.CheckIntegrity())
+		}
+	})
+
+	t.Run("explicit format", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.conf")
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40, favorites2.WithFormat(favorites2.FormatJSON)))
+		require.NoError(t, err)
+		manager.Close()
+
+		_, err = manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		require.True(t, json.Valid(data))
+	})
+
+	t.Run("empty input is an error", func(t *testing.T) {
+		for _, format := range formats {
+			_, err := favorites2.UnmarshalDocument([]byte("\n"), format)
+			require.Error(t, err, format)
+		}
+	})
+
+	t.Run("names", func(t *testing.T) {
+		for _, format := range append(formats, favorites2.FormatAuto) {
+			parsed, err := favorites2.ParseFormat(format.String())
+			require.NoError(t, err)
+			require.Equal(t, format, parsed)
+		}
+
+		_, err := favorites2.ParseFormat("xml")
+		require.ErrorIs(t, err, favorites2.ErrUnknownFormat)
+		require.Equal(t, favorites2.FormatTOML, favorites2.FormatOf("/etc/favorites.TOML"))
+		require.Equal(t, favorites2.FormatYAML, favorites2.FormatOf("favorites.yml"))
+	})
+}
+
+// exportTree returns the subtree of the dir id with nested entries.
+func exportTree(manager *favorites2.Manager, id int) []favorites2.Entry {
+	entries := manager.ListDirectory(id)
+
+	for i := range entries {
+		if entries[i].IsDir && entries[i].Smart == nil {
+			entries[i].Entries = exportTree(manager, entries[i].ID)
+		}
+	}
+
+	return entries
+}
+
+func names(entries []favorites2.Entry) []string {
+	result := make([]string, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e.Name)
+	}
+
+	return result
+}
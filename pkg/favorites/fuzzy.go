@@ -0,0 +1,146 @@
+package favorites
+
+import (
+	"math"
+	"unicode"
+)
+
+// Scores of fuzzyMatch, modeled after fzf: every matched rune scores, gaps between matched runes
+// cost, and runes at the start of a word or right after another matched rune score extra.
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+	bonusBoundary     = scoreMatch / 2
+	bonusCamel        = bonusBoundary - 1
+	bonusConsecutive  = 4
+	// bonusFirstMultiplier weights the bonus of the first pattern rune, matches starting at
+	// a word are preferred.
+	bonusFirstMultiplier = 2
+)
+
+const noScore = math.MinInt32
+
+// fuzzyMatch finds the pattern runes in the text in order, not necessarily adjacent, and returns
+// the best score and the indexes of the matched text runes. The match is case-insensitive unless
+// the pattern has upper case runes.
+func fuzzyMatch(pattern, text []rune) (int, []int, bool) {
+	if len(pattern) == 0 || len(pattern) > len(text) {
+		return 0, nil, false
+	}
+
+	caseSensitive := false
+
+	for _, r := range pattern {
+		if unicode.IsUpper(r) {
+			caseSensitive = true
+
+			break
+		}
+	}
+
+	equal := func(p, t rune) bool {
+		if caseSensitive {
+			return p == t
+		}
+
+		return p == unicode.ToLower(t)
+	}
+
+	bonus := make([]int, len(text))
+	for j := range text {
+		bonus[j] = runeBonus(text, j)
+	}
+
+	// scores[i][j] is the best score of pattern[:i+1] with pattern[i] matched at text[j],
+	// prev[i][j] is where pattern[i-1] is matched then.
+	scores := make([][]int, len(pattern))
+	prev := make([][]int, len(pattern))
+
+	for i := range pattern {
+		scores[i] = make([]int, len(text))
+		prev[i] = make([]int, len(text))
+
+		// best is the score of the best match of pattern[:i] ending before j-1, with the gap
+		// to j charged, at bestJ.
+		best, bestJ := noScore, -1
+
+		for j := range text {
+			scores[i][j] = noScore
+
+			if i > 0 && j >= 2 && scores[i-1][j-2] != noScore {
+				if best != noScore {
+					best += scoreGapExtension
+				}
+
+				if candidate := scores[i-1][j-2] + scoreGapStart; candidate > best {
+					best, bestJ = candidate, j-2
+				}
+			} else if best != noScore {
+				best += scoreGapExtension
+			}
+
+			if !equal(pattern[i], text[j]) {
+				continue
+			}
+
+			if i == 0 {
+				scores[i][j] = scoreMatch + bonus[j]*bonusFirstMultiplier
+
+				continue
+			}
+
+			from, fromJ := best, bestJ
+			if j >= 1 && scores[i-1][j-1] != noScore && scores[i-1][j-1]+bonusConsecutive >= from {
+				from, fromJ = scores[i-1][j-1]+bonusConsecutive, j-1
+			}
+
+			if from == noScore {
+				continue
+			}
+
+			scores[i][j] = from + scoreMatch + bonus[j]
+			prev[i][j] = fromJ
+		}
+	}
+
+	last := len(pattern) - 1
+	score, end := noScore, -1
+
+	for j, s := range scores[last] {
+		if s > score {
+			score, end = s, j
+		}
+	}
+
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	positions := make([]int, len(pattern))
+	for i, j := last, end; i >= 0; i-- {
+		positions[i] = j
+		j = prev[i][j]
+	}
+
+	return score, positions, true
+}
+
+// runeBonus rewards the start of a word: the first rune, a rune after a separator, an upper
+// case rune after a lower case one and a digit after a non-digit.
+func runeBonus(text []rune, j int) int {
+	if j == 0 {
+		return bonusBoundary
+	}
+
+	before, r := text[j-1], text[j]
+
+	switch {
+	case !unicode.IsLetter(before) && !unicode.IsDigit(before) && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+		return bonusBoundary
+	case unicode.IsLower(before) && unicode.IsUpper(r), !unicode.IsDigit(before) && unicode.IsDigit(r):
+		return bonusCamel
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,389 @@
+package favorites
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/list"
+)
+
+// Operations recorded in HistoryStep.Op.
+const (
+	OpAddCommand    = "add command"
+	OpAddDir        = "add dir"
+	OpDeleteCommand = "delete command"
+	OpDeleteDir     = "delete dir"
+	OpModifyExec    = "modify exec"
+	OpRename        = "rename"
+	OpMove          = "move"
+	OpSetParams     = "set params"
+	OpSetMetadata   = "set metadata"
+	OpRestore       = "restore"
+	OpSetTags       = "set tags"
+	OpRenameTag     = "rename tag"
+	OpSetSmartQuery = "set smart query"
+	OpAddLink       = "add link"
+	OpCopy          = "copy"
+)
+
+// History is the undo and redo stacks of a Manager, the most recent step last.
+type History struct {
+	Undo []HistoryStep `yaml:"undo" json:"undo" toml:"undo"`
+	Redo []HistoryStep `yaml:"redo" json:"redo" toml:"redo"`
+}
+
+// HistoryStep is an operation recorded as the states of the changed entries before and after it.
+type HistoryStep struct {
+	Op      string          `yaml:"op" json:"op" toml:"op"`
+	Time    time.Time       `yaml:"time" json:"time" toml:"time"`
+	Changes []HistoryChange `yaml:"changes" json:"changes" toml:"changes"`
+}
+
+// HistoryChange is a change of a single entry or, if Key is set, of a metadata value.
+// Before is nil for a created entry, After is nil for a deleted one.
+type HistoryChange struct {
+	Before   *EntryState `yaml:"before,omitempty" json:"before,omitempty" toml:"before,omitempty"`
+	After    *EntryState `yaml:"after,omitempty" json:"after,omitempty" toml:"after,omitempty"`
+	Key      string      `yaml:"key,omitempty" json:"key,omitempty" toml:"key,omitempty"`
+	OldValue string      `yaml:"oldValue,omitempty" json:"oldValue,omitempty" toml:"oldValue,omitempty"`
+	NewValue string      `yaml:"newValue,omitempty" json:"newValue,omitempty" toml:"newValue,omitempty"`
+	// Trash means the entry is in the trash while it is deleted, either way the change is applied.
+	Trash bool `yaml:"trash,omitempty" json:"trash,omitempty" toml:"trash,omitempty"`
+}
+
+// EntryState is an entry with its place in the tree. Entries of a deleted dir are kept in the Entry.
+type EntryState struct {
+	Entry  Entry `yaml:"entry" json:"entry" toml:"entry"`
+	NextID int   `yaml:"nextId" json:"nextId" toml:"nextId"`
+}
+
+// HistoryStore is a Store keeping the history of its Manager, so it survives restarts.
+type HistoryStore interface {
+	Store
+	// LoadHistory returns the saved history, an empty one if there is none.
+	LoadHistory() (History, error)
+	SaveHistory(history History) error
+}
+
+// Undo reverts the latest recorded operation. The operations of other processes merged into
+// the tree are not recorded, an operation conflicting with them fails with ErrHistoryConflict
+// and stays in the history.
+func (m *Manager) Undo() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.replay(&m.undo, &m.redo, true)
+}
+
+// Redo repeats the latest undone operation. Any other operation clears the operations to redo.
+func (m *Manager) Redo() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.replay(&m.redo, &m.undo, false)
+}
+
+// History returns the undo and redo stacks.
+func (m *Manager) History() History {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.history()
+}
+
+// history returns a copy of the stacks, steps are never changed. mu must be held.
+func (m *Manager) history() History {
+	return History{
+		Undo: append([]HistoryStep(nil), m.undo...),
+		Redo: append([]HistoryStep(nil), m.redo...),
+	}
+}
+
+// replay applies the latest step of from, backwards if undo, and moves it to to. mu must be held.
+func (m *Manager) replay(from, to *[]HistoryStep, undo bool) error {
+	if len(*from) == 0 {
+		if undo {
+			return ErrNothingToUndo
+		}
+
+		return ErrNothingToRedo
+	}
+
+	step := (*from)[len(*from)-1]
+
+	m.replaying = true
+	defer func() { m.replaying = false }()
+
+	changes := stepChanges(step, undo)
+	if err := m.applyStep(changes); err != nil {
+		return fmt.Errorf("%s: %w", step.Op, err)
+	}
+
+	m.updateIndex(changes)
+	m.publish(changes)
+
+	*from = (*from)[:len(*from)-1]
+	*to = append(*to, step)
+	m.historyChanged = true
+
+	m.notifySinker()
+
+	return nil
+}
+
+// stepChanges returns the changes of the step, the reverse ones in the reverse order if undo.
+func stepChanges(step HistoryStep, undo bool) []HistoryChange {
+	if !undo {
+		return step.Changes
+	}
+
+	changes := make([]HistoryChange, 0, len(step.Changes))
+	for i := len(step.Changes) - 1; i >= 0; i-- {
+		changes = append(changes, step.Changes[i].inverse())
+	}
+
+	return changes
+}
+
+// applyStep applies all the changes or none of them.
+func (m *Manager) applyStep(changes []HistoryChange) error {
+	for i, change := range changes {
+		if err := m.applyChange(change); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if rollbackErr := m.applyChange(changes[j].inverse()); rollbackErr != nil {
+					m.log.Error("history rollback:", rollbackErr)
+				}
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c HistoryChange) inverse() HistoryChange {
+	return HistoryChange{
+		Before:   c.After,
+		After:    c.Before,
+		Key:      c.Key,
+		OldValue: c.NewValue,
+		NewValue: c.OldValue,
+		Trash:    c.Trash,
+	}
+}
+
+// applyChange turns the Before state into the After state. It fails with ErrHistoryConflict if
+// the entry or the metadata value is not in the Before state, changed by a merge meanwhile.
+func (m *Manager) applyChange(change HistoryChange) error {
+	switch {
+	case change.Key != "":
+		if m.metadata[change.Key] != change.OldValue {
+			return fmt.Errorf("metadata %q: %w", change.Key, ErrHistoryConflict)
+		}
+
+		m.putMetadata(change.Key, change.NewValue)
+
+		return nil
+	case change.Before == nil && change.After != nil:
+		return m.restoreEntry(*change.After)
+	case change.Before == nil:
+		return nil
+	}
+
+	node := m.getEntryByID(change.Before.Entry.ID)
+	if node == nil {
+		return fmt.Errorf("entry %d: %w", change.Before.Entry.ID, ErrHistoryConflict)
+	}
+
+	if current := m.entry2ExternalEntry(node.Value, false); modified(&change.Before.Entry, &current) {
+		return fmt.Errorf("entry %d changed: %w", change.Before.Entry.ID, ErrHistoryConflict)
+	}
+
+	if change.After == nil {
+		if change.Trash {
+			m.trashEntry(node)
+		} else {
+			m.deleteEntry(node)
+		}
+
+		return nil
+	}
+
+	after := change.After.Entry
+
+	if node.Value.ParentID != after.ParentID || m.nextID(node) != change.After.NextID {
+		if err := m.moveEntry(after.ID, after.ParentID, m.siblingOrEnd(after.ParentID, change.After.NextID)); err != nil {
+			return fmt.Errorf("%w: %v", ErrHistoryConflict, err) //nolint:errorlint
+		}
+
+		node = m.getEntryByID(after.ID)
+	}
+
+	node.Value.Name = after.Name
+	node.Value.Exec = after.Exec
+	node.Value.Params = cloneParams(after.Params)
+	node.Value.Tags = append([]string(nil), after.Tags...)
+	node.Value.Link = after.Link
+	node.Value.Smart = after.Smart.clone()
+	node.Value.UpdatedAt = after.UpdatedAt
+	m.recordPut(node)
+
+	return nil
+}
+
+// restoreEntry brings back the entry with its subtree and takes it out of the trash.
+func (m *Manager) restoreEntry(state EntryState) error {
+	var exists func(e Entry) bool
+
+	exists = func(e Entry) bool {
+		if m.getEntryByID(e.ID) != nil {
+			return true
+		}
+
+		for _, child := range e.Entries {
+			if exists(child) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if exists(state.Entry) {
+		return fmt.Errorf("entry %d exists: %w", state.Entry.ID, ErrHistoryConflict)
+	}
+
+	dir, err := m.getDir(state.Entry.ParentID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrHistoryConflict, err) //nolint:errorlint
+	}
+
+	next := m.getEntryByID(m.siblingOrEnd(state.Entry.ParentID, state.NextID))
+
+	node := dir.AddElement(m.entry2InternalEntry(state.Entry, m.EntryIDs), nil, next)
+	m.registerEntry(node)
+	m.recordPutTree(node)
+	m.untrash(state.Entry.ID)
+
+	if id := maxEntryID([]Entry{state.Entry}); id > m.maxID {
+		m.maxID = id
+	}
+
+	return nil
+}
+
+// siblingOrEnd returns nextID if it is in the parentID dir, 0 otherwise.
+func (m *Manager) siblingOrEnd(parentID, nextID int) int {
+	if next := m.getEntryByID(nextID); next != nil && next.Value.ParentID == parentID {
+		return nextID
+	}
+
+	return 0
+}
+
+// deleteEntry deletes a command or a dir with its subtree.
+func (m *Manager) deleteEntry(node *list.Node[entry]) {
+	if node.Value.IsDir {
+		m.deleteDir(node)
+
+		return
+	}
+
+	m.getDirByID(node.Value.ParentID).DeleteElement(node)
+	m.unregisterEntry(node.Value.ID)
+	m.recordDelete(node.Value.ID)
+}
+
+func (m *Manager) nextID(node *list.Node[entry]) int {
+	if node.Next == nil {
+		return 0
+	}
+
+	return node.Next.Value.ID
+}
+
+// state returns the state of the entry, with its subtree if withSubtree.
+func (m *Manager) state(node *list.Node[entry], withSubtree bool) *EntryState {
+	return &EntryState{Entry: m.entry2ExternalEntry(node.Value, withSubtree), NextID: m.nextID(node)}
+}
+
+// record publishes the events of the operation, adds it to the undo stack and clears the redo
+// stack. The changes made in a transaction are kept until it commits, only the indexes are
+// updated at once for the operations following them. mu must be held.
+func (m *Manager) record(op string, changes ...HistoryChange) {
+	if m.replaying {
+		return
+	}
+
+	if m.tx != nil {
+		m.updateIndex(changes)
+		m.tx.changes = append(m.tx.changes, changes...)
+
+		return
+	}
+
+	m.updateIndex(changes)
+	m.publish(changes)
+
+	if m.opts.historySize <= 0 {
+		return
+	}
+
+	m.undo = append(m.undo, HistoryStep{Op: op, Time: time.Now(), Changes: changes})
+	if len(m.undo) > m.opts.historySize {
+		m.undo = append([]HistoryStep(nil), m.undo[len(m.undo)-m.opts.historySize:]...)
+	}
+
+	m.redo = nil
+	m.historyChanged = true
+}
+
+// loadHistory restores the history saved by the store.
+func (m *Manager) loadHistory() {
+	store, ok := m.store.(HistoryStore)
+	if !ok || m.opts.historySize <= 0 {
+		return
+	}
+
+	history, err := store.LoadHistory()
+	if err != nil {
+		m.log.Warn("store.LoadHistory():", err)
+
+		return
+	}
+
+	if len(history.Undo) > m.opts.historySize {
+		history.Undo = history.Undo[len(history.Undo)-m.opts.historySize:]
+	}
+
+	m.mu.Lock()
+	m.undo, m.redo = history.Undo, history.Redo
+	m.mu.Unlock()
+}
+
+// saveHistory saves the history if it has changed since the last save. syncMu must be held.
+func (m *Manager) saveHistory() {
+	store, ok := m.store.(HistoryStore)
+	if !ok {
+		return
+	}
+
+	m.mu.Lock()
+	changed := m.historyChanged
+	history := m.history()
+	m.historyChanged = false
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if err := store.SaveHistory(history); err != nil {
+		m.log.Warn("store.SaveHistory():", err)
+
+		m.mu.Lock()
+		m.historyChanged = true
+		m.mu.Unlock()
+	}
+}
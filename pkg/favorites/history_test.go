@@ -0,0 +1,247 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestHistory(t *testing.T) {
+	newManager := func(t *testing.T, opts ...favorites2.OptOptionsSetter) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40, opts...))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	t.Run("every operation is undone and redone", func(t *testing.T) {
+		manager := newManager(t)
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		db, err := manager.AddDir("db", ops, 0)
+		require.NoError(t, err)
+		backup, err := manager.AddCommand("backup", "pg_dump {{db}}", db, 0)
+		require.NoError(t, err)
+		uptime, err := manager.AddCommand("uptime", "uptime", ops, db)
+		require.NoError(t, err)
+
+		states := [][]favorites2.Entry{exportTree(manager, 0)}
+		operations := []func() error{
+			func() error { return manager.ModifyExec(uptime, "uptime -p") },
+			func() error { return manager.RenameEntry(db, "postgres") },
+			func() error { return manager.MoveEntry(uptime, 0, 0) },
+			func() error {
+				return manager.SetParams(backup, []favorites2.Param{{Name: "db", Default: "main"}}) //nolint:exhaustruct
+			},
+			func() error { return manager.DeleteCommand(uptime) },
+			func() error { return manager.DeleteDir(ops) },
+		}
+
+		for _, operation := range operations {
+			require.NoError(t, operation())
+			states = append(states, exportTree(manager, 0))
+		}
+
+		require.Empty(t, exportTree(manager, 0))
+		require.Len(t, manager.History().Undo, len(operations)+4)
+
+		for i := len(states) - 2; i >= 0; i-- {
+			require.NoError(t, manager.Undo())
+			require.Equal(t, states[i], exportTree(manager, 0), "undo to state %d", i)
+			require.Empty(t, manager.CheckIntegrity())
+		}
+
+		for i := 1; i < len(states); i++ {
+			require.NoError(t, manager.Redo())
+			require.Equal(t, states[i], exportTree(manager, 0), "redo to state %d", i)
+		}
+
+		require.ErrorIs(t, manager.Redo(), favorites2.ErrNothingToRedo)
+	})
+
+	t.Run("deleted dir comes back in place", func(t *testing.T) {
+		manager := newManager(t, favorites2.WithGlobalIDs(true))
+
+		first, err := manager.AddDir("first", 0, 0)
+		require.NoError(t, err)
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddDir("last", 0, 0)
+		require.NoError(t, err)
+		db, err := manager.AddDir("db", ops, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("backup", "pg_dump", db, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("uptime", "uptime", ops, 0)
+		require.NoError(t, err)
+
+		want := exportTree(manager, 0)
+
+		require.NoError(t, manager.DeleteDir(ops))
+		require.NoError(t, manager.DeleteDir(first))
+		require.NoError(t, manager.Undo())
+		require.NoError(t, manager.Undo())
+		require.Equal(t, want, exportTree(manager, 0))
+
+		id, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		require.Greater(t, id, db)
+	})
+
+	t.Run("new operation clears redo", func(t *testing.T) {
+		manager := newManager(t)
+
+		_, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.Undo())
+		require.Len(t, manager.History().Redo, 1)
+
+		_, err = manager.AddCommand("y", "true", 0, 0)
+		require.NoError(t, err)
+		require.Empty(t, manager.History().Redo)
+		require.ErrorIs(t, manager.Redo(), favorites2.ErrNothingToRedo)
+		require.Equal(t, []string{"y"}, names(manager.ListDirectory(0)))
+	})
+
+	t.Run("history is bounded", func(t *testing.T) {
+		manager := newManager(t, favorites2.WithHistorySize(3))
+
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			_, err := manager.AddCommand(name, "true", 0, 0)
+			require.NoError(t, err)
+		}
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, manager.Undo())
+		}
+
+		require.ErrorIs(t, manager.Undo(), favorites2.ErrNothingToUndo)
+		require.Equal(t, []string{"a", "b"}, names(manager.ListDirectory(0)))
+
+		disabled := newManager(t, favorites2.WithHistorySize(0))
+		_, err := disabled.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		require.ErrorIs(t, disabled.Undo(), favorites2.ErrNothingToUndo)
+	})
+
+	t.Run("conflicting step leaves the tree as is", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		newFileManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			return manager
+		}
+
+		ours := newFileManager()
+		dir, err := ours.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		id, err := ours.AddCommand("x", "true", dir, 0)
+		require.NoError(t, err)
+		ours.SyncOut()
+
+		require.NoError(t, ours.MoveEntry(id, 0, 0))
+		ours.SyncOut()
+
+		theirs := newFileManager()
+		require.NoError(t, theirs.DeleteDir(dir))
+		theirs.SyncOut()
+		ours.SyncIn()
+
+		want := exportTree(ours, 0)
+		require.ErrorIs(t, ours.Undo(), favorites2.ErrHistoryConflict)
+		require.Equal(t, want, exportTree(ours, 0))
+		require.Len(t, ours.History().Undo, 3)
+	})
+
+	t.Run("edits merged from disk are not overwritten", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		newFileManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			return manager
+		}
+
+		ours := newFileManager()
+		id, err := ours.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		ours.SyncOut()
+
+		require.NoError(t, ours.RenameEntry(id, "y"))
+		ours.SyncOut()
+
+		theirs := newFileManager()
+		require.NoError(t, theirs.ModifyExec(id, "false"))
+		theirs.SyncOut()
+		ours.SyncIn()
+
+		want := exportTree(ours, 0)
+		require.Equal(t, "false", want[0].Exec)
+		require.ErrorIs(t, ours.Undo(), favorites2.ErrHistoryConflict)
+		require.Equal(t, want, exportTree(ours, 0))
+		require.Len(t, ours.History().Undo, 2)
+
+		ours.SetMetadata("owner", "ops")
+		ours.SyncOut()
+
+		theirs = newFileManager()
+		theirs.SetMetadata("owner", "dev")
+		theirs.SyncOut()
+		ours.SyncIn()
+
+		require.ErrorIs(t, ours.Undo(), favorites2.ErrHistoryConflict)
+		require.Equal(t, map[string]string{"owner": "dev"}, ours.Metadata())
+		require.Len(t, ours.History().Undo, 3)
+	})
+
+	t.Run("history survives restarts", func(t *testing.T) {
+		for _, name := range []string{"favorites.yaml", "favorites.json", "favorites.toml"} {
+			configPath := filepath.Join(t.TempDir(), name)
+			newFileManager := func() *favorites2.Manager {
+				manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+					favorites2.NewOptions(false, configPath, time.Minute, 40))
+				require.NoError(t, err)
+				manager.Close()
+
+				return manager
+			}
+
+			manager := newFileManager()
+			dir, err := manager.AddDir("ops", 0, 0)
+			require.NoError(t, err)
+			_, err = manager.AddCommand("x", "true", dir, 0)
+			require.NoError(t, err)
+			manager.SetMetadata("owner", "ops")
+			require.NoError(t, manager.DeleteDir(dir))
+			manager.SyncOut()
+
+			manager = newFileManager()
+			require.Empty(t, manager.ListDirectory(0), name)
+			require.NoError(t, manager.Undo(), name)
+			require.Equal(t, []string{"x"}, names(manager.ListDirectory(dir)), name)
+			manager.SyncOut()
+
+			manager = newFileManager()
+			require.Equal(t, []string{"x"}, names(manager.ListDirectory(dir)), name)
+			require.NoError(t, manager.Undo(), name)
+			require.Empty(t, manager.Metadata(), name)
+			require.Len(t, manager.History().Redo, 2, name)
+		}
+	})
+}
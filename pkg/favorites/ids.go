@@ -0,0 +1,97 @@
+package favorites
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	ulidLen        = 26
+	ulidRandomLen  = 10
+	ulidTimeLen    = 6
+	ulidBitsPerChr = 5
+	crockford      = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// newULID returns a lexicographically sortable unique identifier: 48 bits of milliseconds
+// followed by 80 random bits, encoded with Crockford's base32.
+func newULID() string {
+	var raw [ulidTimeLen + ulidRandomLen]byte
+
+	var ts [8]byte
+
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixMilli()))
+	copy(raw[:ulidTimeLen], ts[8-ulidTimeLen:])
+
+	if _, err := rand.Read(raw[ulidTimeLen:]); err != nil {
+		panic(fmt.Sprintf("crypto/rand: %v", err))
+	}
+
+	// 128 bits are encoded into 130, the two leading bits are zero.
+	result := make([]byte, ulidLen)
+	acc, bits, pos := uint32(0), 2, 0
+
+	for _, b := range raw {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+
+		for bits >= ulidBitsPerChr {
+			bits -= ulidBitsPerChr
+			result[pos] = crockford[(acc>>bits)&0x1f]
+			pos++
+		}
+	}
+
+	return string(result)
+}
+
+// maxEntryID returns the greatest ID in the tree.
+func maxEntryID(entries []Entry) int {
+	maxID := 0
+
+	for i := range entries {
+		if entries[i].ID > maxID {
+			maxID = entries[i].ID
+		}
+
+		if sub := maxEntryID(entries[i].Entries); sub > maxID {
+			maxID = sub
+		}
+	}
+
+	return maxID
+}
+
+// assignUIDs gives a ULID to every entry without one. Returns whether anything changed.
+func assignUIDs(entries []Entry) bool {
+	changed := false
+
+	for i := range entries {
+		if entries[i].UID == "" {
+			entries[i].UID = newULID()
+			changed = true
+		}
+
+		if assignUIDs(entries[i].Entries) {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// ResolveUID returns the local ID of the entry with the globally unique ID.
+func (m *Manager) ResolveUID(uid string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for id, node := range m.EntryIDs {
+		if node.Value.UID == uid {
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("uid %s: %w", uid, ErrNotFound)
+}
@@ -0,0 +1,123 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+const legacyConfig = `
+- id: 3
+  name: ops
+  isDir: true
+  entries:
+    - id: 7
+      name: backup
+      exec: pg_dump
+      parentId: 3
+- id: 5
+  name: deploy
+  exec: make deploy
+`
+
+func TestIDAllocation(t *testing.T) {
+	newManager := func(configPath string, opts ...favorites2.OptOptionsSetter) *favorites2.Manager {
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40, opts...))
+		require.NoError(t, err)
+		manager.Close()
+
+		return manager
+	}
+
+	t.Run("high-water mark survives reloads", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		manager := newManager(configPath)
+
+		first, err := manager.AddCommand("first", "true", 0, 0)
+		require.NoError(t, err)
+		second, err := manager.AddCommand("second", "true", 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.DeleteCommand(second))
+		manager.SyncOut()
+
+		manager = newManager(configPath)
+		third, err := manager.AddCommand("third", "true", 0, 0)
+		require.NoError(t, err)
+		require.Greater(t, third, second)
+
+		manager.SyncIn()
+		fourth, err := manager.AddCommand("fourth", "true", 0, 0)
+		require.NoError(t, err)
+		require.Greater(t, fourth, third)
+
+		entry, err := manager.GetEntry(first)
+		require.NoError(t, err)
+		require.Equal(t, "first", entry.Name)
+	})
+
+	t.Run("legacy file", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte(legacyConfig), 0o600))
+
+		manager := newManager(configPath)
+		id, err := manager.AddDir("new", 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, 8, id)
+		require.Len(t, manager.EntryIDs, 4)
+		require.Empty(t, manager.ListDirectory(0)[0].UID)
+	})
+
+	t.Run("global IDs for legacy file", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte(legacyConfig), 0o600))
+
+		manager := newManager(configPath, favorites2.WithGlobalIDs(true))
+		uids := make(map[string]bool)
+
+		for _, id := range []int{3, 5, 7} {
+			entry, err := manager.GetEntry(id)
+			require.NoError(t, err)
+			require.Len(t, entry.UID, 26)
+			require.False(t, uids[entry.UID])
+			uids[entry.UID] = true
+
+			resolved, err := manager.ResolveUID(entry.UID)
+			require.NoError(t, err)
+			require.Equal(t, id, resolved)
+		}
+
+		id, err := manager.AddCommand("new", "true", 3, 0)
+		require.NoError(t, err)
+		entry, err := manager.GetEntry(id)
+		require.NoError(t, err)
+		require.Len(t, entry.UID, 26)
+		require.False(t, uids[entry.UID])
+
+		_, err = manager.ResolveUID("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+		require.ErrorIs(t, err, favorites2.ErrNotFound)
+
+		raw, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+
+		var doc struct {
+			NextID  int                `yaml:"nextId"`
+			Entries []favorites2.Entry `yaml:"entries"`
+		}
+
+		require.NoError(t, yaml.Unmarshal(raw, &doc))
+		require.Equal(t, 8, doc.NextID)
+		require.Len(t, doc.Entries, 2)
+		require.True(t, uids[doc.Entries[0].UID])
+		require.True(t, uids[doc.Entries[0].Entries[0].UID])
+	})
+}
@@ -0,0 +1,270 @@
+package favorites
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/list"
+)
+
+// IntegrityIssue describes a structural problem of the tree found by CheckIntegrity.
+type IntegrityIssue struct {
+	ID      int
+	Problem string
+}
+
+func (i IntegrityIssue) String() string {
+	return fmt.Sprintf("entry %d: %s", i.ID, i.Problem)
+}
+
+// CheckIntegrity walks the tree and reports broken links, duplicate IDs and UIDs, wrong ParentIDs,
+// commands and smart dirs with children, dirs linking to commands, entries detached from the tree
+// and mismatches with EntryIDs. Dangling links are not issues, see DanglingLinks.
+func (m *Manager) CheckIntegrity() []IntegrityIssue {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	walker := m.newIntegrityWalker()
+	walker.walk()
+
+	return walker.issues
+}
+
+// RepairIntegrity rebuilds the tree fixing the issues CheckIntegrity reports:
+// duplicate IDs are replaced with new ones, children of commands and smart dirs are moved next to them,
+// links of dirs are dropped, detached entries are appended to the root. Returns the issues that have been fixed.
+func (m *Manager) RepairIntegrity() []IntegrityIssue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	issues := m.repairIntegrity()
+	if len(issues) > 0 {
+		m.notifySinker()
+	}
+
+	return issues
+}
+
+func (m *Manager) repairIntegrity() []IntegrityIssue {
+	walker := m.newIntegrityWalker()
+	entries := walker.walk()
+
+	if len(walker.issues) > 0 {
+		m.root, m.EntryIDs = m.buildTree(entries)
+		m.reindex()
+		m.maxID = walker.maxID
+		m.pending, m.fullSave = nil, true
+	}
+
+	return walker.issues
+}
+
+// checkOnLoad reports issues of a freshly loaded tree and repairs them if configured to.
+func (m *Manager) checkOnLoad() {
+	var issues []IntegrityIssue
+
+	m.mu.Lock()
+	if m.opts.repairOnLoad {
+		issues = m.repairIntegrity()
+	} else {
+		walker := m.newIntegrityWalker()
+		walker.walk()
+		issues = walker.issues
+	}
+	m.mu.Unlock()
+
+	for _, issue := range issues {
+		m.log.Warn("integrity: ", issue.String())
+	}
+
+	if m.opts.repairOnLoad && len(issues) > 0 {
+		m.notifySinker()
+	}
+}
+
+type integrityWalker struct {
+	m       *Manager
+	issues  []IntegrityIssue
+	visited map[*list.Node[entry]]bool
+	ids     map[int]bool
+	uids    map[string]bool
+	maxID   int
+}
+
+func (m *Manager) newIntegrityWalker() *integrityWalker {
+	walker := &integrityWalker{
+		m:       m,
+		issues:  nil,
+		visited: make(map[*list.Node[entry]]bool),
+		ids:     make(map[int]bool),
+		uids:    make(map[string]bool),
+		maxID:   m.maxID,
+	}
+
+	seen := make(map[*list.Node[entry]]bool)
+	walker.scanMaxID(m.root, seen)
+
+	for id, node := range m.EntryIDs {
+		if id > walker.maxID {
+			walker.maxID = id
+		}
+
+		walker.scanMaxID(node.Value.Entries, seen)
+	}
+
+	return walker
+}
+
+func (w *integrityWalker) scanMaxID(dir *list.DeLinkedList[entry], seen map[*list.Node[entry]]bool) {
+	if dir == nil {
+		return
+	}
+
+	for node := dir.Head; node != nil && !seen[node]; node = node.Next {
+		seen[node] = true
+
+		if node.Value.ID > w.maxID {
+			w.maxID = node.Value.ID
+		}
+
+		w.scanMaxID(node.Value.Entries, seen)
+	}
+}
+
+func (w *integrityWalker) report(id int, format string, args ...any) {
+	w.issues = append(w.issues, IntegrityIssue{ID: id, Problem: fmt.Sprintf(format, args...)})
+}
+
+// walk returns the repaired tree in external representation.
+func (w *integrityWalker) walk() []Entry {
+	entries := w.walkDir(w.m.root, 0)
+
+	orphans := make([]int, 0)
+
+	for id, node := range w.m.EntryIDs {
+		if !w.visited[node] {
+			orphans = append(orphans, id)
+		}
+	}
+
+	sort.Ints(orphans)
+
+	for _, id := range orphans {
+		node := w.m.EntryIDs[id]
+		if w.visited[node] {
+			continue
+		}
+
+		w.report(id, "detached from the tree")
+		entries = append(entries, w.walkNode(node, 0)...)
+	}
+
+	return entries
+}
+
+func (w *integrityWalker) walkDir(dir *list.DeLinkedList[entry], parentID int) []Entry {
+	if dir == nil {
+		return nil
+	}
+
+	var (
+		entries []Entry
+		prev    *list.Node[entry]
+		count   int
+	)
+
+	for node := dir.Head; node != nil; node = node.Next {
+		if w.visited[node] {
+			w.report(node.Value.ID, "linked more than once")
+
+			break
+		}
+
+		if node.Prev != prev {
+			w.report(node.Value.ID, "broken link to the previous entry")
+		}
+
+		entries = append(entries, w.walkNode(node, parentID)...)
+		prev = node
+		count++
+	}
+
+	if dir.Tail != prev {
+		w.report(parentID, "broken link to the last entry")
+	}
+
+	if dir.Len() != count {
+		w.report(parentID, "directory length %d, but %d entries linked", dir.Len(), count)
+	}
+
+	return entries
+}
+
+// walkNode returns the entry and, if it is a command or a smart dir with children, the children
+// as its siblings.
+func (w *integrityWalker) walkNode(node *list.Node[entry], parentID int) []Entry {
+	w.visited[node] = true
+	value := node.Value
+	id := value.ID
+
+	if registered, ok := w.m.EntryIDs[id]; !ok || registered != node {
+		w.report(id, "not registered in EntryIDs")
+	}
+
+	if id <= 0 || w.ids[id] {
+		w.maxID++
+		w.report(id, "duplicate or invalid ID, replaced with %d", w.maxID)
+		id = w.maxID
+	}
+
+	w.ids[id] = true
+
+	uid := value.UID
+	if uid != "" && w.uids[uid] {
+		uid = newULID()
+		w.report(id, "duplicate UID %s, replaced with %s", value.UID, uid)
+	}
+
+	w.uids[uid] = true
+
+	if value.ParentID != parentID {
+		w.report(id, "parent ID %d, but linked in %d", value.ParentID, parentID)
+	}
+
+	result := w.m.entry2ExternalEntry(value, false)
+	result.ID, result.UID, result.ParentID = id, uid, parentID
+
+	if value.Smart != nil && !value.IsDir {
+		w.report(id, "command has a smart query, dropped")
+		result.Smart = nil
+	}
+
+	if value.Link != 0 && value.IsDir {
+		w.report(id, "directory links to %d, dropped", value.Link)
+		result.Link = 0
+	}
+
+	if value.IsDir && value.Smart == nil {
+		result.Entries = w.walkDir(value.Entries, id)
+
+		return []Entry{result}
+	}
+
+	children := w.walkDir(value.Entries, id)
+	if len(children) == 0 {
+		return []Entry{result}
+	}
+
+	kind := "command"
+	if value.IsDir {
+		kind = "smart directory"
+	}
+
+	w.report(id, "%s has %d children, moved to its parent", kind, len(children))
+
+	for i := range children {
+		children[i].ParentID = parentID
+	}
+
+	return append([]Entry{result}, children...)
+}
@@ -0,0 +1,139 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+const corruptedConfig = `
+- id: 1
+  name: ops
+  isDir: true
+  entries:
+    - id: 2
+      name: backup
+      exec: pg_dump
+      parentId: 7
+      entries:
+        - id: 3
+          name: nested
+          exec: "true"
+          parentId: 2
+    - id: 2
+      name: restore
+      exec: pg_restore
+      parentId: 1
+- id: 4
+  name: deploy
+  exec: make deploy
+`
+
+func TestStructuralValidation(t *testing.T) {
+	manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+		favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+	require.NoError(t, err)
+
+	ops, err := manager.AddDir("ops", 0, 0)
+	require.NoError(t, err)
+	db, err := manager.AddDir("db", ops, 0)
+	require.NoError(t, err)
+	backup, err := manager.AddCommand("backup", "pg_dump", db, 0)
+	require.NoError(t, err)
+	deploy, err := manager.AddCommand("deploy", "make deploy", 0, 0)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, manager.MoveEntry(ops, db, 0), favorites2.ErrCycle)
+	require.ErrorIs(t, manager.MoveEntry(ops, ops, 0), favorites2.ErrCycle)
+	require.ErrorIs(t, manager.MoveEntry(deploy, backup, 0), favorites2.ErrNotADirectory)
+	require.ErrorIs(t, manager.MoveEntry(deploy, ops, backup), favorites2.ErrNotASibling)
+	_, err = manager.AddCommand("restore", "pg_restore", ops, backup)
+	require.ErrorIs(t, err, favorites2.ErrNotASibling)
+	_, err = manager.AddDir("logs", backup, 0)
+	require.ErrorIs(t, err, favorites2.ErrNotADirectory)
+
+	require.NoError(t, manager.MoveEntry(backup, db, backup))
+	require.NoError(t, manager.MoveEntry(backup, db, 0))
+	require.NoError(t, manager.MoveEntry(db, 0, ops))
+	require.NoError(t, manager.MoveEntry(ops, db, 0))
+	require.Empty(t, manager.CheckIntegrity())
+
+	list := manager.ListDirectory(0)
+	require.Len(t, list, 2)
+	require.Equal(t, "db", list[0].Name)
+	require.Equal(t, "deploy", list[1].Name)
+}
+
+func TestIntegrity(t *testing.T) {
+	newManager := func(repair bool) *favorites2.Manager {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte(corruptedConfig), 0o600))
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40, favorites2.WithRepairOnLoad(repair)))
+		require.NoError(t, err)
+		manager.Close()
+
+		return manager
+	}
+
+	t.Run("check", func(t *testing.T) {
+		manager := newManager(false)
+		issues := manager.CheckIntegrity()
+		require.NotEmpty(t, issues)
+		require.Len(t, manager.RepairIntegrity(), len(issues))
+		require.Empty(t, manager.CheckIntegrity())
+	})
+
+	t.Run("repair on load", func(t *testing.T) {
+		manager := newManager(true)
+		require.Empty(t, manager.CheckIntegrity())
+
+		list := manager.ListDirectory(0)
+		require.Len(t, list, 2)
+
+		ops := manager.ListDirectory(list[0].ID)
+		require.Len(t, ops, 3)
+		require.Equal(t, []string{"backup", "nested", "restore"}, []string{ops[0].Name, ops[1].Name, ops[2].Name})
+		require.NotEqual(t, ops[0].ID, ops[2].ID)
+
+		for _, elem := range ops {
+			require.Equal(t, list[0].ID, elem.ParentID)
+		}
+
+		id, err := manager.AddCommand("new", "true", 0, 0)
+		require.NoError(t, err)
+		require.Len(t, manager.EntryIDs, 6)
+		require.Empty(t, manager.CheckIntegrity(), id)
+	})
+
+	t.Run("registry mismatch", func(t *testing.T) {
+		manager := newManager(true)
+		other := newManager(true)
+		ops := manager.ListDirectory(0)[0]
+		deploy := other.ListDirectory(0)[1]
+
+		delete(manager.EntryIDs, ops.ID)
+		manager.EntryIDs[100] = other.EntryIDs[deploy.ID]
+
+		issues := manager.CheckIntegrity()
+		require.Len(t, issues, 4)
+
+		manager.RepairIntegrity()
+		require.Empty(t, manager.CheckIntegrity())
+
+		list := manager.ListDirectory(0)
+		require.Len(t, list, 3)
+		require.Equal(t, ops.ID, list[0].ID)
+		require.Equal(t, deploy.Name, list[2].Name)
+		require.NotEqual(t, list[1].ID, list[2].ID)
+	})
+}
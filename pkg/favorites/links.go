@@ -0,0 +1,205 @@
+package favorites
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/list"
+)
+
+// LinkPolicy defines what happens to the links to a command when the command is deleted.
+type LinkPolicy int
+
+const (
+	// LinkKeep keeps the links. They dangle until the command is restored from the trash,
+	// see DanglingLinks.
+	LinkKeep LinkPolicy = iota
+	// LinkCascade deletes the links with the command, as a single operation in the history.
+	LinkCascade
+)
+
+// AddLink adds a link to the targetID command to the parentID dir before the nextID entry, or to
+// the end if nextID is 0. A link is listed and run with the exec and params of its target, so the
+// command appears in several dirs and edits of it apply everywhere. A link has a name of its own,
+// the name of the target if name is empty. A link to a link points at the target of that one.
+// Returns ID of the new link.
+func (m *Manager) AddLink(name string, targetID int, parentID int, nextID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addLink(name, targetID, parentID, nextID)
+}
+
+func (m *Manager) addLink(name string, targetID int, parentID int, nextID int) (int, error) {
+	target, err := m.getLinkedCommand(targetID)
+	if err != nil {
+		return 0, err
+	}
+
+	dir, next, err := m.getPlacement(parentID, nextID)
+	if err != nil {
+		return 0, err
+	}
+
+	defer m.notifySinker()
+
+	if name == "" {
+		name = target.Value.Name
+	}
+
+	e := m.newEntry(name, "", false, parentID)
+	e.Link = target.Value.ID
+	node := dir.AddElement(e, nil, next)
+	m.registerEntry(node)
+	m.recordPut(node)
+	m.record(OpAddLink, HistoryChange{After: m.state(node, false)}) //nolint:exhaustruct
+
+	return node.Value.ID, nil
+}
+
+// Links returns the links to the command, sorted by path.
+func (m *Manager) Links(id int) []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.indexedEntries(func(linkID int, _ *indexedEntry) bool {
+		node := m.getEntryByID(linkID)
+
+		return node != nil && node.Value.Link == id
+	})
+}
+
+// DanglingLinks returns the links whose target has been deleted, sorted by path.
+func (m *Manager) DanglingLinks() []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.indexedEntries(func(id int, _ *indexedEntry) bool {
+		node := m.getEntryByID(id)
+
+		return node != nil && node.Value.Link != 0 && m.linkTarget(node.Value.Link) == nil
+	})
+}
+
+// getLinkedCommand is getCommand which resolves a link to its target.
+func (m *Manager) getLinkedCommand(id int) (*list.Node[entry], error) {
+	if _, err := m.getCommand(id); err != nil {
+		return nil, err
+	}
+
+	return m.followLink(id)
+}
+
+// followLink returns the entry, the target if it is a link.
+func (m *Manager) followLink(id int) (*list.Node[entry], error) {
+	node := m.getEntryByID(id)
+	if node == nil {
+		return nil, fmt.Errorf("entry %d: %w", id, ErrNotFound)
+	}
+
+	if node.Value.Link == 0 {
+		return node, nil
+	}
+
+	target := m.linkTarget(node.Value.Link)
+	if target == nil {
+		return nil, fmt.Errorf("entry %d to %d: %w", id, node.Value.Link, ErrDanglingLink)
+	}
+
+	return target, nil
+}
+
+// linkTarget returns the command a link to id points at, nil if there is none.
+func (m *Manager) linkTarget(id int) *list.Node[entry] {
+	target := m.getEntryByID(id)
+	if target == nil || target.Value.IsDir || target.Value.Link != 0 {
+		return nil
+	}
+
+	return target
+}
+
+// resolveLink fills the exec and params of a link from the target. Other entries and dangling
+// links are returned as they are. mu must be held.
+func (m *Manager) resolveLink(e Entry) Entry {
+	if e.Link == 0 || e.IsDir {
+		return e
+	}
+
+	target := m.linkTarget(e.Link)
+	if target == nil {
+		return e
+	}
+
+	e.Exec, e.Params = target.Value.Exec, cloneParams(target.Value.Params)
+
+	return e
+}
+
+// linkedExec returns the exec of the entry, the one of the target for a link which is not
+// dangling. mu must be held.
+func (m *Manager) linkedExec(e entry) string {
+	if e.Link == 0 {
+		return e.Exec
+	}
+
+	if target := m.linkTarget(e.Link); target != nil {
+		return target.Value.Exec
+	}
+
+	return e.Exec
+}
+
+// linksInto returns the links to the commands of the subtree of the node from outside of it,
+// sorted by ID.
+func (m *Manager) linksInto(node *list.Node[entry]) []*list.Node[entry] {
+	subtree := make(map[int]bool)
+
+	var walk func(node *list.Node[entry])
+
+	walk = func(node *list.Node[entry]) {
+		subtree[node.Value.ID] = true
+
+		for elem := node.Value.Entries.Head; elem != nil; elem = elem.Next {
+			walk(elem)
+		}
+	}
+
+	walk(node)
+
+	var links []*list.Node[entry]
+
+	for id, link := range m.EntryIDs {
+		if link.Value.Link != 0 && subtree[link.Value.Link] && !subtree[id] {
+			links = append(links, link)
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Value.ID < links[j].Value.ID })
+
+	return links
+}
+
+// trashWithLinks moves the entry to the trash as the op and, with LinkCascade, the links into it
+// too. mu must be held.
+func (m *Manager) trashWithLinks(op string, node *list.Node[entry]) {
+	var links []*list.Node[entry]
+	if m.opts.linkPolicy == LinkCascade {
+		links = m.linksInto(node)
+	}
+
+	changes := make([]HistoryChange, 0, len(links)+1)
+	changes = append(changes, HistoryChange{Before: m.state(node, node.Value.IsDir), Trash: true}) //nolint:exhaustruct
+
+	for _, link := range links {
+		changes = append(changes, HistoryChange{Before: m.state(link, false), Trash: true}) //nolint:exhaustruct
+	}
+
+	m.trashEntry(node)
+
+	for _, link := range links {
+		m.trashEntry(link)
+	}
+
+	m.record(op, changes...)
+}
@@ -0,0 +1,180 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestLinks(t *testing.T) {
+	newManager := func(t *testing.T, opts ...favorites2.OptOptionsSetter) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40, opts...))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	// newTree creates /ops/deploy and an empty /favs dir.
+	newTree := func(t *testing.T, manager *favorites2.Manager) (int, int, int) {
+		t.Helper()
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		deploy, err := manager.AddCommand("deploy", "make deploy", ops, 0)
+		require.NoError(t, err)
+		favs, err := manager.AddDir("favs", 0, 0)
+		require.NoError(t, err)
+
+		return ops, deploy, favs
+	}
+
+	t.Run("links are resolved to their target", func(t *testing.T) {
+		manager := newManager(t)
+		_, deploy, favs := newTree(t, manager)
+
+		link, err := manager.AddLink("", deploy, favs, 0)
+		require.NoError(t, err)
+
+		entries := manager.ListDirectory(favs)
+		require.Len(t, entries, 1)
+		require.Equal(t, link, entries[0].ID)
+		require.Equal(t, deploy, entries[0].Link)
+		require.Equal(t, "deploy", entries[0].Name)
+		require.Equal(t, "make deploy", entries[0].Exec)
+		require.Equal(t, "make deploy", manager.DisplayEntry(&favorites2.Entry{ID: link, Link: deploy})) //nolint:exhaustruct
+
+		// The link keeps its name when the target is renamed.
+		require.NoError(t, manager.RenameEntry(deploy, "ship"))
+		e, err := manager.GetEntry(link)
+		require.NoError(t, err)
+		require.Equal(t, "deploy", e.Name)
+
+		// Edits through the link apply to the target.
+		require.NoError(t, manager.ModifyExec(link, "make release"))
+		e, err = manager.GetEntry(deploy)
+		require.NoError(t, err)
+		require.Equal(t, "make release", e.Exec)
+		e, err = manager.GetEntry(link)
+		require.NoError(t, err)
+		require.Equal(t, "make release", e.Exec)
+
+		rendered, err := manager.Render(link, nil)
+		require.NoError(t, err)
+		require.Equal(t, "make release", rendered)
+
+		// A named link keeps its name, a link to a link points at its target.
+		named, err := manager.AddLink("release", link, 0, 0)
+		require.NoError(t, err)
+		e, err = manager.GetEntry(named)
+		require.NoError(t, err)
+		require.Equal(t, "release", e.Name)
+		require.Equal(t, deploy, e.Link)
+		require.Equal(t, []int{link, named}, ids(manager.Links(deploy)))
+
+		_, err = manager.AddLink("", favs, 0, 0)
+		require.ErrorIs(t, err, favorites2.ErrNotACommand)
+		_, err = manager.AddLink("", 100, 0, 0)
+		require.ErrorIs(t, err, favorites2.ErrNotFound)
+
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []int{link}, ids(manager.Links(deploy)))
+	})
+
+	t.Run("links of a deleted target dangle", func(t *testing.T) {
+		manager := newManager(t)
+		_, deploy, favs := newTree(t, manager)
+
+		link, err := manager.AddLink("", deploy, favs, 0)
+		require.NoError(t, err)
+		require.Empty(t, manager.DanglingLinks())
+
+		require.NoError(t, manager.DeleteCommand(deploy))
+		require.Equal(t, []int{link}, ids(manager.DanglingLinks()))
+		require.Empty(t, manager.ListDirectory(favs)[0].Exec)
+		require.ErrorIs(t, manager.ModifyExec(link, "true"), favorites2.ErrDanglingLink)
+		_, err = manager.Run(context.Background(), link)
+		require.ErrorIs(t, err, favorites2.ErrDanglingLink)
+
+		require.NoError(t, manager.Restore(deploy))
+		require.Empty(t, manager.DanglingLinks())
+		require.Equal(t, "make deploy", manager.ListDirectory(favs)[0].Exec)
+
+		// Deleting a link leaves its target alone.
+		require.NoError(t, manager.DeleteCommand(link))
+		_, err = manager.GetEntry(deploy)
+		require.NoError(t, err)
+	})
+
+	t.Run("links are deleted with their target on cascade", func(t *testing.T) {
+		manager := newManager(t, favorites2.WithLinkPolicy(favorites2.LinkCascade))
+		ops, deploy, favs := newTree(t, manager)
+
+		link, err := manager.AddLink("", deploy, favs, 0)
+		require.NoError(t, err)
+		inside, err := manager.AddLink("again", deploy, ops, 0)
+		require.NoError(t, err)
+
+		require.NoError(t, manager.DeleteDir(ops))
+		require.Empty(t, manager.ListDirectory(favs))
+		require.Len(t, manager.ListTrash(), 2)
+
+		history := manager.History().Undo
+		require.Equal(t, favorites2.OpDeleteDir, history[len(history)-1].Op)
+		require.Len(t, history[len(history)-1].Changes, 2)
+
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []int{link}, ids(manager.ListDirectory(favs)))
+		require.Equal(t, []int{deploy, inside}, ids(manager.ListDirectory(ops)))
+		require.Empty(t, manager.ListTrash())
+		require.Empty(t, manager.CheckIntegrity())
+	})
+
+	t.Run("links follow a renumbered target", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		newFileManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			return manager
+		}
+
+		ours, theirs := newFileManager(), newFileManager()
+
+		_, err := theirs.AddCommand("theirs", "true", 0, 0)
+		require.NoError(t, err)
+		theirs.SyncOut()
+
+		x, err := ours.AddCommand("ours", "make ours", 0, 0)
+		require.NoError(t, err)
+		link, err := ours.AddLink("", x, 0, 0)
+		require.NoError(t, err)
+		ours.SyncOut()
+
+		e, err := newFileManager().GetEntry(link)
+		require.NoError(t, err)
+		require.NotEqual(t, x, e.Link)
+		require.Equal(t, "ours", e.Name)
+		require.Equal(t, "make ours", e.Exec)
+	})
+}
+
+func ids(entries []favorites2.Entry) []int {
+	result := make([]int, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e.ID)
+	}
+
+	return result
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package favorites
+
+// lockConfig is a no-op where advisory locks are not supported: concurrent writers may lose changes.
+func lockConfig(_ string) (func(), error) {
+	return func() {}, nil
+}
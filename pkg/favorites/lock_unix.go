@@ -0,0 +1,29 @@
+//go:build unix
+
+package favorites
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockConfig takes an exclusive advisory lock shared by all processes writing the config file,
+// so that a merge and the following write are never interleaved with another writer.
+func lockConfig(configPath string) (func(), error) {
+	file, err := os.OpenFile(configPath+".lock", os.O_CREATE|os.O_RDWR, configFilePerm)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(lock): %w", err)
+	}
+
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		_ = file.Close()
+
+		return nil, fmt.Errorf("syscall.Flock(lock): %w", err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		_ = file.Close()
+	}, nil
+}
@@ -4,15 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"gopkg.in/yaml.v3"
-
 	"github.com/gerladeno/favorites-mechanics/pkg/list"
 )
 
+// maxSyncAttempts limits merging again when the stored tree changes while it is being saved.
+const maxSyncAttempts = 3
+
 type logger interface {
 	Info(args ...any)
 	Warn(args ...any)
@@ -25,23 +26,89 @@ type Options struct {
 	configPath       string        `option:"mandatory" validate:"required"`
 	syncConfigPeriod time.Duration `option:"mandatory" validate:"required"`
 	maxDisplayLen    int           `option:"mandatory" validate:"required"`
+	shell            string        `default:"/bin/sh" validate:"required"`
+	shellFlag        string        `default:"-c"`
+	workDir          string
+	env              []string
+	runTimeout       time.Duration
+	duplicatePolicy  DuplicatePolicy
+	repairOnLoad     bool
+	globalIDs        bool
+	backups          int `default:"3"`
+	mergePolicy      MergePolicy
+	disableWatch     bool
+	watchDebounce    time.Duration `default:"100ms"`
+	store            Store
+	format           Format
+	historySize      int           `default:"100"`
+	trashRetention   time.Duration `default:"720h"`
+	linkPolicy       LinkPolicy
+	rawParams        bool
 }
 
+// Manager keeps the tree in the Store set with WithStore, by default a MemoryStore if inMemory
+// and a FileStore of configPath in the format set with WithFormat otherwise. Manager methods are safe for concurrent use.
+// EntryIDs is guarded by the Manager's lock and must not be accessed directly while
+// other goroutines use the Manager.
 type Manager struct {
 	log              logger
 	opts             Options
 	root             *list.DeLinkedList[entry]
 	mu               sync.RWMutex
+	syncMu           sync.Mutex
 	syncNotification chan struct{}
+	stopSyncer       context.CancelFunc
+	syncerDone       chan struct{}
 	EntryIDs         map[int]*list.Node[entry]
 	maxID            int
+	conflicts        []Conflict
+	store            Store
+	incremental      IncrementalStore
+	// pending are the changes not applied to the incremental store yet. fullSave means the tree
+	// has been changed in a way not recorded by pending, and must be saved as a whole.
+	// Both are guarded by mu.
+	pending  []Change
+	fullSave bool
+	metadata map[string]string
+	trash    []TrashItem
+	// undo and redo are the history, replaying suppresses recording while it is applied.
+	// They are guarded by mu.
+	undo           []HistoryStep
+	redo           []HistoryStep
+	replaying      bool
+	historyChanged bool
+	// tx is the running transaction, guarded by mu. batching defers notifications while it runs,
+	// batchNotified tells whether there have been any.
+	tx            *Tx
+	batching      atomic.Bool
+	batchNotified atomic.Bool
+	// subscribers are guarded by subMu, which is taken under mu or alone, so Subscribe and
+	// Subscription.Close do not wait for the Manager.
+	subMu       sync.Mutex
+	subscribers map[*Subscription]struct{}
+	// index is the search index by entry ID, tagIndex is the IDs of the entries by tag.
+	// Both are guarded by mu.
+	index    map[int]*indexedEntry
+	tagIndex map[string]map[int]struct{}
+	// usage is the usage statistics by entry ID, uses are the uses not saved yet. Both are
+	// guarded by mu, usageNotification asks the syncer to save the uses.
+	usage             map[int]Usage
+	uses              map[int]Usage
+	usageNotification chan struct{}
+	// base is the document last loaded or saved, the common ancestor for merging. It is guarded by syncMu.
+	base Document
 }
 
 // entry is an internal type for management.
 type entry struct {
 	ID        int
+	UID       string
 	Name      string
 	Exec      string
+	Params    []Param
+	Tags      []string
+	Link      int
+	Smart     *SmartQuery
 	ParentID  int
 	Entries   *list.DeLinkedList[entry]
 	IsDir     bool
@@ -59,108 +126,446 @@ func NewManager(ctx context.Context, log logger, opts Options) (*Manager, error)
 		opts:             opts,
 		root:             new(list.DeLinkedList[entry]),
 		syncNotification: make(chan struct{}),
+		stopSyncer:       func() {},
+		syncerDone:       make(chan struct{}),
 		EntryIDs:         make(map[int]*list.Node[entry]),
 		maxID:            0,
+		index:            make(map[int]*indexedEntry),
+		tagIndex:         make(map[string]map[int]struct{}),
+		store:            opts.store,
+	}
+
+	switch {
+	case manager.store != nil:
+	case opts.inMemory:
+		manager.store = NewMemoryStore()
+	default:
+		manager.store = NewFileStore(log, opts.configPath, opts.backups, opts.format)
 	}
 
-	if !opts.inMemory {
-		manager.syncNotification = make(chan struct{}, 1)
+	manager.incremental, _ = manager.store.(IncrementalStore)
+
+	if opts.inMemory {
+		defer close(manager.syncerDone)
 
-		if err := manager.readConfig(); err != nil {
-			return nil, fmt.Errorf("readConfig(): %w", err)
+		if err := manager.load(); err != nil {
+			return nil, fmt.Errorf("load(): %w", err)
 		}
 
-		go manager.runSyncer(ctx)
+		manager.loadHistory()
+		manager.loadUsage()
+
+		return &manager, nil
+	}
+
+	manager.syncNotification = make(chan struct{}, 1)
+	manager.usageNotification = make(chan struct{}, 1)
+
+	// The watcher is set up first, so changes made while the tree is being loaded are not missed.
+	changes, stopWatching := manager.watch()
+
+	if err := manager.load(); err != nil {
+		stopWatching()
+
+		return nil, fmt.Errorf("load(): %w", err)
 	}
 
+	manager.loadHistory()
+	manager.loadUsage()
+
+	ctx, manager.stopSyncer = context.WithCancel(ctx)
+
+	go manager.runSyncer(ctx, changes, stopWatching)
+
 	return &manager, nil
 }
 
-func (m *Manager) readConfig() error {
-	file, err := os.Open(m.opts.configPath)
+// watch returns a nil channel if the store is not watchable, the caller falls back to polling.
+func (m *Manager) watch() (<-chan struct{}, func()) {
+	store, ok := m.store.(WatchableStore)
+	if !ok || m.opts.disableWatch {
+		return nil, func() {}
+	}
+
+	changes, stop, err := store.Watch()
+	if err != nil {
+		m.log.Warn("store.Watch(), falling back to polling:", err)
+
+		return nil, func() {}
+	}
+
+	return changes, stop
+}
+
+// load replaces the tree with the stored one.
+func (m *Manager) load() error {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	doc, err := m.store.Load()
 	if err != nil {
-		pathErr := &os.PathError{} //nolint:exhaustruct
-		if errors.As(err, &pathErr) && errors.Is(err, os.ErrNotExist) {
+		if errors.Is(err, ErrNotModified) {
 			return nil
 		}
 
-		return fmt.Errorf("os.Open(m.opts.configPath): %w", err)
+		return err //nolint:wrapcheck
 	}
 
-	defer func() {
-		if err = file.Close(); err != nil {
-			m.log.Warn("file.Close():", err)
-		}
-	}()
+	migrated := m.opts.globalIDs && assignUIDs(doc.Entries)
 
-	var entries []Entry
+	m.setRoot(doc)
+	m.base = doc
+	m.checkOnLoad()
+	m.publishReload()
 
-	if err = yaml.NewDecoder(file).Decode(&entries); err != nil {
-		return fmt.Errorf("yaml.NewDecoder(file).Decode(&bytes): %w", err)
-	}
+	if migrated {
+		m.mu.Lock()
+		m.fullSave = true
+		m.mu.Unlock()
 
-	m.setRoot(entries)
+		m.notifySinker()
+	}
 
 	return nil
 }
 
-func (m *Manager) runSyncer(ctx context.Context) {
-	ticker := time.NewTicker(m.opts.syncConfigPeriod)
-	defer ticker.Stop()
+// Close stops the background syncer and writes out changes it has not synced yet.
+func (m *Manager) Close() {
+	m.stopSyncer()
+	<-m.syncerDone
+}
+
+// runSyncer saves the tree when notified and merges the stored tree when it changes.
+// Bursts of store events are debounced. Without a watcher, the store is polled every syncConfigPeriod.
+func (m *Manager) runSyncer(ctx context.Context, changes <-chan struct{}, stopWatching func()) {
+	defer close(m.syncerDone)
+	defer stopWatching()
+
+	var poll <-chan time.Time
+
+	if changes == nil {
+		ticker := time.NewTicker(m.opts.syncConfigPeriod)
+		defer ticker.Stop()
+
+		poll = ticker.C
+	}
+
+	debounce := time.NewTimer(m.opts.watchDebounce)
+	debounce.Stop()
+
+	var debounced <-chan time.Time
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-poll:
+			m.SyncIn()
+		case <-changes:
+			if !debounce.Stop() && debounced != nil {
+				<-debounce.C
+			}
+
+			debounce.Reset(m.opts.watchDebounce)
+			debounced = debounce.C
+		case <-debounced:
+			debounced = nil
+
 			m.SyncIn()
 		case <-m.syncNotification:
 			m.SyncOut()
-			ticker.Reset(m.opts.syncConfigPeriod)
+		case <-m.usageNotification:
+			m.SyncUsage()
 		case <-ctx.Done():
+			debounce.Stop()
+
+			select {
+			case <-m.syncNotification:
+				m.SyncOut()
+			default:
+			}
+
+			select {
+			case <-m.usageNotification:
+				m.SyncUsage()
+			default:
+			}
+
 			return
 		}
 	}
 }
 
+// SyncIn merges changes made to the stored tree since the last sync into the tree.
 func (m *Manager) SyncIn() {
-	if err := m.readConfig(); err != nil {
-		m.log.Warn("m.readConfig():", err)
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	if err := m.merge(); err != nil {
+		m.log.Warn("m.merge():", err)
 	}
 }
 
+// SyncOut saves the tree, merging changes made to the stored tree since the last sync first.
 func (m *Manager) SyncOut() {
-	entries := make([]Entry, 0, m.root.Len())
+	// The snapshot is taken under syncMu too, so concurrent calls never save an older tree over a newer one.
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
 
-	m.mu.RLock()
-	for _, elem := range m.root.List() {
-		entries = append(entries, m.entry2ExternalEntry(elem, true))
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = m.save()
+		if !errors.Is(err, ErrModified) || attempt == maxSyncAttempts {
+			break
+		}
+
+		if err = m.merge(); err != nil {
+			// The stored tree is unreadable or corrupt, it is overwritten.
+			m.log.Warn("m.merge():", err)
+		}
 	}
-	m.mu.RUnlock()
 
-	bytes, err := yaml.Marshal(entries)
 	if err != nil {
-		m.log.Warn("yaml.Marshal(m.root):", err)
+		m.log.Warn("m.save():", err)
 
 		return
 	}
 
-	file, err := os.Create(m.opts.configPath)
+	m.saveHistory()
+	m.saveUsage()
+}
+
+// save applies the pending changes to an incremental store, or saves the whole tree.
+// syncMu must be held.
+func (m *Manager) save() error {
+	m.mu.Lock()
+	m.purgeExpired(time.Now())
+	doc := Document{
+		Version:  SchemaVersion,
+		Metadata: cloneMetadata(m.metadata),
+		NextID:   m.maxID + 1,
+		Entries:  m.entries(),
+		Trash:    cloneTrash(m.trash),
+	}
+	changes, fullSave := m.pending, m.fullSave || m.incremental == nil
+	m.pending, m.fullSave = nil, false
+	m.mu.Unlock()
+
+	var err error
+
+	switch {
+	case fullSave:
+		err = m.store.Save(doc)
+	case len(changes) > 0:
+		err = m.incremental.Apply(changes, doc.NextID)
+	}
+
 	if err != nil {
-		m.log.Warn("os.Create(m.opts.configPath):", err)
+		m.mu.Lock()
+		m.fullSave = true
+		m.mu.Unlock()
+
+		return err //nolint:wrapcheck
+	}
+
+	m.base = doc
 
+	return nil
+}
+
+// merge does a three-way merge of the tree, the stored tree and the base if the stored tree
+// has been changed since the last sync. syncMu must be held.
+func (m *Manager) merge() error {
+	theirs, err := m.store.Load()
+	if err != nil {
+		if errors.Is(err, ErrNotModified) {
+			return nil
+		}
+
+		return err //nolint:wrapcheck
+	}
+
+	if m.opts.globalIDs {
+		assignUIDs(theirs.Entries)
+	}
+
+	m.mu.Lock()
+	nextID := m.maxID + 1
+	if theirs.NextID > nextID {
+		nextID = theirs.NextID
+	}
+
+	ours := m.entries()
+	merged, conflicts, nextID := merge(m.base.Entries, ours, theirs.Entries, nextID, m.opts.mergePolicy)
+	m.root, m.EntryIDs = m.buildTree(merged)
+	m.reindex()
+	m.maxID = nextID - 1
+	m.metadata = mergeMetadata(m.base.Metadata, m.metadata, theirs.Metadata, m.opts.mergePolicy)
+	m.trash = mergeTrash(m.base.Trash, m.trash, cloneTrash(theirs.Trash), func(id int) bool { return m.EntryIDs[id] != nil })
+
+	if len(conflicts) > 0 {
+		m.conflicts = conflicts
+	}
+
+	diverged := !sameEntries(merged, theirs.Entries) || !sameMetadata(m.metadata, theirs.Metadata) ||
+		!sameTrash(m.trash, theirs.Trash)
+	m.pending, m.fullSave = nil, diverged
+
+	if !sameEntries(merged, ours) {
+		m.publishReload()
+	}
+
+	m.mu.Unlock()
+
+	m.base = theirs
+
+	for _, conflict := range conflicts {
+		m.log.Warn("merge: ", conflict.String())
+	}
+
+	m.checkOnLoad()
+
+	if diverged {
+		m.notifySinker()
+	}
+
+	return nil
+}
+
+// RestoreBackup replaces the stored tree with the backup index and reloads the tree.
+// The replaced tree, if valid, becomes the most recent backup.
+func (m *Manager) RestoreBackup(index int) error {
+	store, ok := m.store.(interface{ RestoreBackup(index int) error })
+	if !ok {
+		return fmt.Errorf("backup %d: %w", index, ErrUnsupported)
+	}
+
+	m.syncMu.Lock()
+	err := store.RestoreBackup(index)
+	m.syncMu.Unlock()
+
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return m.load()
+}
+
+// Metadata returns the metadata of the library.
+func (m *Manager) Metadata() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return cloneMetadata(m.metadata)
+}
+
+// SetMetadata sets the metadata key of the library, an empty value deletes it.
+func (m *Manager) SetMetadata(key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setMetadata(key, value)
+}
+
+func (m *Manager) setMetadata(key, value string) {
+	old := m.metadata[key]
+	if old == value {
 		return
 	}
 
-	defer func() {
-		if err = file.Close(); err != nil {
-			m.log.Warn("file.Close():", err)
+	m.putMetadata(key, value)
+	m.record(OpSetMetadata, HistoryChange{Key: key, OldValue: old, NewValue: value}) //nolint:exhaustruct
+}
+
+func (m *Manager) putMetadata(key, value string) {
+	defer m.notifySinker()
+
+	if value == "" {
+		delete(m.metadata, key)
+	} else {
+		if m.metadata == nil {
+			m.metadata = make(map[string]string)
 		}
-	}()
 
-	if _, err = file.Write(bytes); err != nil {
-		m.log.Warn("file.Write(bytes):", err)
+		m.metadata[key] = value
+	}
+
+	m.fullSave = true
+}
+
+// Conflicts returns the conflicts resolved by the latest merge that had any.
+func (m *Manager) Conflicts() []Conflict {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]Conflict(nil), m.conflicts...)
+}
+
+// entries returns the tree in external representation. mu must be held.
+func (m *Manager) entries() []Entry {
+	entries := make([]Entry, 0, m.root.Len())
+
+	for _, elem := range m.root.List() {
+		entries = append(entries, m.entry2ExternalEntry(elem, true))
+	}
+
+	return entries
+}
+
+// recordPut records the entry has been created, changed or moved. mu must be held.
+func (m *Manager) recordPut(node *list.Node[entry]) {
+	if m.incremental == nil || m.fullSave {
+		return
+	}
+
+	var nextID int
+	if node.Next != nil {
+		nextID = node.Next.Value.ID
+	}
+
+	m.pending = append(m.pending, Change{
+		Kind:   ChangePut,
+		Entry:  m.entry2ExternalEntry(node.Value, false),
+		NextID: nextID,
+		Item:   nil,
+	})
+}
+
+// recordPutTree records the entry and its subtree have been created. mu must be held.
+func (m *Manager) recordPutTree(node *list.Node[entry]) {
+	m.recordPut(node)
+
+	for elem := node.Value.Entries.Head; elem != nil; elem = elem.Next {
+		m.recordPutTree(elem)
+	}
+}
+
+// recordTrash records the item has been added to the trash. mu must be held.
+func (m *Manager) recordTrash(item TrashItem) {
+	if m.incremental == nil || m.fullSave {
+		return
+	}
+
+	entry := item.Entry
+	entry.Entries = nil
+	m.pending = append(m.pending, Change{Kind: ChangeTrash, Entry: entry, NextID: item.NextID, Item: &item})
+}
+
+// recordUntrash records the trash item of the entry has been removed. mu must be held.
+func (m *Manager) recordUntrash(id int) {
+	if m.incremental == nil || m.fullSave {
+		return
+	}
+
+	m.pending = append(m.pending, Change{Kind: ChangeUntrash, Entry: Entry{ID: id}, NextID: 0, Item: nil}) //nolint:exhaustruct
+}
 
+// recordDelete records the entry has been deleted. mu must be held.
+func (m *Manager) recordDelete(id int) {
+	if m.incremental == nil || m.fullSave {
 		return
 	}
+
+	m.pending = append(m.pending, Change{Kind: ChangeDelete, Entry: Entry{ID: id}, NextID: 0, Item: nil}) //nolint:exhaustruct
 }
 
 func (m *Manager) notifySinker() {
@@ -168,6 +573,12 @@ func (m *Manager) notifySinker() {
 		return
 	}
 
+	if m.batching.Load() {
+		m.batchNotified.Store(true)
+
+		return
+	}
+
 	select {
 	case m.syncNotification <- struct{}{}:
 	default:
@@ -196,11 +607,97 @@ func (m *Manager) getEntryByID(id int) *list.Node[entry] {
 	return e
 }
 
+// getDir is getDirByID which fails on unknown IDs and commands.
+func (m *Manager) getDir(id int) (*list.DeLinkedList[entry], error) {
+	if id == 0 {
+		return m.root, nil
+	}
+
+	node := m.getEntryByID(id)
+	if node == nil {
+		return nil, fmt.Errorf("entry %d: %w", id, ErrNotFound)
+	}
+
+	if !node.Value.IsDir {
+		return nil, fmt.Errorf("entry %d: %w", id, ErrNotADirectory)
+	}
+
+	if node.Value.Smart != nil {
+		return nil, fmt.Errorf("entry %d: %w", id, ErrSmartDir)
+	}
+
+	return node.Value.Entries, nil
+}
+
+// getPlacement resolves a parent dir and a node to insert before, nil next means the end of the dir.
+func (m *Manager) getPlacement(parentID, nextID int) (*list.DeLinkedList[entry], *list.Node[entry], error) {
+	dir, err := m.getDir(parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if nextID == 0 {
+		return dir, nil, nil
+	}
+
+	next := m.getEntryByID(nextID)
+	if next == nil {
+		return nil, nil, fmt.Errorf("entry %d: %w", nextID, ErrNotFound)
+	}
+
+	if next.Value.ParentID != parentID {
+		return nil, nil, fmt.Errorf("entry %d in %d: %w", nextID, parentID, ErrNotASibling)
+	}
+
+	return dir, next, nil
+}
+
+// isDescendant reports whether id is ancestorID itself or lies in its subtree.
+func (m *Manager) isDescendant(id, ancestorID int) bool {
+	for steps := 0; id != 0 && steps <= len(m.EntryIDs); steps++ {
+		if id == ancestorID {
+			return true
+		}
+
+		node := m.getEntryByID(id)
+		if node == nil {
+			return false
+		}
+
+		id = node.Value.ParentID
+	}
+
+	return false
+}
+
+func (m *Manager) getCommand(id int) (*list.Node[entry], error) {
+	node := m.getEntryByID(id)
+	if node == nil {
+		return nil, fmt.Errorf("entry %d: %w", id, ErrNotFound)
+	}
+
+	if node.Value.IsDir {
+		return nil, fmt.Errorf("entry %d: %w", id, ErrNotACommand)
+	}
+
+	return node, nil
+}
+
+// DisplayEntry returns the name of the entry, its exec cut to maxDisplayLen if it has none.
+// An unnamed link not resolved yet is displayed with the exec of its target.
 func (m *Manager) DisplayEntry(entry *Entry) string {
 	if entry == nil {
 		return ""
 	}
 
+	if entry.Link != 0 && entry.Name == "" && entry.Exec == "" {
+		m.mu.RLock()
+		resolved := m.resolveLink(*entry)
+		m.mu.RUnlock()
+
+		entry = &resolved
+	}
+
 	if entry.Name != "" {
 		return entry.Name
 	}
@@ -217,10 +714,20 @@ func (m *Manager) newEntry(name, exec string, isDir bool, parentID int) entry {
 
 	dir := list.DeLinkedList[entry]{}
 
+	var uid string
+	if m.opts.globalIDs {
+		uid = newULID()
+	}
+
 	return entry{
 		ID:        m.maxID,
+		UID:       uid,
 		Name:      name,
 		Exec:      exec,
+		Params:    nil,
+		Tags:      nil,
+		Link:      0,
+		Smart:     nil,
 		ParentID:  parentID,
 		Entries:   &dir,
 		IsDir:     isDir,
@@ -237,53 +744,115 @@ func (m *Manager) unregisterEntry(id int) {
 	delete(m.EntryIDs, id)
 }
 
-func (m *Manager) MoveEntry(targetID, parentID, nextID int) {
+func (m *Manager) MoveEntry(targetID, parentID, nextID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.moveEntry(targetID, parentID, nextID)
+}
+
+func (m *Manager) moveEntry(targetID, parentID, nextID int) error {
 	node := m.getEntryByID(targetID)
 	if node == nil {
-		return
+		return fmt.Errorf("entry %d: %w", targetID, ErrNotFound)
+	}
+
+	dir, next, err := m.getPlacement(parentID, nextID)
+	if err != nil {
+		return err
+	}
+
+	if m.isDescendant(parentID, targetID) {
+		return fmt.Errorf("entry %d into %d: %w", targetID, parentID, ErrCycle)
+	}
+
+	if next == node {
+		return nil
 	}
 
 	defer m.notifySinker()
-	defer func() {
-		node.Value.UpdatedAt = time.Now()
-	}()
 
-	dir := m.getDirByID(parentID)
-	if node.Value.ParentID == parentID {
-		dir.MoveItem(node, nil, m.getEntryByID(nextID))
+	before := m.state(node, false)
+	node.Value.UpdatedAt = time.Now()
 
-		return
+	if node.Value.ParentID == parentID {
+		dir.MoveItem(node, nil, next)
+	} else {
+		currentDir := m.getDirByID(node.Value.ParentID)
+		currentDir.DeleteElement(node)
+		m.unregisterEntry(targetID)
+
+		node = dir.AddElement(node.Value, nil, next)
+		m.registerEntry(node)
+		node.Value.ParentID = parentID
 	}
 
-	currentDir := m.getDirByID(node.Value.ParentID)
-	currentDir.DeleteElement(node)
-	m.unregisterEntry(targetID)
+	m.recordPut(node)
+	m.record(OpMove, HistoryChange{Before: before, After: m.state(node, false)}) //nolint:exhaustruct
 
-	node = dir.AddElement(node.Value, nil, m.getEntryByID(nextID))
-	m.registerEntry(node)
-	node.Value.ParentID = parentID
+	return nil
+}
+
+func (m *Manager) RenameEntry(targetID int, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.renameEntry(targetID, name)
 }
 
-func (m *Manager) RenameEntry(targetID int, name string) {
+func (m *Manager) renameEntry(targetID int, name string) error {
 	node := m.getEntryByID(targetID)
 	if node == nil {
-		return
+		return fmt.Errorf("entry %d: %w", targetID, ErrNotFound)
+	}
+
+	if name == "" && (node.Value.IsDir || node.Value.Exec == "") {
+		return fmt.Errorf("entry %d: empty name: %w", targetID, ErrInvalidName)
 	}
 
 	defer m.notifySinker()
 
+	before := m.state(node, false)
 	node.Value.Name = name
+	m.recordPut(node)
+	m.record(OpRename, HistoryChange{Before: before, After: m.state(node, false)}) //nolint:exhaustruct
+
+	return nil
+}
+
+func (m *Manager) GetEntry(id int) (Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.getEntry(id)
+}
+
+func (m *Manager) getEntry(id int) (Entry, error) {
+	node := m.getEntryByID(id)
+	if node == nil {
+		return Entry{}, fmt.Errorf("entry %d: %w", id, ErrNotFound) //nolint:exhaustruct
+	}
+
+	return m.resolveLink(m.entry2ExternalEntry(node.Value, false)), nil
 }
 
 func (m *Manager) ListDirectory(id int) []Entry {
 	m.mu.RLock()
-	l := m.getDirByID(id).List()
-	m.mu.RUnlock()
+	defer m.mu.RUnlock()
+
+	return m.listDirectory(id)
+}
 
+func (m *Manager) listDirectory(id int) []Entry {
+	if node := m.getEntryByID(id); node != nil && node.Value.Smart != nil {
+		return m.smartEntries(node.Value.Smart)
+	}
+
+	l := m.getDirByID(id).List()
 	result := make([]Entry, 0, len(l))
 
 	for _, elem := range l {
-		result = append(result, m.entry2ExternalEntry(elem, false))
+		result = append(result, m.resolveLink(m.entry2ExternalEntry(elem, false)))
 	}
 
 	return result
@@ -300,8 +869,13 @@ func (m *Manager) entry2ExternalEntry(entry entry, withSubDirs bool) Entry {
 
 	return Entry{
 		ID:        entry.ID,
+		UID:       entry.UID,
 		Name:      entry.Name,
 		Exec:      entry.Exec,
+		Params:    cloneParams(entry.Params),
+		Tags:      append([]string(nil), entry.Tags...),
+		Link:      entry.Link,
+		Smart:     entry.Smart.clone(),
 		ParentID:  entry.ParentID,
 		Entries:   entries,
 		IsDir:     entry.IsDir,
@@ -320,8 +894,13 @@ func (m *Manager) entry2InternalEntry(exEntry Entry, entryIDs map[int]*list.Node
 
 	return entry{
 		ID:        exEntry.ID,
+		UID:       exEntry.UID,
 		Name:      exEntry.Name,
 		Exec:      exEntry.Exec,
+		Params:    cloneParams(exEntry.Params),
+		Tags:      append([]string(nil), exEntry.Tags...),
+		Link:      exEntry.Link,
+		Smart:     exEntry.Smart.clone(),
 		ParentID:  exEntry.ParentID,
 		Entries:   entries,
 		IsDir:     exEntry.IsDir,
@@ -332,17 +911,45 @@ func (m *Manager) entry2InternalEntry(exEntry Entry, entryIDs map[int]*list.Node
 
 // Entry is entry representation for external use.
 type Entry struct {
-	ID        int       `yaml:"id"`
-	Name      string    `yaml:"name"`
-	Exec      string    `yaml:"exec"`
-	ParentID  int       `yaml:"parentId"`
-	Entries   []Entry   `yaml:"entries"`
-	IsDir     bool      `yaml:"isDir"`
-	CreatedAt time.Time `yaml:"createdAt"`
-	UpdatedAt time.Time `yaml:"updatedAt"`
+	ID     int      `yaml:"id" json:"id" toml:"id"`
+	UID    string   `yaml:"uid,omitempty" json:"uid,omitempty" toml:"uid,omitempty"`
+	Name   string   `yaml:"name" json:"name" toml:"name"`
+	Exec   string   `yaml:"exec" json:"exec" toml:"exec"`
+	Params []Param  `yaml:"params,omitempty" json:"params,omitempty" toml:"params,omitempty"`
+	Tags   []string `yaml:"tags,omitempty" json:"tags,omitempty" toml:"tags,omitempty"`
+	// Link is the ID of the command a link points at, see AddLink.
+	Link int `yaml:"link,omitempty" json:"link,omitempty" toml:"link,omitempty"`
+	// Smart is the query of a smart dir, see AddSmartDir.
+	Smart     *SmartQuery `yaml:"smart,omitempty" json:"smart,omitempty" toml:"smart,omitempty"`
+	ParentID  int         `yaml:"parentId" json:"parentId" toml:"parentId"`
+	Entries   []Entry     `yaml:"entries" json:"entries" toml:"entries,omitempty"`
+	IsDir     bool        `yaml:"isDir" json:"isDir" toml:"isDir"`
+	CreatedAt time.Time   `yaml:"createdAt" json:"createdAt" toml:"createdAt"`
+	UpdatedAt time.Time   `yaml:"updatedAt" json:"updatedAt" toml:"updatedAt"`
 }
 
-func (m *Manager) setRoot(entries []Entry) {
+// setRoot replaces the tree. The ID high-water mark never decreases, so IDs of deleted
+// entries are not reused even if the file has been written by an older version.
+func (m *Manager) setRoot(doc Document) {
+	root, entryIDs := m.buildTree(doc.Entries)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.root = root
+	m.EntryIDs = entryIDs
+	m.reindex()
+	m.metadata = cloneMetadata(doc.Metadata)
+	m.trash = cloneTrash(doc.Trash)
+	m.pending, m.fullSave = nil, false
+
+	for _, id := range []int{doc.NextID - 1, maxEntryID(doc.Entries), maxTrashID(doc.Trash)} {
+		if id > m.maxID {
+			m.maxID = id
+		}
+	}
+}
+
+func (m *Manager) buildTree(entries []Entry) (*list.DeLinkedList[entry], map[int]*list.Node[entry]) {
 	entryIDs := make(map[int]*list.Node[entry])
 	root := &list.DeLinkedList[entry]{}
 
@@ -351,8 +958,5 @@ func (m *Manager) setRoot(entries []Entry) {
 		entryIDs[node.Value.ID] = node
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.root = root
-	m.EntryIDs = entryIDs
+	return root, entryIDs
 }
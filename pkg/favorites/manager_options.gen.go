@@ -21,6 +21,12 @@ func NewOptions(
 	o := Options{}
 
 	// Setting defaults from field tag (if present)
+	o.shell = "/bin/sh"
+	o.shellFlag = "-c"
+	o.backups = 3
+	o.watchDebounce, _ = time.ParseDuration("100ms")
+	o.historySize = 100
+	o.trashRetention, _ = time.ParseDuration("720h")
 
 	o.inMemory = inMemory
 	o.configPath = configPath
@@ -33,11 +39,120 @@ func NewOptions(
 	return o
 }
 
+func WithShell(opt string) OptOptionsSetter {
+	return func(o *Options) {
+		o.shell = opt
+	}
+}
+
+func WithShellFlag(opt string) OptOptionsSetter {
+	return func(o *Options) {
+		o.shellFlag = opt
+	}
+}
+
+func WithWorkDir(opt string) OptOptionsSetter {
+	return func(o *Options) {
+		o.workDir = opt
+	}
+}
+
+func WithEnv(opt []string) OptOptionsSetter {
+	return func(o *Options) {
+		o.env = opt
+	}
+}
+
+func WithRunTimeout(opt time.Duration) OptOptionsSetter {
+	return func(o *Options) {
+		o.runTimeout = opt
+	}
+}
+
+func WithDuplicatePolicy(opt DuplicatePolicy) OptOptionsSetter {
+	return func(o *Options) {
+		o.duplicatePolicy = opt
+	}
+}
+
+func WithRepairOnLoad(opt bool) OptOptionsSetter {
+	return func(o *Options) {
+		o.repairOnLoad = opt
+	}
+}
+
+func WithGlobalIDs(opt bool) OptOptionsSetter {
+	return func(o *Options) {
+		o.globalIDs = opt
+	}
+}
+
+func WithBackups(opt int) OptOptionsSetter {
+	return func(o *Options) {
+		o.backups = opt
+	}
+}
+
+func WithMergePolicy(opt MergePolicy) OptOptionsSetter {
+	return func(o *Options) {
+		o.mergePolicy = opt
+	}
+}
+
+func WithDisableWatch(opt bool) OptOptionsSetter {
+	return func(o *Options) {
+		o.disableWatch = opt
+	}
+}
+
+func WithWatchDebounce(opt time.Duration) OptOptionsSetter {
+	return func(o *Options) {
+		o.watchDebounce = opt
+	}
+}
+
+func WithStore(opt Store) OptOptionsSetter {
+	return func(o *Options) {
+		o.store = opt
+	}
+}
+
+func WithFormat(opt Format) OptOptionsSetter {
+	return func(o *Options) {
+		o.format = opt
+	}
+}
+
+func WithHistorySize(opt int) OptOptionsSetter {
+	return func(o *Options) {
+		o.historySize = opt
+	}
+}
+
+func WithTrashRetention(opt time.Duration) OptOptionsSetter {
+	return func(o *Options) {
+		o.trashRetention = opt
+	}
+}
+
+func WithLinkPolicy(opt LinkPolicy) OptOptionsSetter {
+	return func(o *Options) {
+		o.linkPolicy = opt
+	}
+}
+
+func WithRawParams(opt bool) OptOptionsSetter {
+	return func(o *Options) {
+		o.rawParams = opt
+	}
+}
+
 func (o *Options) Validate() error {
 	errs := new(errors461e464ebed9.ValidationErrors)
 	errs.Add(errors461e464ebed9.NewValidationError("configPath", _validate_Options_configPath(o)))
 	errs.Add(errors461e464ebed9.NewValidationError("syncConfigPeriod", _validate_Options_syncConfigPeriod(o)))
 	errs.Add(errors461e464ebed9.NewValidationError("maxDisplayLen", _validate_Options_maxDisplayLen(o)))
+	errs.Add(errors461e464ebed9.NewValidationError("shell", _validate_Options_shell(o)))
 	return errs.AsError()
 }
 
@@ -61,3 +176,10 @@ func _validate_Options_maxDisplayLen(o *Options) error {
 	}
 	return nil
 }
+
+func _validate_Options_shell(o *Options) error {
+	if err := validator461e464ebed9.GetValidatorFor(o).Var(o.shell, "required"); err != nil {
+		return fmt461e464ebed9.Errorf("field `shell` did not pass the test: %w", err)
+	}
+	return nil
+}
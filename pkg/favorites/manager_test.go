@@ -45,21 +45,25 @@ func (s *TestManagerSuite) TestManager() {
 	exec := "sudo do nothing"
 
 	s.Run("add command", func() {
-		s.manager.AddCommand(name, exec, 0, 0)
+		id, err := s.manager.AddCommand(name, exec, 0, 0)
+		s.Require().NoError(err)
 		list = s.manager.ListDirectory(0)
 		s.Require().Len(list, 1)
+		s.Require().Equal(id, list[0].ID)
 		s.Require().Equal(name, list[0].Name)
 		s.Require().Equal(exec, list[0].Exec)
 		s.Require().Equal(name, s.manager.DisplayEntry(&list[0]))
 	})
 
 	s.Run("add empty command without name", func() {
-		s.manager.AddCommand("", "", 0, 0)
+		_, err := s.manager.AddCommand("", "", 0, 0)
+		s.Require().ErrorIs(err, favorites2.ErrInvalidName)
 		s.Require().Len(s.manager.ListDirectory(0), 1)
 	})
 
 	s.Run("add command without name", func() {
-		s.manager.AddCommand("", exec, 0, list[0].ID)
+		_, err := s.manager.AddCommand("", exec, 0, list[0].ID)
+		s.Require().NoError(err)
 		list = s.manager.ListDirectory(0)
 		s.Require().Len(list, 2)
 		s.Require().Equal("", list[0].Name)
@@ -67,7 +71,7 @@ func (s *TestManagerSuite) TestManager() {
 	})
 
 	s.Run("move command within a dir", func() {
-		s.manager.MoveEntry(list[0].ID, 0, 0)
+		s.Require().NoError(s.manager.MoveEntry(list[0].ID, 0, 0))
 		s.Require().Len(list, 2)
 		list = s.manager.ListDirectory(0)
 		s.Require().Equal(name, list[0].Name)
@@ -76,19 +80,20 @@ func (s *TestManagerSuite) TestManager() {
 
 	s.Run("change exec", func() {
 		exec = "sudo do something veeeeery long bla-bla-bla"
-		s.manager.ModifyExec(list[1].ID, exec)
+		s.Require().NoError(s.manager.ModifyExec(list[1].ID, exec))
 		s.Require().Equal(exec, s.manager.ListDirectory(0)[1].Exec)
 		s.Require().Equal("sudo do something veeeeery long bla-b...", s.manager.DisplayEntry(&s.manager.ListDirectory(0)[1]))
 	})
 
 	s.Run("rename command", func() {
 		name = "second command"
-		s.manager.RenameEntry(list[1].ID, name)
+		s.Require().NoError(s.manager.RenameEntry(list[1].ID, name))
 		s.Require().Equal(name, s.manager.ListDirectory(0)[1].Name)
 	})
 
 	s.Run("add dir", func() {
-		s.manager.AddDir("first dir", 0, list[0].ID)
+		_, err := s.manager.AddDir("first dir", 0, list[0].ID)
+		s.Require().NoError(err)
 		list = s.manager.ListDirectory(0)
 		s.Require().Len(list, 3)
 		s.Require().Equal("first dir", list[0].Name)
@@ -97,14 +102,16 @@ func (s *TestManagerSuite) TestManager() {
 	})
 
 	s.Run("add dir without a name", func() {
-		s.manager.AddDir("", 0, list[0].ID)
+		_, err := s.manager.AddDir("", 0, list[0].ID)
+		s.Require().ErrorIs(err, favorites2.ErrInvalidName)
 		s.Require().Len(s.manager.ListDirectory(0), 3)
 	})
 
 	var list2 []favorites2.Entry
 
 	s.Run("add dir to dir", func() {
-		s.manager.AddDir("second dir", list[0].ID, 0)
+		_, err := s.manager.AddDir("second dir", list[0].ID, 0)
+		s.Require().NoError(err)
 		list = s.manager.ListDirectory(0)
 		s.Require().Len(list, 3)
 		list2 = s.manager.ListDirectory(list[0].ID)
@@ -114,7 +121,7 @@ func (s *TestManagerSuite) TestManager() {
 	})
 
 	s.Run("move command to another dir", func() {
-		s.manager.MoveEntry(list[2].ID, list[0].ID, 0)
+		s.Require().NoError(s.manager.MoveEntry(list[2].ID, list[0].ID, 0))
 		list = s.manager.ListDirectory(0)
 		s.Require().Len(list, 2)
 		list2 = s.manager.ListDirectory(list[0].ID)
@@ -123,7 +130,7 @@ func (s *TestManagerSuite) TestManager() {
 	})
 
 	s.Run("move another command to the dir", func() {
-		s.manager.MoveEntry(list[1].ID, list[0].ID, list2[0].ID)
+		s.Require().NoError(s.manager.MoveEntry(list[1].ID, list[0].ID, list2[0].ID))
 		list = s.manager.ListDirectory(0)
 		s.Require().Len(list, 1)
 		list2 = s.manager.ListDirectory(list[0].ID)
@@ -145,26 +152,54 @@ func (s *TestManagerSuite) TestManager() {
 		s.Require().Equal("first command", list2[0].Name)
 	})
 
+	s.Run("invalid operations", func() {
+		unknown := 1000
+		cmdID := list2[2].ID
+		dirID := list[0].ID
+
+		_, err := s.manager.AddCommand("cmd", "true", unknown, 0)
+		s.Require().ErrorIs(err, favorites2.ErrNotFound)
+		_, err = s.manager.AddCommand("cmd", "true", cmdID, 0)
+		s.Require().ErrorIs(err, favorites2.ErrNotADirectory)
+		_, err = s.manager.AddDir("dir", 0, unknown)
+		s.Require().ErrorIs(err, favorites2.ErrNotFound)
+		s.Require().ErrorIs(s.manager.DeleteCommand(unknown), favorites2.ErrNotFound)
+		s.Require().ErrorIs(s.manager.DeleteCommand(dirID), favorites2.ErrNotACommand)
+		s.Require().ErrorIs(s.manager.DeleteDir(cmdID), favorites2.ErrNotADirectory)
+		s.Require().ErrorIs(s.manager.MoveEntry(unknown, 0, 0), favorites2.ErrNotFound)
+		s.Require().ErrorIs(s.manager.MoveEntry(cmdID, unknown, 0), favorites2.ErrNotFound)
+		s.Require().ErrorIs(s.manager.MoveEntry(dirID, cmdID, 0), favorites2.ErrNotADirectory)
+		s.Require().ErrorIs(s.manager.MoveEntry(dirID, dirID, 0), favorites2.ErrCycle)
+		s.Require().ErrorIs(s.manager.RenameEntry(unknown, "name"), favorites2.ErrNotFound)
+		s.Require().ErrorIs(s.manager.RenameEntry(dirID, ""), favorites2.ErrInvalidName)
+		s.Require().ErrorIs(s.manager.ModifyExec(unknown, "true"), favorites2.ErrNotFound)
+		s.Require().ErrorIs(s.manager.ModifyExec(dirID, "true"), favorites2.ErrNotACommand)
+
+		s.Require().Len(s.manager.ListDirectory(0), 1)
+		s.Require().Len(s.manager.ListDirectory(dirID), 3)
+	})
+
 	s.Run("delete command", func() {
-		s.manager.DeleteCommand(list2[2].ID)
+		s.Require().NoError(s.manager.DeleteCommand(list2[2].ID))
 		list2 = s.manager.ListDirectory(list[0].ID)
 		s.Require().Len(list2, 2)
 	})
 
 	s.Run("add tmp command", func() {
-		s.manager.AddCommand("tmp cmd", "", list[0].ID, 0)
+		_, err := s.manager.AddCommand("tmp cmd", "", list[0].ID, 0)
+		s.Require().NoError(err)
 		list2 = s.manager.ListDirectory(list[0].ID)
 		s.Require().Len(list2, 3)
 	})
 
 	s.Run("delete first command", func() {
-		s.manager.DeleteCommand(list2[0].ID)
+		s.Require().NoError(s.manager.DeleteCommand(list2[0].ID))
 		list2 = s.manager.ListDirectory(list[0].ID)
 		s.Require().Len(list2, 2)
 	})
 
 	s.Run("delete parent dir", func() {
-		s.manager.DeleteDir(list[0].ID)
+		s.Require().NoError(s.manager.DeleteDir(list[0].ID))
 		list = s.manager.ListDirectory(0)
 		s.Require().Len(list, 0)
 		s.Require().Len(s.manager.EntryIDs, 0)
@@ -0,0 +1,607 @@
+package favorites
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MergePolicy defines how SyncIn and SyncOut resolve conflicting changes made in memory (ours)
+// and in the config file by hand or by another process (theirs).
+type MergePolicy int
+
+const (
+	// MergeKeepBoth loses nothing: a command changed on both sides keeps their version and gets
+	// a copy with our version next to it, an entry deleted on one side and changed on the other is kept.
+	// Conflicting moves and directory renames resolve to their version.
+	MergeKeepBoth MergePolicy = iota
+	// MergeOurs resolves every conflict to the in-memory version.
+	MergeOurs
+	// MergeTheirs resolves every conflict to the config file version.
+	MergeTheirs
+)
+
+// Conflict describes an entry changed both in memory and in the config file since the last sync.
+type Conflict struct {
+	ID         int    `json:"id"`
+	Problem    string `json:"problem"`
+	Resolution string `json:"resolution"`
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("entry %d: %s: %s", c.ID, c.Problem, c.Resolution)
+}
+
+// mergeSide is a tree flattened by ID. Entries of the values are not used, children keeps the order.
+type mergeSide struct {
+	entries  map[int]*Entry
+	children map[int][]int
+}
+
+func flattenEntries(entries []Entry, nextID *int) mergeSide {
+	side := mergeSide{entries: make(map[int]*Entry), children: make(map[int][]int)}
+	side.add(entries, 0, nextID)
+
+	return side
+}
+
+// add trusts the structure rather than ParentID fields. Duplicate IDs get new ones.
+func (s mergeSide) add(entries []Entry, parentID int, nextID *int) {
+	for i := range entries {
+		e := entries[i]
+		e.ParentID = parentID
+		e.Entries = nil
+
+		if _, ok := s.entries[e.ID]; ok || e.ID <= 0 {
+			e.ID = *nextID
+			*nextID++
+		}
+
+		s.entries[e.ID] = &e
+		s.children[parentID] = append(s.children[parentID], e.ID)
+		s.add(entries[i].Entries, e.ID, nextID)
+	}
+}
+
+func (s mergeSide) renumber(oldID, newID int) {
+	e := s.entries[oldID]
+	delete(s.entries, oldID)
+	e.ID = newID
+	s.entries[newID] = e
+
+	siblings := s.children[e.ParentID]
+	for i := range siblings {
+		if siblings[i] == oldID {
+			siblings[i] = newID
+		}
+	}
+
+	s.children[newID] = s.children[oldID]
+	delete(s.children, oldID)
+
+	for _, id := range s.children[newID] {
+		s.entries[id].ParentID = newID
+	}
+
+	for _, link := range s.entries {
+		if link.Link == oldID {
+			link.Link = newID
+		}
+	}
+}
+
+type merger struct {
+	policy    MergePolicy
+	nextID    int
+	base      mergeSide
+	ours      mergeSide
+	theirs    mergeSide
+	merged    map[int]*Entry
+	copies    map[int]int
+	conflicts []Conflict
+}
+
+// merge does a three-way merge of the trees by entry IDs. nextID is the first ID free on both sides,
+// returns the merged tree, the conflicts and the next free ID.
+func merge(base, ours, theirs []Entry, nextID int, policy MergePolicy) ([]Entry, []Conflict, int) {
+	for _, entries := range [][]Entry{base, ours, theirs} {
+		if id := maxEntryID(entries); id >= nextID {
+			nextID = id + 1
+		}
+	}
+
+	m := &merger{ //nolint:exhaustruct
+		policy: policy,
+		nextID: nextID,
+		merged: make(map[int]*Entry),
+		copies: make(map[int]int),
+	}
+	m.base = flattenEntries(base, &m.nextID)
+	m.ours = flattenEntries(ours, &m.nextID)
+	m.theirs = flattenEntries(theirs, &m.nextID)
+
+	m.renumberCollisions()
+
+	for _, id := range m.ids() {
+		m.mergeEntry(id)
+	}
+
+	m.restoreParents()
+	m.breakCycles()
+
+	return m.build(0), m.conflicts, m.nextID
+}
+
+func (m *merger) report(id int, problem, format string, args ...any) {
+	m.conflicts = append(m.conflicts, Conflict{ID: id, Problem: problem, Resolution: fmt.Sprintf(format, args...)})
+}
+
+func (m *merger) ids() []int {
+	seen := make(map[int]bool)
+
+	for _, side := range []mergeSide{m.base, m.ours, m.theirs} {
+		for id := range side.entries {
+			seen[id] = true
+		}
+	}
+
+	ids := make([]int, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+// renumberCollisions gives new IDs to our entries added with the same ID as different entries of theirs.
+func (m *merger) renumberCollisions() {
+	var collisions []int
+
+	for id, ours := range m.ours.entries {
+		theirs, ok := m.theirs.entries[id]
+		if _, inBase := m.base.entries[id]; inBase || !ok || sameEntry(ours, theirs) {
+			continue
+		}
+
+		collisions = append(collisions, id)
+	}
+
+	sort.Ints(collisions)
+
+	for _, id := range collisions {
+		m.ours.renumber(id, m.nextID)
+		m.report(id, "added on both sides", "ours renumbered to %d", m.nextID)
+		m.nextID++
+	}
+}
+
+// sameEntry reports whether entries added on both sides are the same one.
+func sameEntry(a, b *Entry) bool {
+	if a.UID != "" && b.UID != "" {
+		return a.UID == b.UID
+	}
+
+	return a.IsDir == b.IsDir && a.ParentID == b.ParentID && !modified(a, b)
+}
+
+// modified reports whether the entry has been changed apart from its position in the directory.
+func modified(before, after *Entry) bool {
+	return before.Name != after.Name || before.Exec != after.Exec || before.ParentID != after.ParentID ||
+		!paramsEqual(before.Params, after.Params) || !tagsEqual(before.Tags, after.Tags) ||
+		!smartEqual(before.Smart, after.Smart) || before.Link != after.Link
+}
+
+func paramsEqual(a, b []Param) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
+
+func (m *merger) mergeEntry(id int) {
+	base, ours, theirs := m.base.entries[id], m.ours.entries[id], m.theirs.entries[id]
+
+	switch {
+	case ours == nil && theirs == nil:
+	case base == nil && theirs == nil:
+		m.merged[id] = ours
+	case base == nil && ours == nil:
+		m.merged[id] = theirs
+	case base == nil:
+		m.merged[id] = newer(ours, theirs)
+	case ours == nil:
+		if !modified(base, theirs) {
+			return
+		}
+
+		if m.policy == MergeOurs {
+			m.report(id, "deleted by us, changed by them", "deleted")
+
+			return
+		}
+
+		m.report(id, "deleted by us, changed by them", "kept")
+		m.merged[id] = theirs
+	case theirs == nil:
+		if !modified(base, ours) {
+			return
+		}
+
+		if m.policy == MergeTheirs {
+			m.report(id, "changed by us, deleted by them", "deleted")
+
+			return
+		}
+
+		m.report(id, "changed by us, deleted by them", "kept")
+		m.merged[id] = ours
+	default:
+		m.mergeFields(base, ours, theirs)
+	}
+}
+
+func newer(a, b *Entry) *Entry {
+	if a.UpdatedAt.After(b.UpdatedAt) {
+		return a
+	}
+
+	return b
+}
+
+func (m *merger) mergeFields(base, ours, theirs *Entry) {
+	result := *newer(ours, theirs)
+	resolved := theirs
+
+	if m.policy == MergeOurs {
+		resolved = ours
+	}
+
+	var (
+		fields     []string
+		conflict   bool
+		preferOurs = m.policy == MergeOurs
+	)
+
+	if result.Name, conflict = merge3(base.Name, ours.Name, theirs.Name, equal[string], preferOurs); conflict {
+		fields = append(fields, "name")
+	}
+
+	if result.Exec, conflict = merge3(base.Exec, ours.Exec, theirs.Exec, equal[string], preferOurs); conflict {
+		fields = append(fields, "exec")
+	}
+
+	if result.Params, conflict = merge3(base.Params, ours.Params, theirs.Params, paramsEqual, preferOurs); conflict {
+		fields = append(fields, "params")
+	}
+
+	if result.Tags, conflict = merge3(base.Tags, ours.Tags, theirs.Tags, tagsEqual, preferOurs); conflict {
+		fields = append(fields, "tags")
+	}
+
+	if result.Smart, conflict = merge3(base.Smart, ours.Smart, theirs.Smart, smartEqual, preferOurs); conflict {
+		fields = append(fields, "smart query")
+	}
+
+	if result.Link, conflict = merge3(base.Link, ours.Link, theirs.Link, equal[int], preferOurs); conflict {
+		fields = append(fields, "link")
+	}
+
+	if result.ParentID, conflict = merge3(base.ParentID, ours.ParentID, theirs.ParentID, equal[int], preferOurs); conflict {
+		fields = append(fields, "parent")
+	}
+
+	m.merged[result.ID] = &result
+
+	if len(fields) == 0 {
+		return
+	}
+
+	problem := "both changed " + strings.Join(fields, ", ")
+
+	if m.policy != MergeKeepBoth || result.IsDir || len(fields) == 1 && fields[0] == "parent" {
+		m.report(result.ID, problem, "kept %s", sideName(resolved == ours))
+
+		return
+	}
+
+	dup := *ours
+	dup.ID = m.nextID
+	dup.UID = ""
+	dup.ParentID = result.ParentID
+	m.nextID++
+
+	m.merged[dup.ID] = &dup
+	m.copies[dup.ID] = result.ID
+	m.report(result.ID, problem, "kept theirs, ours copied to %d", dup.ID)
+}
+
+// mergeMetadata merges the metadata by keys, values changed on both sides resolve
+// to ours with MergeOurs and to theirs otherwise.
+func mergeMetadata(base, ours, theirs map[string]string, policy MergePolicy) map[string]string {
+	var merged map[string]string
+
+	for _, side := range []map[string]string{base, ours, theirs} {
+		for key := range side {
+			value, _ := merge3(base[key], ours[key], theirs[key], equal[string], policy == MergeOurs)
+			if value == "" {
+				continue
+			}
+
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+
+			merged[key] = value
+		}
+	}
+
+	return merged
+}
+
+func sameMetadata(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// merge3 returns the changed value if only one side has changed it, reports a conflict otherwise.
+func merge3[T any](base, ours, theirs T, eq func(a, b T) bool, preferOurs bool) (T, bool) {
+	switch {
+	case eq(ours, theirs) || eq(ours, base):
+		return theirs, false
+	case eq(theirs, base):
+		return ours, false
+	case preferOurs:
+		return ours, true
+	default:
+		return theirs, true
+	}
+}
+
+func equal[T comparable](a, b T) bool {
+	return a == b
+}
+
+func sideName(ours bool) string {
+	if ours {
+		return "ours"
+	}
+
+	return "theirs"
+}
+
+// restoreParents brings back directories deleted on one side while entries were added to them on the other.
+func (m *merger) restoreParents() {
+	for _, id := range m.mergedIDs() {
+		for parentID := m.merged[id].ParentID; parentID != 0 && m.merged[parentID] == nil; {
+			parent := m.ours.entries[parentID]
+			if parent == nil || m.policy == MergeTheirs && m.theirs.entries[parentID] != nil {
+				parent = m.theirs.entries[parentID]
+			}
+
+			if parent == nil {
+				parent = m.base.entries[parentID]
+			}
+
+			if parent == nil {
+				m.merged[id].ParentID = 0
+
+				break
+			}
+
+			m.report(parentID, "deleted, but entries have been added to it", "restored")
+			m.merged[parentID] = parent
+			parentID = parent.ParentID
+		}
+	}
+}
+
+// breakCycles fixes directories moved into each other on different sides: the move of the
+// other side than the policy prefers is reverted, or the directory is moved to the root.
+func (m *merger) breakCycles() {
+	preferred := m.theirs
+	if m.policy == MergeOurs {
+		preferred = m.ours
+	}
+
+	for _, fallback := range []bool{false, true} {
+		for _, id := range m.mergedIDs() {
+			if !m.inCycle(id) {
+				continue
+			}
+
+			e := m.merged[id]
+
+			switch p := preferred.entries[id]; {
+			case p != nil && p.ParentID != e.ParentID && (p.ParentID == 0 || m.merged[p.ParentID] != nil):
+				e.ParentID = p.ParentID
+			case fallback:
+				e.ParentID = 0
+			default:
+				continue
+			}
+
+			m.report(id, "moved into its own subtree", "moved to %d", e.ParentID)
+		}
+	}
+}
+
+func (m *merger) inCycle(id int) bool {
+	current := m.merged[id].ParentID
+
+	for steps := 0; current != 0 && steps <= len(m.merged); steps++ {
+		if current == id {
+			return true
+		}
+
+		current = m.merged[current].ParentID
+	}
+
+	return false
+}
+
+func (m *merger) mergedIDs() []int {
+	ids := make([]int, 0, len(m.merged))
+	for id := range m.merged {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+// order returns the children of the merged dir. The order of the side that has reordered the dir
+// is kept, entries only the other side has are inserted after their previous siblings there.
+func (m *merger) order(parentID int) []int {
+	member := func(id int) bool {
+		e := m.merged[id]
+
+		return e != nil && e.ParentID == parentID
+	}
+
+	base, ours, theirs := m.base.children[parentID], m.ours.children[parentID], m.theirs.children[parentID]
+	primary, secondary := theirs, ours
+
+	if sameOrder(base, theirs) && !sameOrder(base, ours) {
+		primary, secondary = ours, theirs
+	}
+
+	var result []int
+
+	placed := make(map[int]bool)
+	insert := func(at int, id int) int {
+		result = append(result, 0)
+		copy(result[at+1:], result[at:])
+		result[at] = id
+		placed[id] = true
+
+		return at + 1
+	}
+
+	for _, id := range primary {
+		if member(id) && !placed[id] {
+			insert(len(result), id)
+		}
+	}
+
+	at := 0
+
+	for _, id := range secondary {
+		if !member(id) {
+			continue
+		}
+
+		if placed[id] {
+			at = indexOf(result, id) + 1
+
+			continue
+		}
+
+		at = insert(at, id)
+	}
+
+	for _, id := range m.mergedIDs() {
+		if !member(id) || placed[id] {
+			continue
+		}
+
+		if orig, ok := m.copies[id]; ok && placed[orig] {
+			insert(indexOf(result, orig)+1, id)
+
+			continue
+		}
+
+		insert(len(result), id)
+	}
+
+	return result
+}
+
+// sameOrder compares the relative order of entries present in both lists.
+func sameOrder(a, b []int) bool {
+	inB := make(map[int]bool, len(b))
+	for _, id := range b {
+		inB[id] = true
+	}
+
+	inA := make(map[int]bool, len(a))
+
+	var common []int
+
+	for _, id := range a {
+		inA[id] = true
+
+		if inB[id] {
+			common = append(common, id)
+		}
+	}
+
+	i := 0
+
+	for _, id := range b {
+		if !inA[id] {
+			continue
+		}
+
+		if common[i] != id {
+			return false
+		}
+
+		i++
+	}
+
+	return true
+}
+
+// sameEntries compares trees ignoring the difference of nil and empty slices.
+func sameEntries(a, b []Entry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		x, y := a[i], b[i]
+		if x.ID != y.ID || x.UID != y.UID || x.IsDir != y.IsDir || modified(&x, &y) ||
+			!x.CreatedAt.Equal(y.CreatedAt) || !x.UpdatedAt.Equal(y.UpdatedAt) || !sameEntries(x.Entries, y.Entries) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func indexOf(ids []int, id int) int {
+	for i := range ids {
+		if ids[i] == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *merger) build(parentID int) []Entry {
+	ids := m.order(parentID)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	entries := make([]Entry, 0, len(ids))
+
+	for _, id := range ids {
+		e := *m.merged[id]
+		e.Entries = m.build(id)
+		entries = append(entries, e)
+	}
+
+	return entries
+}
@@ -0,0 +1,187 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestMerge(t *testing.T) {
+	newManager := func(configPath string, opts ...favorites2.OptOptionsSetter) *favorites2.Manager {
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40, opts...))
+		require.NoError(t, err)
+		manager.Close()
+
+		return manager
+	}
+
+	execs := func(manager *favorites2.Manager, id int) []string {
+		var result []string
+		for _, e := range manager.ListDirectory(id) {
+			result = append(result, e.Name+":"+e.Exec)
+		}
+
+		return result
+	}
+
+	// setup returns ours and theirs managers sharing the config with the command x and the dir d.
+	setup := func(opts ...favorites2.OptOptionsSetter) (*favorites2.Manager, *favorites2.Manager, int, int) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		ours := newManager(configPath, opts...)
+
+		x, err := ours.AddCommand("x", "v1", 0, 0)
+		require.NoError(t, err)
+		d, err := ours.AddDir("d", 0, 0)
+		require.NoError(t, err)
+		ours.SyncOut()
+
+		return ours, newManager(configPath, opts...), x, d
+	}
+
+	t.Run("unchanged file keeps local changes", func(t *testing.T) {
+		ours, _, _, _ := setup()
+
+		_, err := ours.AddCommand("y", "true", 0, 0)
+		require.NoError(t, err)
+		ours.SyncIn()
+		require.Equal(t, []string{"x:v1", "d:", "y:true"}, execs(ours, 0))
+	})
+
+	t.Run("additions on both sides", func(t *testing.T) {
+		ours, theirs, x, _ := setup()
+
+		theirsID, err := theirs.AddCommand("b", "theirs", 0, x)
+		require.NoError(t, err)
+		theirs.SyncOut()
+
+		oursID, err := ours.AddCommand("c", "ours", 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, theirsID, oursID)
+		ours.SyncOut()
+
+		require.Equal(t, []string{"b:theirs", "x:v1", "d:", "c:ours"}, execs(ours, 0))
+		require.Len(t, ours.Conflicts(), 1)
+		require.Contains(t, ours.Conflicts()[0].String(), "added on both sides")
+		require.Empty(t, ours.CheckIntegrity())
+
+		_, err = ours.GetEntry(theirsID)
+		require.NoError(t, err)
+
+		theirs.SyncIn()
+		require.Equal(t, execs(ours, 0), execs(theirs, 0))
+	})
+
+	t.Run("changes of different fields", func(t *testing.T) {
+		ours, theirs, x, d := setup()
+
+		require.NoError(t, theirs.ModifyExec(x, "v2"))
+		theirs.SyncOut()
+
+		require.NoError(t, ours.RenameEntry(x, "renamed"))
+		require.NoError(t, ours.MoveEntry(x, d, 0))
+		ours.SyncIn()
+
+		require.Equal(t, []string{"renamed:v2"}, execs(ours, d))
+		require.Empty(t, ours.Conflicts())
+	})
+
+	t.Run("conflict policies", func(t *testing.T) {
+		for _, tc := range []struct {
+			policy favorites2.MergePolicy
+			want   []string
+		}{
+			{favorites2.MergeKeepBoth, []string{"x:theirs", "x:ours", "d:"}},
+			{favorites2.MergeOurs, []string{"x:ours", "d:"}},
+			{favorites2.MergeTheirs, []string{"x:theirs", "d:"}},
+		} {
+			ours, theirs, x, _ := setup(favorites2.WithMergePolicy(tc.policy))
+
+			require.NoError(t, theirs.ModifyExec(x, "theirs"))
+			theirs.SyncOut()
+
+			require.NoError(t, ours.ModifyExec(x, "ours"))
+			ours.SyncIn()
+
+			require.Equal(t, tc.want, execs(ours, 0))
+			require.Len(t, ours.Conflicts(), 1)
+			require.Equal(t, x, ours.Conflicts()[0].ID)
+		}
+	})
+
+	t.Run("delete and change", func(t *testing.T) {
+		for _, tc := range []struct {
+			policy favorites2.MergePolicy
+			want   []string
+		}{
+			{favorites2.MergeKeepBoth, []string{"x:theirs", "d:"}},
+			{favorites2.MergeOurs, []string{"d:"}},
+		} {
+			ours, theirs, x, _ := setup(favorites2.WithMergePolicy(tc.policy))
+
+			require.NoError(t, theirs.ModifyExec(x, "theirs"))
+			theirs.SyncOut()
+
+			require.NoError(t, ours.DeleteCommand(x))
+			ours.SyncIn()
+
+			require.Equal(t, tc.want, execs(ours, 0))
+		}
+
+		ours, theirs, x, _ := setup()
+
+		require.NoError(t, theirs.DeleteCommand(x))
+		theirs.SyncOut()
+		ours.SyncIn()
+		require.Equal(t, []string{"d:"}, execs(ours, 0))
+		require.Empty(t, ours.Conflicts())
+	})
+
+	t.Run("added to a deleted dir", func(t *testing.T) {
+		ours, theirs, _, d := setup()
+
+		require.NoError(t, theirs.DeleteDir(d))
+		theirs.SyncOut()
+
+		_, err := ours.AddCommand("y", "true", d, 0)
+		require.NoError(t, err)
+		ours.SyncIn()
+
+		require.Equal(t, []string{"x:v1", "d:"}, execs(ours, 0))
+		require.Equal(t, []string{"y:true"}, execs(ours, d))
+		require.Empty(t, ours.CheckIntegrity())
+	})
+
+	t.Run("moves into each other", func(t *testing.T) {
+		ours, theirs, _, d := setup()
+
+		e, err := theirs.AddDir("e", 0, 0)
+		require.NoError(t, err)
+		theirs.SyncOut()
+		ours.SyncIn()
+
+		require.NoError(t, theirs.MoveEntry(d, e, 0))
+		theirs.SyncOut()
+
+		require.NoError(t, ours.MoveEntry(e, d, 0))
+		ours.SyncIn()
+
+		require.Empty(t, ours.CheckIntegrity())
+		require.NotEmpty(t, ours.Conflicts())
+
+		path, err := ours.EntryPath(e)
+		require.NoError(t, err)
+		require.Equal(t, "/e", path)
+
+		path, err = ours.EntryPath(d)
+		require.NoError(t, err)
+		require.Equal(t, "/e/d", path)
+	})
+}
@@ -0,0 +1,332 @@
+package favorites
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParamType is a type of a command parameter value.
+type ParamType string
+
+const (
+	ParamString ParamType = "string"
+	ParamInt    ParamType = "int"
+	ParamBool   ParamType = "bool"
+)
+
+var (
+	// placeholderRe matches {{name}} and {{name:default}} in Exec.
+	placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*(?::([^}]*))?\}\}`)
+	paramNameRe   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	// doubleQuoteEscaper escapes the characters special inside double quotes.
+	doubleQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+)
+
+// Param is a declaration of an Exec placeholder. Empty Type means ParamString. An empty Default
+// means there is no default, unless Optional is set.
+type Param struct {
+	Name     string    `yaml:"name" json:"name" toml:"name"`
+	Type     ParamType `yaml:"type,omitempty" json:"type,omitempty" toml:"type,omitempty"`
+	Default  string    `yaml:"default,omitempty" json:"default,omitempty" toml:"default,omitempty"`
+	Optional bool      `yaml:"optional,omitempty" json:"optional,omitempty" toml:"optional,omitempty"`
+	Choices  []string  `yaml:"choices,omitempty" json:"choices,omitempty" toml:"choices,omitempty"`
+	Pattern  string    `yaml:"pattern,omitempty" json:"pattern,omitempty" toml:"pattern,omitempty"`
+}
+
+// Required reports whether a value has to be supplied for the parameter.
+func (p Param) Required() bool {
+	return p.Default == "" && !p.Optional
+}
+
+// Validate checks the declaration itself and its default value.
+func (p Param) Validate() error {
+	if !paramNameRe.MatchString(p.Name) {
+		return fmt.Errorf("name %q: %w", p.Name, ErrInvalidParam)
+	}
+
+	switch p.Type {
+	case "", ParamString, ParamInt, ParamBool:
+	default:
+		return fmt.Errorf("%s: type %q: %w", p.Name, p.Type, ErrInvalidParam)
+	}
+
+	if _, err := regexp.Compile(p.Pattern); err != nil {
+		return fmt.Errorf("%s: pattern %q: %v: %w", p.Name, p.Pattern, err, ErrInvalidParam) //nolint:errorlint
+	}
+
+	for _, choice := range p.Choices {
+		if err := p.check(choice, false); err != nil {
+			return err
+		}
+	}
+
+	if !p.Required() {
+		return p.ValidateValue(p.Default)
+	}
+
+	return nil
+}
+
+// ValidateValue checks the value against the parameter type, choices and pattern.
+func (p Param) ValidateValue(value string) error {
+	return p.check(value, true)
+}
+
+func (p Param) check(value string, withChoices bool) error {
+	switch p.Type {
+	case ParamInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%s: %q is not an int: %w", p.Name, value, ErrInvalidParam)
+		}
+	case ParamBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s: %q is not a bool: %w", p.Name, value, ErrInvalidParam)
+		}
+	case "", ParamString:
+	}
+
+	if p.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+		if err != nil || !re.MatchString(value) {
+			return fmt.Errorf("%s: %q does not match %q: %w", p.Name, value, p.Pattern, ErrInvalidParam)
+		}
+	}
+
+	if withChoices && len(p.Choices) > 0 {
+		for _, choice := range p.Choices {
+			if choice == value {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%s: %q is not one of %v: %w", p.Name, value, p.Choices, ErrInvalidParam)
+	}
+
+	return nil
+}
+
+// cloneParams returns a copy of the params sharing no slices with them.
+func cloneParams(params []Param) []Param {
+	if params == nil {
+		return nil
+	}
+
+	clone := make([]Param, len(params))
+	for i, p := range params {
+		p.Choices = append([]string(nil), p.Choices...)
+		clone[i] = p
+	}
+
+	return clone
+}
+
+// ParseParams returns parameters used by the exec template in order of appearance.
+// Declarations complete the placeholders, inline defaults are used when a declaration has none.
+// An empty inline default, like {{flags:}}, makes the parameter Optional.
+func ParseParams(exec string, declared []Param) []Param {
+	byName := make(map[string]Param, len(declared))
+	for _, p := range declared {
+		byName[p.Name] = p
+	}
+
+	var params []Param
+
+	seen := make(map[string]bool)
+
+	for _, match := range placeholderRe.FindAllStringSubmatchIndex(exec, -1) {
+		name := exec[match[2]:match[3]]
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		p, ok := byName[name]
+		if !ok {
+			p = Param{Name: name, Type: ParamString} //nolint:exhaustruct
+		}
+
+		// The default group is unmatched, -1, for a placeholder without a colon.
+		if p.Required() && match[4] >= 0 {
+			p.Default = exec[match[4]:match[5]]
+			p.Optional = p.Default == ""
+		}
+
+		params = append(params, p)
+	}
+
+	return params
+}
+
+// RenderExec substitutes values into the exec template, quoted for a POSIX shell like /bin/sh
+// so that a value is always a literal: a placeholder outside quotes becomes a single word, or
+// nothing if the value is empty, and one inside single or double quotes stays inside them.
+// A value passed on to another shell, like the remote command of ssh, is parsed by that shell
+// again and is not protected.
+func RenderExec(exec string, declared []Param, values map[string]string) (string, error) {
+	return renderExec(exec, declared, values, true)
+}
+
+// renderExec is RenderExec inserting the values verbatim unless quote, for non-POSIX shells.
+func renderExec(exec string, declared []Param, values map[string]string, quote bool) (string, error) {
+	params := ParseParams(exec, declared)
+	resolved := make(map[string]string, len(params))
+
+	for _, p := range params {
+		value, ok := values[p.Name]
+		if !ok {
+			if p.Required() {
+				return "", fmt.Errorf("%s: %w", p.Name, ErrMissingParam)
+			}
+
+			value = p.Default
+		}
+
+		if err := p.ValidateValue(value); err != nil {
+			return "", err
+		}
+
+		resolved[p.Name] = value
+	}
+
+	for name := range values {
+		if _, ok := resolved[name]; !ok {
+			return "", fmt.Errorf("%s: %w", name, ErrUnknownParam)
+		}
+	}
+
+	var (
+		b       strings.Builder
+		scanner shellScanner
+		last    int
+	)
+
+	for _, match := range placeholderRe.FindAllStringSubmatchIndex(exec, -1) {
+		start, end := match[0], match[1]
+		scanner.scan(exec[last:start])
+		b.WriteString(exec[last:start])
+
+		value := resolved[exec[match[2]:match[3]]]
+		if quote {
+			value = scanner.quote(value)
+		}
+
+		b.WriteString(value)
+
+		last = end
+	}
+
+	b.WriteString(exec[last:])
+
+	return b.String(), nil
+}
+
+// shellScanner tracks the quoting of a POSIX shell command as it is read.
+type shellScanner struct {
+	single, double, escaped bool
+}
+
+func (s *shellScanner) scan(text string) {
+	for _, r := range text {
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case s.single:
+			s.single = r != '\''
+		case r == '\\':
+			s.escaped = true
+		case s.double:
+			s.double = r != '"'
+		case r == '\'':
+			s.single = true
+		case r == '"':
+			s.double = true
+		}
+	}
+}
+
+// quote returns the value quoted for the current position, so the shell reads it literally.
+func (s *shellScanner) quote(value string) string {
+	switch {
+	case s.single:
+		return strings.ReplaceAll(value, "'", `'\''`)
+	case s.double:
+		return doubleQuoteEscaper.Replace(value)
+	case strings.IndexFunc(value, needsQuoting) == -1:
+		return value
+	default:
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	}
+}
+
+// needsQuoting reports whether the rune has to be quoted outside quotes.
+func needsQuoting(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_./:@%+,", r)
+}
+
+// Params lists the parameters of the command, of the target if it is a link, see ParseParams.
+func (m *Manager) Params(id int) ([]Param, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.followLink(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseParams(node.Value.Exec, cloneParams(node.Value.Params)), nil
+}
+
+// SetParams replaces parameter declarations of the command, of the target if it is a link.
+func (m *Manager) SetParams(id int, params []Param) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setParams(id, params)
+}
+
+func (m *Manager) setParams(id int, params []Param) error {
+	node, err := m.getLinkedCommand(id)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(params))
+
+	for _, p := range params {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+
+		if seen[p.Name] {
+			return fmt.Errorf("%s: duplicate declaration: %w", p.Name, ErrInvalidParam)
+		}
+
+		seen[p.Name] = true
+	}
+
+	defer m.notifySinker()
+
+	before := m.state(node, false)
+	node.Value.Params = cloneParams(params)
+	m.recordPut(node)
+	m.record(OpSetParams, HistoryChange{Before: before, After: m.state(node, false)}) //nolint:exhaustruct
+
+	return nil
+}
+
+// Render returns the command's Exec, the target's one for a link, with the values substituted, see RenderExec.
+func (m *Manager) Render(id int, values map[string]string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.followLink(id)
+	if err != nil {
+		return "", err
+	}
+
+	return renderExec(node.Value.Exec, node.Value.Params, values, !m.opts.rawParams)
+}
@@ -0,0 +1,200 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestRenderExec(t *testing.T) {
+	exec := "ssh {{host}} 'cd repo && git checkout {{branch:main}} && make -j{{jobs:4}}' # {{host}}"
+	declared := []favorites2.Param{
+		{Name: "host", Type: favorites2.ParamString, Choices: []string{"db1", "db2"}},
+		{Name: "jobs", Type: favorites2.ParamInt, Pattern: "[1-8]"},
+	}
+
+	t.Run("list params", func(t *testing.T) {
+		params := favorites2.ParseParams(exec, declared)
+		require.Len(t, params, 3)
+		require.Equal(t, "host", params[0].Name)
+		require.True(t, params[0].Required())
+		require.Equal(t, "branch", params[1].Name)
+		require.Equal(t, "main", params[1].Default)
+		require.False(t, params[1].Required())
+		require.Equal(t, favorites2.ParamInt, params[2].Type)
+		require.Equal(t, "4", params[2].Default)
+	})
+
+	t.Run("render with defaults", func(t *testing.T) {
+		command, err := favorites2.RenderExec(exec, declared, map[string]string{"host": "db1"})
+		require.NoError(t, err)
+		require.Equal(t, "ssh db1 'cd repo && git checkout main && make -j4' # db1", command)
+	})
+
+	t.Run("render with values", func(t *testing.T) {
+		command, err := favorites2.RenderExec(exec, declared, map[string]string{"host": "db2", "branch": "dev", "jobs": "8"})
+		require.NoError(t, err)
+		require.Equal(t, "ssh db2 'cd repo && git checkout dev && make -j8' # db2", command)
+	})
+
+	t.Run("missing param", func(t *testing.T) {
+		_, err := favorites2.RenderExec(exec, declared, nil)
+		require.ErrorIs(t, err, favorites2.ErrMissingParam)
+	})
+
+	t.Run("unknown param", func(t *testing.T) {
+		_, err := favorites2.RenderExec(exec, declared, map[string]string{"host": "db1", "hots": "db1"})
+		require.ErrorIs(t, err, favorites2.ErrUnknownParam)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		for _, values := range []map[string]string{
+			{"host": "db3"},
+			{"host": "db1", "jobs": "four"},
+			{"host": "db1", "jobs": "9"},
+		} {
+			_, err := favorites2.RenderExec(exec, declared, values)
+			require.ErrorIs(t, err, favorites2.ErrInvalidParam)
+		}
+	})
+
+	t.Run("no placeholders", func(t *testing.T) {
+		command, err := favorites2.RenderExec("docker ps --format '{{.Names}}'", nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, "docker ps --format '{{.Names}}'", command)
+	})
+
+	t.Run("values are quoted", func(t *testing.T) {
+		for template, want := range map[string]string{
+			"echo {{x}}":         `echo '; rm -rf ~'\''s'`,
+			"echo '{{x}}'":       `echo '; rm -rf ~'\''s'`,
+			`echo "{{x}} $HOME"`: `echo "; rm -rf ~'s $HOME"`,
+			`echo \'{{x}}`:       `echo \''; rm -rf ~'\''s'`,
+		} {
+			command, err := favorites2.RenderExec(template, nil, map[string]string{"x": "; rm -rf ~'s"})
+			require.NoError(t, err)
+			require.Equal(t, want, command, template)
+		}
+
+		values := map[string]string{"x": "$(id) `id` \\ \"", "y": ""}
+		command, err := favorites2.RenderExec(`echo "{{x}}" {{y}}`, nil, values)
+		require.NoError(t, err)
+		require.Equal(t, "echo \"\\$(id) \\`id\\` \\\\ \\\"\" ", command)
+	})
+
+	t.Run("empty defaults", func(t *testing.T) {
+		params := favorites2.ParseParams("ls {{flags:}} {{dir}}", []favorites2.Param{{Name: "dir", Optional: true}})
+		require.False(t, params[0].Required())
+		require.True(t, params[0].Optional)
+		require.False(t, params[1].Required())
+
+		command, err := favorites2.RenderExec("ls {{flags:}} {{dir}}", []favorites2.Param{{Name: "dir", Optional: true}}, nil)
+		require.NoError(t, err)
+		require.Equal(t, "ls  ", command)
+
+		command, err = favorites2.RenderExec("ls {{flags:}}", nil, map[string]string{"flags": "-la"})
+		require.NoError(t, err)
+		require.Equal(t, "ls -la", command)
+
+		require.ErrorIs(t, favorites2.Param{Name: "n", Type: favorites2.ParamInt, Optional: true}.Validate(),
+			favorites2.ErrInvalidParam)
+	})
+
+	t.Run("invalid declarations", func(t *testing.T) {
+		for _, p := range []favorites2.Param{
+			{Name: "bad name"},
+			{Name: "x", Type: "float"},
+			{Name: "x", Pattern: "("},
+			{Name: "x", Type: favorites2.ParamBool, Default: "maybe"},
+			{Name: "x", Choices: []string{"a"}, Default: "b"},
+		} {
+			require.ErrorIs(t, p.Validate(), favorites2.ErrInvalidParam)
+		}
+
+		err := favorites2.Param{Name: "x", Pattern: "("}.Validate()
+		require.ErrorContains(t, err, `pattern "(": error parsing regexp: missing closing )`)
+	})
+}
+
+func TestManagerParams(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+	manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+		favorites2.NewOptions(false, configPath, time.Minute, 40))
+	require.NoError(t, err)
+	manager.Close()
+
+	id, err := manager.AddCommand("checkout", "git checkout {{branch:main}}", 0, 0)
+	require.NoError(t, err)
+
+	params := []favorites2.Param{{Name: "branch", Choices: []string{"main", "dev"}}}
+
+	require.ErrorIs(t, manager.SetParams(id, []favorites2.Param{{Name: "branch", Type: "list"}}), favorites2.ErrInvalidParam)
+	require.ErrorIs(t, manager.SetParams(1000, params), favorites2.ErrNotFound)
+	require.NoError(t, manager.SetParams(id, params))
+
+	manager.SyncOut()
+	manager.SyncIn()
+
+	require.Equal(t, params, manager.ListDirectory(0)[0].Params)
+
+	listed, err := manager.Params(id)
+	require.NoError(t, err)
+	require.Equal(t, "main", listed[0].Default)
+
+	command, err := manager.Render(id, map[string]string{"branch": "dev"})
+	require.NoError(t, err)
+	require.Equal(t, "git checkout dev", command)
+
+	_, err = manager.Render(id, map[string]string{"branch": "feature"})
+	require.ErrorIs(t, err, favorites2.ErrInvalidParam)
+
+	raw, err := favorites2.NewManager(context.Background(), logrus.New(),
+		favorites2.NewOptions(true, "rubbish", time.Minute, 40, favorites2.WithRawParams(true)))
+	require.NoError(t, err)
+
+	id, err = raw.AddCommand("echo", "echo {{text}}", 0, 0)
+	require.NoError(t, err)
+	command, err = raw.Render(id, map[string]string{"text": "a b"})
+	require.NoError(t, err)
+	require.Equal(t, "echo a b", command)
+}
+
+func TestParamsAreCopied(t *testing.T) {
+	manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+		favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+	require.NoError(t, err)
+
+	id, err := manager.AddCommand("checkout", "git checkout {{branch}}", 0, 0)
+	require.NoError(t, err)
+
+	params := []favorites2.Param{{Name: "branch", Choices: []string{"main", "dev"}}}
+	require.NoError(t, manager.SetParams(id, params))
+
+	params[0].Choices[0] = "changed"
+
+	entry, err := manager.GetEntry(id)
+	require.NoError(t, err)
+	entry.Params[0].Name = "changed"
+	entry.Params[0].Choices[1] = "changed"
+
+	listed := manager.ListDirectory(0)
+	require.Equal(t, []favorites2.Param{{Name: "branch", Choices: []string{"main", "dev"}}}, listed[0].Params)
+
+	declared, err := manager.Params(id)
+	require.NoError(t, err)
+	declared[0].Choices[0] = "changed"
+
+	require.NoError(t, manager.Undo())
+	require.NoError(t, manager.Redo())
+
+	entry, err = manager.GetEntry(id)
+	require.NoError(t, err)
+	require.Equal(t, []favorites2.Param{{Name: "branch", Choices: []string{"main", "dev"}}}, entry.Params)
+}
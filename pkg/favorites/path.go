@@ -0,0 +1,275 @@
+package favorites
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/list"
+)
+
+// DuplicatePolicy defines how a path resolves when a directory has several entries with the same name.
+type DuplicatePolicy int
+
+const (
+	// DuplicateFirst resolves to the first entry in the directory order.
+	DuplicateFirst DuplicatePolicy = iota
+	// DuplicateError fails with ErrAmbiguousPath.
+	DuplicateError
+)
+
+const (
+	pathSeparator = '/'
+	pathEscape    = '\\'
+)
+
+// SplitPath splits a slash-separated path into names. A slash or a backslash inside a name
+// is escaped with a backslash. Empty segments are skipped, so "", "/" and "//" all denote the root.
+func SplitPath(p string) ([]string, error) {
+	var (
+		names   []string
+		current strings.Builder
+		escaped bool
+	)
+
+	for _, r := range p {
+		switch {
+		case escaped:
+			if r != pathSeparator && r != pathEscape {
+				return nil, fmt.Errorf("%q: unknown escape sequence: %w", p, ErrInvalidPath)
+			}
+
+			current.WriteRune(r)
+
+			escaped = false
+		case r == pathEscape:
+			escaped = true
+		case r == pathSeparator:
+			if current.Len() > 0 {
+				names = append(names, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("%q: trailing backslash: %w", p, ErrInvalidPath)
+	}
+
+	if current.Len() > 0 {
+		names = append(names, current.String())
+	}
+
+	return names, nil
+}
+
+// JoinPath builds an absolute path from names, escaping them as needed.
+func JoinPath(names ...string) string {
+	var b strings.Builder
+
+	for _, name := range names {
+		b.WriteRune(pathSeparator)
+
+		for _, r := range name {
+			if r == pathSeparator || r == pathEscape {
+				b.WriteRune(pathEscape)
+			}
+
+			b.WriteRune(r)
+		}
+	}
+
+	if b.Len() == 0 {
+		return string(pathSeparator)
+	}
+
+	return b.String()
+}
+
+// ResolvePath returns the ID of the entry at the path. The root has ID 0.
+func (m *Manager) ResolvePath(p string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.resolvePath(p)
+}
+
+func (m *Manager) resolvePath(p string) (int, error) {
+	names, err := SplitPath(p)
+	if err != nil {
+		return 0, err
+	}
+
+	id := 0
+
+	for i, name := range names {
+		if id != 0 && !m.getEntryByID(id).Value.IsDir {
+			return 0, fmt.Errorf("%s: %w", JoinPath(names[:i+1]...), ErrNotFound)
+		}
+
+		node, err := m.findChild(m.getDirByID(id), name)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", JoinPath(names[:i+1]...), err)
+		}
+
+		id = node.Value.ID
+	}
+
+	return id, nil
+}
+
+func (m *Manager) findChild(dir *list.DeLinkedList[entry], name string) (*list.Node[entry], error) {
+	var found *list.Node[entry]
+
+	for node := dir.Head; node != nil; node = node.Next {
+		if node.Value.Name != name {
+			continue
+		}
+
+		if found == nil {
+			found = node
+
+			if m.opts.duplicatePolicy == DuplicateFirst {
+				break
+			}
+
+			continue
+		}
+
+		return nil, ErrAmbiguousPath
+	}
+
+	if found == nil {
+		return nil, ErrNotFound
+	}
+
+	return found, nil
+}
+
+// EntryPath returns the path of the entry. Unnamed commands are addressable by ID only, so
+// it fails with ErrInvalidPath for them and the entries of unnamed dirs.
+func (m *Manager) EntryPath(id int) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var names []string
+
+	for current := id; current != 0; {
+		node := m.getEntryByID(current)
+		if node == nil {
+			return "", fmt.Errorf("entry %d: %w", current, ErrNotFound)
+		}
+
+		if node.Value.Name == "" {
+			return "", fmt.Errorf("entry %d has no name: %w", current, ErrInvalidPath)
+		}
+
+		names = append(names, node.Value.Name)
+		current = node.Value.ParentID
+	}
+
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+
+	return JoinPath(names...), nil
+}
+
+// resolvePaths resolves several paths at once, an empty path resolves to ID 0.
+func (m *Manager) resolvePaths(paths ...string) ([]int, error) {
+	ids := make([]int, len(paths))
+
+	for i, p := range paths {
+		if p == "" {
+			continue
+		}
+
+		id, err := m.resolvePath(p)
+		if err != nil {
+			return nil, err
+		}
+
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+// AddCommandByPath is AddCommand addressing the parent dir and the next sibling by path.
+// Empty nextPath appends the command to the end of the directory.
+func (m *Manager) AddCommandByPath(name, exec, parentPath, nextPath string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids, err := m.resolvePaths(parentPath, nextPath)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.addCommand(name, exec, ids[0], ids[1])
+}
+
+// AddDirByPath is AddDir addressing the parent dir and the next sibling by path.
+func (m *Manager) AddDirByPath(name, parentPath, nextPath string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids, err := m.resolvePaths(parentPath, nextPath)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.addDir(name, ids[0], ids[1])
+}
+
+// MoveEntryByPath is MoveEntry addressing all the entries by path.
+func (m *Manager) MoveEntryByPath(targetPath, parentPath, nextPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids, err := m.resolvePaths(targetPath, parentPath, nextPath)
+	if err != nil {
+		return err
+	}
+
+	if ids[0] == 0 {
+		return fmt.Errorf("%q: %w", targetPath, ErrInvalidPath)
+	}
+
+	return m.moveEntry(ids[0], ids[1], ids[2])
+}
+
+// DeleteDirByPath is DeleteDir addressing the dir by path.
+func (m *Manager) DeleteDirByPath(p string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, err := m.resolvePath(p)
+	if err != nil {
+		return err
+	}
+
+	if id == 0 {
+		return fmt.Errorf("%q: %w", p, ErrInvalidPath)
+	}
+
+	return m.deleteDirByID(id)
+}
+
+// ListDirectoryByPath is ListDirectory addressing the dir by path.
+func (m *Manager) ListDirectoryByPath(p string) ([]Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, err := m.resolvePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if node := m.getEntryByID(id); node != nil && !node.Value.IsDir {
+		return nil, fmt.Errorf("%s: %w", p, ErrNotADirectory)
+	}
+
+	return m.listDirectory(id), nil
+}
@@ -0,0 +1,156 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestSplitPath(t *testing.T) {
+	for p, expected := range map[string][]string{
+		"":                  nil,
+		"/":                 nil,
+		"/ops/db/backup":    {"ops", "db", "backup"},
+		"ops//db/":          {"ops", "db"},
+		`/net/tcp\/udp`:     {"net", "tcp/udp"},
+		`/win/c:\\\\users`:  {"win", `c:\\users`},
+		`/a\/b\\/c`:         {"a/b\\", "c"},
+		"/имя с пробелами/": {"имя с пробелами"},
+	} {
+		names, err := favorites2.SplitPath(p)
+		require.NoError(t, err, p)
+		require.Equal(t, expected, names, p)
+
+		if len(expected) > 0 {
+			again, err := favorites2.SplitPath(favorites2.JoinPath(names...))
+			require.NoError(t, err, p)
+			require.Equal(t, expected, again, p)
+		}
+	}
+
+	for _, p := range []string{`/a\`, `/a\b`} {
+		_, err := favorites2.SplitPath(p)
+		require.ErrorIs(t, err, favorites2.ErrInvalidPath, p)
+	}
+
+	require.Equal(t, "/", favorites2.JoinPath())
+	require.Equal(t, `/net/tcp\/udp`, favorites2.JoinPath("net", "tcp/udp"))
+}
+
+func TestManagerPaths(t *testing.T) {
+	newManager := func(policy favorites2.DuplicatePolicy) *favorites2.Manager {
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40, favorites2.WithDuplicatePolicy(policy)))
+		require.NoError(t, err)
+
+		_, err = manager.AddDirByPath("ops", "/", "")
+		require.NoError(t, err)
+		_, err = manager.AddDirByPath("db", "/ops", "")
+		require.NoError(t, err)
+		_, err = manager.AddCommandByPath("backup", "pg_dump", "/ops/db", "")
+		require.NoError(t, err)
+		_, err = manager.AddCommandByPath("restore", "pg_restore", "/ops/db", "/ops/db/backup")
+		require.NoError(t, err)
+		_, err = manager.AddDirByPath("tcp/udp", "/ops", "")
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	manager := newManager(favorites2.DuplicateFirst)
+
+	t.Run("resolve", func(t *testing.T) {
+		id, err := manager.ResolvePath("/")
+		require.NoError(t, err)
+		require.Equal(t, 0, id)
+
+		id, err = manager.ResolvePath("/ops/db/backup")
+		require.NoError(t, err)
+
+		entry, err := manager.GetEntry(id)
+		require.NoError(t, err)
+		require.Equal(t, "pg_dump", entry.Exec)
+
+		p, err := manager.EntryPath(id)
+		require.NoError(t, err)
+		require.Equal(t, "/ops/db/backup", p)
+
+		id, err = manager.ResolvePath(`ops/tcp\/udp`)
+		require.NoError(t, err)
+
+		p, err = manager.EntryPath(id)
+		require.NoError(t, err)
+		require.Equal(t, `/ops/tcp\/udp`, p)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		for _, p := range []string{"/nope", "/ops/nope", "/ops/db/backup/deeper"} {
+			_, err := manager.ResolvePath(p)
+			require.ErrorIs(t, err, favorites2.ErrNotFound, p)
+		}
+
+		_, err := manager.AddCommandByPath("x", "true", "/nope", "")
+		require.ErrorIs(t, err, favorites2.ErrNotFound)
+
+		_, err = manager.ListDirectoryByPath("/ops/db/backup")
+		require.ErrorIs(t, err, favorites2.ErrNotADirectory)
+
+		unnamed, err := manager.AddCommandByPath("", "true", "/ops", "")
+		require.NoError(t, err)
+		_, err = manager.EntryPath(unnamed)
+		require.ErrorIs(t, err, favorites2.ErrInvalidPath)
+		require.NoError(t, manager.DeleteCommand(unnamed))
+	})
+
+	t.Run("list and order", func(t *testing.T) {
+		list, err := manager.ListDirectoryByPath("/ops/db")
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		require.Equal(t, "restore", list[0].Name)
+		require.Equal(t, "backup", list[1].Name)
+	})
+
+	t.Run("move", func(t *testing.T) {
+		require.NoError(t, manager.MoveEntryByPath("/ops/db/restore", "/", "/ops"))
+		list, err := manager.ListDirectoryByPath("/")
+		require.NoError(t, err)
+		require.Equal(t, "restore", list[0].Name)
+		require.ErrorIs(t, manager.MoveEntryByPath("/", "/ops", ""), favorites2.ErrInvalidPath)
+	})
+
+	t.Run("delete dir", func(t *testing.T) {
+		require.NoError(t, manager.DeleteDirByPath("/ops/db"))
+		_, err := manager.ResolvePath("/ops/db/backup")
+		require.ErrorIs(t, err, favorites2.ErrNotFound)
+		require.ErrorIs(t, manager.DeleteDirByPath("/"), favorites2.ErrInvalidPath)
+	})
+
+	t.Run("duplicates", func(t *testing.T) {
+		first := newManager(favorites2.DuplicateFirst)
+		_, err := first.AddCommandByPath("backup", "pg_basebackup", "/ops/db", "")
+		require.NoError(t, err)
+
+		id, err := first.ResolvePath("/ops/db/backup")
+		require.NoError(t, err)
+
+		entry, err := first.GetEntry(id)
+		require.NoError(t, err)
+		require.Equal(t, "pg_dump", entry.Exec)
+
+		strict := newManager(favorites2.DuplicateError)
+		_, err = strict.AddCommandByPath("backup", "pg_basebackup", "/ops/db", "")
+		require.NoError(t, err)
+
+		_, err = strict.ResolvePath("/ops/db/backup")
+		require.ErrorIs(t, err, favorites2.ErrAmbiguousPath)
+
+		_, err = strict.ResolvePath("/ops/db/restore")
+		require.NoError(t, err)
+	})
+}
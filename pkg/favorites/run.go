@@ -0,0 +1,176 @@
+package favorites
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// RunResult is an outcome of a command execution.
+type RunResult struct {
+	ID       int           `json:"id"`
+	Command  string        `json:"command"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	ExitCode int           `json:"exitCode"`
+	Duration time.Duration `json:"duration"`
+	TimedOut bool          `json:"timedOut"`
+}
+
+// RunOption overrides manager-wide run settings for a single call.
+type RunOption func(cfg *runConfig)
+
+type runConfig struct {
+	dir     string
+	env     []string
+	timeout time.Duration
+	values  map[string]string
+}
+
+// RunInDir sets the working directory of the command.
+func RunInDir(dir string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.dir = dir
+	}
+}
+
+// RunWithEnv appends variables in "KEY=value" form to the command environment.
+func RunWithEnv(env ...string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.env = append(cfg.env, env...)
+	}
+}
+
+// RunWithTimeout limits the command execution time. Zero means no limit.
+func RunWithTimeout(timeout time.Duration) RunOption {
+	return func(cfg *runConfig) {
+		cfg.timeout = timeout
+	}
+}
+
+// RunWithParams supplies values for the command placeholders, see RenderExec.
+func RunWithParams(values map[string]string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.values = values
+	}
+}
+
+// Run executes the entry's Exec with the configured shell. A non-zero exit code is not an error,
+// it is reported in the result. On timeout or cancellation the whole process group is killed.
+// A link runs its target, the use is recorded for the target once the process has started, the
+// result is nil if it has not. Values of the placeholders are quoted,
+// see RenderExec, unless WithRawParams is set for a shell which is not POSIX.
+func (m *Manager) Run(ctx context.Context, id int, opts ...RunOption) (*RunResult, error) {
+	m.mu.RLock()
+	node, err := m.followLink(id)
+
+	var (
+		command  string
+		params   []Param
+		targetID int
+	)
+
+	if err == nil {
+		command, params, targetID = node.Value.Exec, node.Value.Params, node.Value.ID
+	}
+
+	isDir := err == nil && node.Value.IsDir
+	m.mu.RUnlock()
+
+	switch {
+	case err != nil:
+		return nil, err
+	case isDir:
+		return nil, fmt.Errorf("entry %d: %w", id, ErrNotACommand)
+	case command == "":
+		return nil, fmt.Errorf("entry %d: %w", id, ErrEmptyCommand)
+	}
+
+	cfg := runConfig{
+		dir:     m.opts.workDir,
+		env:     append([]string(nil), m.opts.env...),
+		timeout: m.opts.runTimeout,
+		values:  nil,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	command, err = renderExec(command, params, cfg.values, !m.opts.rawParams)
+	if err != nil {
+		return nil, fmt.Errorf("entry %d: %w", id, err)
+	}
+
+	result, err := m.runCommand(ctx, id, command, cfg)
+	if result == nil {
+		return nil, fmt.Errorf("entry %d: %w", id, err)
+	}
+
+	// The entry may have been deleted while the command ran, its use is not recorded then.
+	_ = m.RecordUse(targetID, useDir(cfg.dir))
+
+	return result, err
+}
+
+func (m *Manager) runCommand(ctx context.Context, id int, command string, cfg runConfig) (*RunResult, error) {
+	runCtx := ctx
+
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+
+		runCtx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(runCtx, m.opts.shell, m.opts.shellFlag, command) //nolint:gosec
+	cmd.Dir = cfg.dir
+	cmd.Env = append(os.Environ(), cfg.env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = killWaitDelay
+	setProcessGroup(cmd)
+
+	start := time.Now()
+
+	err := cmd.Run()
+	if cmd.ProcessState == nil {
+		// The process has not started.
+		return nil, fmt.Errorf("cmd.Run(): %w", err)
+	}
+
+	result := &RunResult{
+		ID:       id,
+		Command:  command,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: cmd.ProcessState.ExitCode(),
+		Duration: time.Since(start),
+		TimedOut: false,
+	}
+
+	if err == nil {
+		return result, nil
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		return result, fmt.Errorf("cmd.Run(): %w", ctx.Err())
+	case runCtx.Err() != nil:
+		result.TimedOut = true
+
+		return result, fmt.Errorf("entry %d after %s: %w", id, cfg.timeout, ErrRunTimeout)
+	}
+
+	exitErr := &exec.ExitError{} //nolint:exhaustruct
+	if !errors.As(err, &exitErr) {
+		return result, fmt.Errorf("cmd.Run(): %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package favorites
+
+import (
+	"os/exec"
+	"time"
+)
+
+const killWaitDelay = 100 * time.Millisecond
+
+// setProcessGroup is a no-op where process groups are not supported: only the shell is killed.
+func setProcessGroup(_ *exec.Cmd) {}
@@ -0,0 +1,129 @@
+//go:build unix
+
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestManagerRun(t *testing.T) {
+	manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+		favorites2.NewOptions(
+			true,
+			"rubbish",
+			time.Minute,
+			40,
+			favorites2.WithEnv([]string{"FAVORITES_GREETING=hello"}),
+		))
+	require.NoError(t, err)
+
+	addCommand := func(exec string) int {
+		id, err := manager.AddCommand("", exec, 0, 0)
+		require.NoError(t, err)
+
+		return id
+	}
+
+	t.Run("capture output and exit code", func(t *testing.T) {
+		id := addCommand("echo out; echo err >&2; exit 3")
+		result, err := manager.Run(context.Background(), id)
+		require.NoError(t, err)
+		require.Equal(t, "out\n", result.Stdout)
+		require.Equal(t, "err\n", result.Stderr)
+		require.Equal(t, 3, result.ExitCode)
+		require.False(t, result.TimedOut)
+	})
+
+	t.Run("environment and working directory", func(t *testing.T) {
+		dir := t.TempDir()
+		id := addCommand(`echo "$FAVORITES_GREETING $FAVORITES_NAME"; pwd`)
+		result, err := manager.Run(context.Background(), id,
+			favorites2.RunInDir(dir), favorites2.RunWithEnv("FAVORITES_NAME=world"))
+		require.NoError(t, err)
+		require.Equal(t, "hello world\n"+dir+"\n", result.Stdout)
+		require.Equal(t, 0, result.ExitCode)
+
+		usage, ok := manager.Usage(id)
+		require.True(t, ok)
+		require.Equal(t, map[string]int{dir: 1}, usage.Dirs)
+	})
+
+	t.Run("params", func(t *testing.T) {
+		id := addCommand("echo {{greeting:hi}} {{name}}")
+		_, err := manager.Run(context.Background(), id)
+		require.ErrorIs(t, err, favorites2.ErrMissingParam)
+		result, err := manager.Run(context.Background(), id, favorites2.RunWithParams(map[string]string{"name": "bob"}))
+		require.NoError(t, err)
+		require.Equal(t, "echo hi bob", result.Command)
+		require.Equal(t, "hi bob\n", result.Stdout)
+
+		values := map[string]string{"name": "$USER; echo x"}
+		result, err = manager.Run(context.Background(), id, favorites2.RunWithParams(values))
+		require.NoError(t, err)
+		require.Equal(t, "hi $USER; echo x\n", result.Stdout)
+	})
+
+	t.Run("links run their target", func(t *testing.T) {
+		id := addCommand("echo {{name:target}}")
+		link, err := manager.AddLink("", id, 0, 0)
+		require.NoError(t, err)
+
+		result, err := manager.Run(context.Background(), link)
+		require.NoError(t, err)
+		require.Equal(t, link, result.ID)
+		require.Equal(t, "target\n", result.Stdout)
+
+		usage, ok := manager.Usage(id)
+		require.True(t, ok)
+		require.Equal(t, 1, usage.Count)
+	})
+
+	t.Run("timeout kills process group", func(t *testing.T) {
+		id := addCommand("sleep 10 & sleep 10")
+		start := time.Now()
+		result, err := manager.Run(context.Background(), id, favorites2.RunWithTimeout(100*time.Millisecond))
+		require.ErrorIs(t, err, favorites2.ErrRunTimeout)
+		require.True(t, result.TimedOut)
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		id := addCommand("sleep 10")
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		result, err := manager.Run(ctx, id)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.False(t, result.TimedOut)
+	})
+
+	t.Run("commands not started are not used", func(t *testing.T) {
+		id := addCommand("true")
+		result, err := manager.Run(context.Background(), id, favorites2.RunInDir(filepath.Join(t.TempDir(), "missing")))
+		require.Error(t, err)
+		require.Nil(t, result)
+
+		_, ok := manager.Usage(id)
+		require.False(t, ok)
+	})
+
+	t.Run("unknown entry", func(t *testing.T) {
+		_, err := manager.Run(context.Background(), 1000)
+		require.ErrorIs(t, err, favorites2.ErrNotFound)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		id, err := manager.AddDir("dir", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.Run(context.Background(), id)
+		require.ErrorIs(t, err, favorites2.ErrNotACommand)
+	})
+}
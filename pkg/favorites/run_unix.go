@@ -0,0 +1,20 @@
+//go:build unix
+
+package favorites
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+const killWaitDelay = 100 * time.Millisecond
+
+// setProcessGroup starts the command in its own process group, so that cancellation
+// kills the shell together with everything it has spawned.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true} //nolint:exhaustruct
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,247 @@
+package favorites
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the version of the config document MarshalDocument writes.
+// UnmarshalDocument upgrades older documents and refuses newer ones. A new field raises the
+// version even when the migration has nothing to convert, so a binary unaware of the field
+// refuses the document instead of saving it back without it.
+//
+// Versions:
+//   - 0: a bare list of entries.
+//   - 1: nextId and entries.
+//   - 2: version and metadata added.
+//   - 3: trash added.
+//   - 4: tags added.
+//   - 5: smart dirs added.
+//   - 6: links added.
+const SchemaVersion = 6
+
+// migrations[i] upgrades a decoded document of version i to version i+1. A version 0
+// document comes as a map with the list under "entries". Numbers are int, int64 or
+// json.Number depending on the format.
+var migrations = []func(doc map[string]any) error{
+	migrateV0,
+	migrateV1,
+	migrateV2,
+	migrateV3,
+	migrateV4,
+	migrateV5,
+}
+
+// migrateV0 stores the ID high-water mark, so IDs of entries deleted since are not reused.
+func migrateV0(doc map[string]any) error {
+	maxID, err := rawMaxID(doc["entries"])
+	if err != nil {
+		return err
+	}
+
+	doc["nextId"] = maxID + 1
+
+	return nil
+}
+
+// migrateV1 has nothing to convert, documents of version 2 just may have metadata.
+func migrateV1(map[string]any) error {
+	return nil
+}
+
+// migrateV2 starts with an empty trash.
+func migrateV2(map[string]any) error {
+	return nil
+}
+
+// migrateV3 leaves the entries untagged.
+func migrateV3(map[string]any) error {
+	return nil
+}
+
+// migrateV4 leaves the dirs plain.
+func migrateV4(map[string]any) error {
+	return nil
+}
+
+// migrateV5 adds no links.
+func migrateV5(map[string]any) error {
+	return nil
+}
+
+func rawMaxID(entries any) (int, error) {
+	if entries == nil {
+		return 0, nil
+	}
+
+	list, ok := entries.([]any)
+	if !ok {
+		return 0, fmt.Errorf("entries: %T: %w", entries, ErrInvalidDocument)
+	}
+
+	var maxID int
+
+	for _, item := range list {
+		e, ok := item.(map[string]any)
+		if !ok {
+			return 0, fmt.Errorf("entry: %T: %w", item, ErrInvalidDocument)
+		}
+
+		id, err := rawInt(e["id"])
+		if err != nil {
+			return 0, fmt.Errorf("entry id: %w", err)
+		}
+
+		childMaxID, err := rawMaxID(e["entries"])
+		if err != nil {
+			return 0, err
+		}
+
+		for _, candidate := range []int{id, childMaxID} {
+			if candidate > maxID {
+				maxID = candidate
+			}
+		}
+	}
+
+	return maxID, nil
+}
+
+func rawInt(value any) (int, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case uint64:
+		return int(v), nil //nolint:gosec
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("%v: %w", v, ErrInvalidDocument)
+		}
+
+		return int(i), nil
+	default:
+		return 0, fmt.Errorf("%T: %w", value, ErrInvalidDocument)
+	}
+}
+
+// upgrade migrates the document encoded in data to SchemaVersion. Returns data as is
+// if it is of the current version.
+func upgrade(data []byte, format Format) ([]byte, error) {
+	raw, err := decodeRaw(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		doc     map[string]any
+		version int
+	)
+
+	switch v := raw.(type) {
+	case []any:
+		doc = map[string]any{"entries": v}
+	case map[string]any:
+		doc = v
+
+		version = 1
+		if rawVersion, ok := v["version"]; ok {
+			if version, err = rawInt(rawVersion); err != nil {
+				return nil, fmt.Errorf("version: %w", err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%T: %w", raw, ErrInvalidDocument)
+	}
+
+	switch {
+	case version == SchemaVersion:
+		return data, nil
+	case version > SchemaVersion:
+		return nil, fmt.Errorf("version %d: %w", version, ErrNewerVersion)
+	case version < 0:
+		return nil, fmt.Errorf("version %d: %w", version, ErrInvalidDocument)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		if err = migrations[version](doc); err != nil {
+			return nil, fmt.Errorf("migration from version %d: %w", version, err)
+		}
+
+		doc["version"] = version + 1
+	}
+
+	return encodeRaw(doc, format)
+}
+
+func decodeRaw(data []byte, format Format) (any, error) {
+	var raw any
+
+	switch format {
+	case FormatAuto, FormatYAML:
+		if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&raw); err != nil {
+			return nil, fmt.Errorf("yaml.NewDecoder(data).Decode(&raw): %w", err)
+		}
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("json.NewDecoder(data).Decode(&raw): %w", err)
+		}
+	case FormatTOML:
+		var doc map[string]any
+
+		meta, err := toml.NewDecoder(bytes.NewReader(data)).Decode(&doc)
+		if err != nil {
+			return nil, fmt.Errorf("toml.NewDecoder(data).Decode(&doc): %w", err)
+		}
+
+		if len(meta.Keys()) == 0 {
+			return nil, fmt.Errorf("toml.NewDecoder(data).Decode(&doc): %w", ErrEmptyDocument)
+		}
+
+		raw = doc
+	default:
+		return nil, fmt.Errorf("%v: %w", format, ErrUnknownFormat)
+	}
+
+	return raw, nil
+}
+
+func encodeRaw(doc map[string]any, format Format) ([]byte, error) {
+	switch format {
+	case FormatAuto, FormatYAML:
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("yaml.Marshal(doc): %w", err)
+		}
+
+		return data, nil
+	case FormatJSON:
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal(doc): %w", err)
+		}
+
+		return data, nil
+	case FormatTOML:
+		var buf bytes.Buffer
+
+		if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+			return nil, fmt.Errorf("toml.NewEncoder(buf).Encode(doc): %w", err)
+		}
+
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("%v: %w", format, ErrUnknownFormat)
+	}
+}
@@ -0,0 +1,177 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestSchema(t *testing.T) {
+	// shape returns IDs and names of the tree, ParentIDs are checked by CheckIntegrity.
+	var shape func(entries []favorites2.Entry) []any
+
+	shape = func(entries []favorites2.Entry) []any {
+		result := make([]any, 0, len(entries))
+		for _, e := range entries {
+			result = append(result, e.ID, e.Name)
+			if len(e.Entries) > 0 {
+				result = append(result, shape(e.Entries))
+			}
+		}
+
+		return result
+	}
+
+	wantShape := []any{1, "ops", []any{5, "up"}, 2, "x"}
+
+	t.Run("version 0, headerless list", func(t *testing.T) {
+		for format, content := range map[favorites2.Format]string{
+			favorites2.FormatYAML: "- id: 1\n  name: ops\n  exec: ''\n  parentId: 0\n  isDir: true\n  entries:\n" +
+				"    - {id: 5, name: up, exec: uptime, parentId: 1}\n" +
+				"- {id: 2, name: x, exec: 'true', parentId: 0}\n",
+			favorites2.FormatJSON: `[{"id": 1, "name": "ops", "isDir": true, "entries": [` +
+				`{"id": 5, "name": "up", "exec": "uptime", "parentId": 1}]}, {"id": 2, "name": "x", "exec": "true"}]`,
+		} {
+			doc, err := favorites2.UnmarshalDocument([]byte(content), format)
+			require.NoError(t, err, format)
+			require.Equal(t, favorites2.SchemaVersion, doc.Version)
+			require.Equal(t, 6, doc.NextID)
+			require.Equal(t, wantShape, shape(doc.Entries))
+			require.Nil(t, doc.Metadata)
+		}
+	})
+
+	t.Run("version 1, no version", func(t *testing.T) {
+		for format, content := range map[favorites2.Format]string{
+			favorites2.FormatYAML: "nextId: 10\nentries:\n" +
+				"  - {id: 1, name: ops, isDir: true, entries: [{id: 5, name: up, exec: uptime, parentId: 1}]}\n" +
+				"  - {id: 2, name: x, exec: 'true'}\n",
+			favorites2.FormatJSON: `{"nextId": 10, "entries": [{"id": 1, "name": "ops", "isDir": true, "entries": [` +
+				`{"id": 5, "name": "up", "exec": "uptime", "parentId": 1}]}, {"id": 2, "name": "x", "exec": "true"}]}`,
+			favorites2.FormatTOML: "nextId = 10\n\n[[entries]]\nid = 1\nname = \"ops\"\nisDir = true\n\n" +
+				"[[entries.entries]]\nid = 5\nname = \"up\"\nexec = \"uptime\"\nparentId = 1\n\n" +
+				"[[entries]]\nid = 2\nname = \"x\"\nexec = \"true\"\n",
+		} {
+			doc, err := favorites2.UnmarshalDocument([]byte(content), format)
+			require.NoError(t, err, format)
+			require.Equal(t, favorites2.SchemaVersion, doc.Version)
+			require.Equal(t, 10, doc.NextID)
+			require.Equal(t, wantShape, shape(doc.Entries))
+		}
+	})
+
+	t.Run("version 2, metadata", func(t *testing.T) {
+		doc := favorites2.Document{ //nolint:exhaustruct
+			Metadata: map[string]string{"name": "team library"},
+			NextID:   3,
+			Entries:  []favorites2.Entry{{ID: 2, Name: "x", Exec: "true"}}, //nolint:exhaustruct
+		}
+
+		for _, format := range []favorites2.Format{favorites2.FormatYAML, favorites2.FormatJSON, favorites2.FormatTOML} {
+			data, err := favorites2.MarshalDocument(doc, format)
+			require.NoError(t, err)
+			require.Contains(t, string(data), "version")
+
+			decoded, err := favorites2.UnmarshalDocument(data, format)
+			require.NoError(t, err)
+			require.Equal(t, favorites2.SchemaVersion, decoded.Version)
+			require.Equal(t, doc.Metadata, decoded.Metadata)
+			require.Equal(t, doc.NextID, decoded.NextID)
+		}
+	})
+
+	t.Run("newer and invalid versions", func(t *testing.T) {
+		for format, content := range map[favorites2.Format]string{
+			favorites2.FormatYAML: "version: 99\nentries: []\n",
+			favorites2.FormatJSON: `{"version": 99, "entries": []}`,
+			favorites2.FormatTOML: "version = 99\n",
+		} {
+			_, err := favorites2.UnmarshalDocument([]byte(content), format)
+			require.ErrorIs(t, err, favorites2.ErrNewerVersion, format)
+		}
+
+		for _, content := range []string{"version: two\n", "version: -1\n", "just a string\n", "[1, 2]\n"} {
+			_, err := favorites2.UnmarshalDocument([]byte(content), favorites2.FormatYAML)
+			require.ErrorIs(t, err, favorites2.ErrInvalidDocument, content)
+		}
+	})
+
+	t.Run("old file is upgraded on the next save", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("- {id: 7, name: x, exec: 'true'}\n"), 0o600))
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40))
+		require.NoError(t, err)
+		manager.Close()
+
+		id, err := manager.AddCommand("y", "true", 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, 8, id)
+		manager.SyncOut()
+
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		require.Contains(t, string(data), fmt.Sprintf("version: %d\n", favorites2.SchemaVersion))
+
+		backups, err := favorites2.ListBackups(configPath)
+		require.NoError(t, err)
+		require.Len(t, backups, 1)
+		require.True(t, backups[0].Valid)
+	})
+
+	t.Run("newer file is not overwritten", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		content := []byte("version: 99\nentries: []\n")
+		require.NoError(t, os.WriteFile(configPath, content, 0o600))
+
+		_, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40))
+		require.ErrorIs(t, err, favorites2.ErrNewerVersion)
+
+		store := favorites2.NewFileStore(logrus.New(), configPath, 3, favorites2.FormatAuto)
+		require.ErrorIs(t, store.Save(favorites2.Document{}), favorites2.ErrNewerVersion) //nolint:exhaustruct
+
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		require.Equal(t, content, data)
+	})
+
+	t.Run("metadata is kept and merged", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		newManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			return manager
+		}
+
+		ours := newManager()
+		ours.SetMetadata("name", "library")
+		ours.SyncOut()
+
+		theirs := newManager()
+		require.Equal(t, map[string]string{"name": "library"}, theirs.Metadata())
+
+		theirs.SetMetadata("owner", "ops")
+		theirs.SetMetadata("name", "")
+		theirs.SyncOut()
+
+		ours.SetMetadata("team", "infra")
+		ours.SyncOut()
+
+		require.Equal(t, map[string]string{"owner": "ops", "team": "infra"}, ours.Metadata())
+		require.Equal(t, ours.Metadata(), newManager().Metadata())
+	})
+}
@@ -0,0 +1,247 @@
+package favorites
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/list"
+)
+
+// nameFieldBonus prefers matches of the name over the same matches of the path or exec.
+const nameFieldBonus = scoreMatch
+
+// SearchResult is an entry matching a search query. NameMatches, ExecMatches and PathMatches
+// are the indexes of the matched runes of Entry.Name, Entry.Exec and Path, nil if the field
+// does not match.
+type SearchResult struct {
+	Entry       Entry  `json:"entry"`
+	Path        string `json:"path"`
+	Score       int    `json:"score"`
+	NameMatches []int  `json:"nameMatches,omitempty"`
+	ExecMatches []int  `json:"execMatches,omitempty"`
+	PathMatches []int  `json:"pathMatches,omitempty"`
+}
+
+// indexedEntry is what the search index keeps of an entry: the fields searched as runes, the exec
+// of the target for a link, and the tags, so they are taken out of the tag index when the entry
+// changes.
+type indexedEntry struct {
+	path      string
+	name      []rune
+	exec      []rune
+	pathRunes []rune
+	tags      []string
+}
+
+// Search returns the entries whose name, exec or path fuzzy match the query, the best matches
+// first, at most limit of them unless limit is 0. Matching is case-insensitive unless the
+// query has upper case letters. Frequently and recently used entries rank higher, see MostUseful.
+func (m *Manager) Search(query string, limit int) []SearchResult {
+	pattern := []rune(strings.TrimSpace(query))
+	if len(pattern) == 0 {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var results []SearchResult
+
+	now := time.Now()
+
+	for id, indexed := range m.index {
+		node := m.getEntryByID(id)
+		if node == nil {
+			continue
+		}
+
+		result, ok := m.match(pattern, id, indexed, now)
+		if !ok {
+			continue
+		}
+
+		result.Entry = m.resolveLink(m.entry2ExternalEntry(node.Value, false))
+		results = append(results, result)
+	}
+
+	sortResults(results)
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// match scores the indexed entry id, Entry of the result is not set. mu must be held.
+func (m *Manager) match(pattern []rune, id int, indexed *indexedEntry, now time.Time) (SearchResult, bool) {
+	result := SearchResult{Path: indexed.path, Score: noScore} //nolint:exhaustruct
+
+	if score, positions, ok := fuzzyMatch(pattern, indexed.name); ok && score+nameFieldBonus > result.Score {
+		result.Score, result.NameMatches = score+nameFieldBonus, positions
+	}
+
+	if score, positions, ok := fuzzyMatch(pattern, indexed.exec); ok {
+		result.ExecMatches = positions
+		if score > result.Score {
+			result.Score = score
+		}
+	}
+
+	if score, positions, ok := fuzzyMatch(pattern, indexed.pathRunes); ok {
+		result.PathMatches = positions
+		if score > result.Score {
+			result.Score = score
+		}
+	}
+
+	if result.Score == noScore {
+		return result, false
+	}
+
+	if usage, ok := m.usage[id]; ok {
+		result.Score += frecencyBonus(usage.Frecency(now, ""))
+	}
+
+	return result, true
+}
+
+// sortResults puts the best matches first, shorter paths first among equal ones.
+func sortResults(results []SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case len(a.Path) != len(b.Path):
+			return len(a.Path) < len(b.Path)
+		default:
+			return a.Entry.ID < b.Entry.ID
+		}
+	})
+}
+
+// reindex builds the search and tag indexes of the whole tree. mu must be held.
+func (m *Manager) reindex() {
+	m.index = make(map[int]*indexedEntry, len(m.EntryIDs))
+	m.tagIndex = make(map[string]map[int]struct{})
+
+	for node := m.root.Head; node != nil; node = node.Next {
+		m.indexTree(node, "")
+	}
+}
+
+// indexTree indexes the entry and its subtree, parentPath is the path of its dir, "" for the root.
+func (m *Manager) indexTree(node *list.Node[entry], parentPath string) {
+	path := parentPath + JoinPath(node.Value.Name)
+	m.untag(node.Value.ID)
+	m.index[node.Value.ID] = &indexedEntry{
+		path:      path,
+		name:      []rune(node.Value.Name),
+		exec:      []rune(m.linkedExec(node.Value)),
+		pathRunes: []rune(path),
+		tags:      node.Value.Tags,
+	}
+
+	for _, tag := range node.Value.Tags {
+		if m.tagIndex[tag] == nil {
+			m.tagIndex[tag] = make(map[int]struct{})
+		}
+
+		m.tagIndex[tag][node.Value.ID] = struct{}{}
+	}
+
+	for elem := node.Value.Entries.Head; elem != nil; elem = elem.Next {
+		m.indexTree(elem, path)
+	}
+}
+
+// updateIndex updates the search and tag indexes with the changes applied to the tree. mu must be held.
+func (m *Manager) updateIndex(changes []HistoryChange) {
+	// targets are the commands added, deleted or with a new exec, their links are indexed anew.
+	targets := make(map[int]bool)
+
+	for _, change := range changes {
+		if change.Key != "" {
+			continue
+		}
+
+		switch {
+		case change.Before == nil:
+			collectIDs(change.After.Entry, targets)
+		case change.After == nil:
+			collectIDs(change.Before.Entry, targets)
+		case change.Before.Entry.Exec != change.After.Entry.Exec:
+			targets[change.After.Entry.ID] = true
+		}
+
+		if change.Before != nil && change.After == nil {
+			m.unindex(change.Before.Entry)
+
+			continue
+		}
+
+		// A renamed or moved dir changes the paths of its subtree.
+		if change.After != nil {
+			if node := m.getEntryByID(change.After.Entry.ID); node != nil {
+				var parentPath string
+				if parent, ok := m.index[node.Value.ParentID]; ok {
+					parentPath = parent.path
+				}
+
+				m.indexTree(node, parentPath)
+			}
+		}
+	}
+
+	m.reindexLinks(targets)
+}
+
+// reindexLinks updates the exec indexed for the links to the targets. mu must be held.
+func (m *Manager) reindexLinks(targets map[int]bool) {
+	if len(targets) == 0 {
+		return
+	}
+
+	for id, indexed := range m.index {
+		if node := m.getEntryByID(id); node != nil && targets[node.Value.Link] {
+			indexed.exec = []rune(m.linkedExec(node.Value))
+		}
+	}
+}
+
+// collectIDs adds the IDs of the entry and its subtree to ids.
+func collectIDs(e Entry, ids map[int]bool) {
+	ids[e.ID] = true
+
+	for _, child := range e.Entries {
+		collectIDs(child, ids)
+	}
+}
+
+func (m *Manager) unindex(e Entry) {
+	m.untag(e.ID)
+	delete(m.index, e.ID)
+
+	for _, child := range e.Entries {
+		m.unindex(child)
+	}
+}
+
+// untag takes the indexed entry out of the tag index.
+func (m *Manager) untag(id int) {
+	indexed, ok := m.index[id]
+	if !ok {
+		return
+	}
+
+	for _, tag := range indexed.tags {
+		delete(m.tagIndex[tag], id)
+
+		if len(m.tagIndex[tag]) == 0 {
+			delete(m.tagIndex, tag)
+		}
+	}
+}
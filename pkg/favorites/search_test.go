@@ -0,0 +1,158 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestSearch(t *testing.T) {
+	newManager := func(t *testing.T) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	paths := func(results []favorites2.SearchResult) []string {
+		result := make([]string, 0, len(results))
+		for _, r := range results {
+			result = append(result, r.Path)
+		}
+
+		return result
+	}
+
+	t.Run("results are ranked", func(t *testing.T) {
+		manager := newManager(t)
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("gitlog", "git log --oneline", ops, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("dig", "dig +short example.org", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("go-list", "go list ./...", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("uptime", "uptime", 0, 0)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"/go-list", "/ops/gitlog", "/dig"}, paths(manager.Search("gl", 0)))
+		require.Equal(t, []string{"/go-list", "/ops/gitlog"}, paths(manager.Search("gl", 2)))
+		require.Equal(t, []string{"/ops/gitlog"}, paths(manager.Search("oneline", 0)))
+		require.Equal(t, []string{"/ops/gitlog"}, paths(manager.Search("opsgit", 0)))
+		require.Empty(t, manager.Search("xyz", 0))
+		require.Empty(t, manager.Search("  ", 0))
+	})
+
+	t.Run("matches are highlighted", func(t *testing.T) {
+		manager := newManager(t)
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("Disk Usage", "du -sh .", ops, 0)
+		require.NoError(t, err)
+
+		results := manager.Search("du", 0)
+		require.Len(t, results, 1)
+		require.Equal(t, []int{0, 5}, results[0].NameMatches)
+		require.Equal(t, []int{0, 1}, results[0].ExecMatches)
+		require.Equal(t, []int{5, 10}, results[0].PathMatches)
+
+		results = manager.Search("DU", 0)
+		require.Len(t, results, 1)
+		require.Equal(t, []int{0, 5}, results[0].NameMatches)
+		require.Nil(t, results[0].ExecMatches)
+	})
+
+	t.Run("index follows changes", func(t *testing.T) {
+		manager := newManager(t)
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		db, err := manager.AddDir("db", ops, 0)
+		require.NoError(t, err)
+		backup, err := manager.AddCommand("backup", "pg_dump", db, 0)
+		require.NoError(t, err)
+
+		require.NoError(t, manager.RenameEntry(ops, "infra"))
+		require.Equal(t, []string{"/infra/db/backup"}, paths(manager.Search("backup", 0)))
+
+		require.NoError(t, manager.MoveEntry(db, 0, 0))
+		require.Equal(t, []string{"/db/backup"}, paths(manager.Search("backup", 0)))
+
+		require.NoError(t, manager.ModifyExec(backup, "mysqldump"))
+		require.Empty(t, manager.Search("pg_dump", 0))
+
+		require.NoError(t, manager.DeleteDir(db))
+		require.Empty(t, manager.Search("backup", 0))
+
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []string{"/db/backup"}, paths(manager.Search("backup", 0)))
+
+		require.NoError(t, manager.Tx(func(tx *favorites2.Tx) error {
+			return tx.MoveEntry(db, ops, 0)
+		}))
+		require.Equal(t, []string{"/infra/db/backup"}, paths(manager.Search("backup", 0)))
+	})
+
+	t.Run("links are found with the exec of their target", func(t *testing.T) {
+		manager := newManager(t)
+
+		backup, err := manager.AddCommand("backup", "pg_dump", 0, 0)
+		require.NoError(t, err)
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddLink("nightly", backup, ops, 0)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"/backup", "/ops/nightly"}, paths(manager.Search("pg_dump", 0)))
+
+		results := manager.Search("nightly", 0)
+		require.Len(t, results, 1)
+		require.Equal(t, "pg_dump", results[0].Entry.Exec)
+
+		require.NoError(t, manager.ModifyExec(backup, "mysqldump"))
+		require.Empty(t, manager.Search("pg_dump", 0))
+		require.Equal(t, []string{"/backup", "/ops/nightly"}, paths(manager.Search("mysqldump", 0)))
+
+		require.NoError(t, manager.DeleteCommand(backup))
+		require.Empty(t, manager.Search("mysqldump", 0))
+
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []string{"/backup", "/ops/nightly"}, paths(manager.Search("mysqldump", 0)))
+	})
+
+	t.Run("index follows changes loaded from the store", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		newFileManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			return manager
+		}
+
+		ours := newFileManager()
+		theirs := newFileManager()
+
+		_, err := theirs.AddCommand("backup", "pg_dump", 0, 0)
+		require.NoError(t, err)
+		theirs.SyncOut()
+
+		ours.SyncIn()
+		require.Equal(t, []string{"/backup"}, paths(ours.Search("backup", 0)))
+		require.Equal(t, []string{"/backup"}, paths(newFileManager().Search("backup", 0)))
+	})
+}
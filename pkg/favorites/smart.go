@@ -0,0 +1,237 @@
+package favorites
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SmartQuery is the stored query of a smart dir. Its contents are the commands of the tree
+// matching every criterion set, computed when it is listed.
+type SmartQuery struct {
+	// Tags is a tag query, see ParseTagQuery.
+	Tags string `yaml:"tags,omitempty" json:"tags,omitempty" toml:"tags,omitempty"`
+	// Text is fuzzy matched like Search does, the best matches are listed first.
+	Text string `yaml:"text,omitempty" json:"text,omitempty" toml:"text,omitempty"`
+	// UsedWithin is a duration like "168h", commands last used within it are listed, the most
+	// recently used first.
+	UsedWithin string `yaml:"usedWithin,omitempty" json:"usedWithin,omitempty" toml:"usedWithin,omitempty"`
+	// CreatedAfter lists the commands created after it.
+	CreatedAfter *time.Time `yaml:"createdAfter,omitempty" json:"createdAfter,omitempty" toml:"createdAfter,omitempty"`
+	// Limit is the maximum number of commands listed, 0 for no limit.
+	Limit int `yaml:"limit,omitempty" json:"limit,omitempty" toml:"limit,omitempty"`
+}
+
+// Validate checks the query has a criterion and its fields parse.
+func (q *SmartQuery) Validate() error {
+	if strings.TrimSpace(q.Tags) == "" && strings.TrimSpace(q.Text) == "" && q.UsedWithin == "" &&
+		q.CreatedAfter == nil {
+		return fmt.Errorf("no criteria: %w", ErrInvalidSmart)
+	}
+
+	if strings.TrimSpace(q.Tags) != "" {
+		if _, err := ParseTagQuery(q.Tags); err != nil {
+			return fmt.Errorf("%w: tags: %v", ErrInvalidSmart, err) //nolint:errorlint
+		}
+	}
+
+	if q.UsedWithin != "" {
+		d, err := time.ParseDuration(q.UsedWithin)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("usedWithin %q: %w", q.UsedWithin, ErrInvalidSmart)
+		}
+	}
+
+	if q.Limit < 0 {
+		return fmt.Errorf("negative limit: %w", ErrInvalidSmart)
+	}
+
+	return nil
+}
+
+// clone copies the query, so the caller's one is not shared with the tree. It is nil for nil.
+func (q *SmartQuery) clone() *SmartQuery {
+	if q == nil {
+		return nil
+	}
+
+	result := *q
+
+	if q.CreatedAfter != nil {
+		createdAfter := q.CreatedAfter.Round(0)
+		result.CreatedAfter = &createdAfter
+	}
+
+	return &result
+}
+
+func smartEqual(a, b *SmartQuery) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	sameTime := a.CreatedAfter == nil && b.CreatedAfter == nil ||
+		a.CreatedAfter != nil && b.CreatedAfter != nil && a.CreatedAfter.Equal(*b.CreatedAfter)
+
+	return a.Tags == b.Tags && a.Text == b.Text && a.UsedWithin == b.UsedWithin && a.Limit == b.Limit && sameTime
+}
+
+// AddSmartDir creates a smart dir: a dir listing the commands matching the query instead of
+// entries of its own. Nothing can be added to or moved into it, see ErrSmartDir.
+func (m *Manager) AddSmartDir(name string, query SmartQuery, parentID int, nextID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addSmartDir(name, query, parentID, nextID)
+}
+
+func (m *Manager) addSmartDir(name string, query SmartQuery, parentID int, nextID int) (int, error) {
+	if name == "" {
+		return 0, fmt.Errorf("dir without name: %w", ErrInvalidName)
+	}
+
+	if err := query.Validate(); err != nil {
+		return 0, err
+	}
+
+	dir, next, err := m.getPlacement(parentID, nextID)
+	if err != nil {
+		return 0, err
+	}
+
+	defer m.notifySinker()
+
+	e := m.newEntry(name, "", true, parentID)
+	e.Smart = query.clone()
+	node := dir.AddElement(e, nil, next)
+	m.registerEntry(node)
+	m.recordPut(node)
+	m.record(OpAddDir, HistoryChange{After: m.state(node, false)}) //nolint:exhaustruct
+
+	return node.Value.ID, nil
+}
+
+// SetSmartQuery replaces the query of a smart dir. It makes an empty plain dir smart, and a nil
+// query makes a smart dir plain.
+func (m *Manager) SetSmartQuery(id int, query *SmartQuery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setSmartQuery(id, query)
+}
+
+func (m *Manager) setSmartQuery(id int, query *SmartQuery) error {
+	node := m.getEntryByID(id)
+
+	switch {
+	case node == nil:
+		return fmt.Errorf("entry %d: %w", id, ErrNotFound)
+	case !node.Value.IsDir:
+		return fmt.Errorf("entry %d: %w", id, ErrNotADirectory)
+	case node.Value.Entries.Len() > 0:
+		return fmt.Errorf("entry %d: %w", id, ErrNotEmpty)
+	}
+
+	if query != nil {
+		if err := query.Validate(); err != nil {
+			return fmt.Errorf("entry %d: %w", id, err)
+		}
+
+		query = query.clone()
+	}
+
+	if smartEqual(node.Value.Smart, query) {
+		return nil
+	}
+
+	defer m.notifySinker()
+
+	before := m.state(node, false)
+	node.Value.Smart = query
+	m.recordPut(node)
+	m.record(OpSetSmartQuery, HistoryChange{Before: before, After: m.state(node, false)}) //nolint:exhaustruct
+
+	return nil
+}
+
+// smartEntries returns the commands matching the query of a smart dir. A query stored with
+// invalid fields lists nothing. mu must be held.
+func (m *Manager) smartEntries(query *SmartQuery) []Entry {
+	if query.Validate() != nil {
+		return []Entry{}
+	}
+
+	var tags *TagQuery
+	if strings.TrimSpace(query.Tags) != "" {
+		tags, _ = ParseTagQuery(query.Tags)
+	}
+
+	var usedWithin time.Duration
+	if query.UsedWithin != "" {
+		usedWithin, _ = time.ParseDuration(query.UsedWithin)
+	}
+
+	pattern := []rune(strings.TrimSpace(query.Text))
+	now := time.Now()
+
+	var results []SearchResult
+
+	for id, indexed := range m.index {
+		node := m.getEntryByID(id)
+		if node == nil || node.Value.IsDir || node.Value.Link != 0 {
+			continue
+		}
+
+		if tags != nil && !tags.Match(indexed.tags) ||
+			query.CreatedAfter != nil && !node.Value.CreatedAt.After(*query.CreatedAfter) ||
+			usedWithin > 0 && now.Sub(m.usage[id].LastUsed) > usedWithin {
+			continue
+		}
+
+		result := SearchResult{Path: indexed.path} //nolint:exhaustruct
+
+		if len(pattern) > 0 {
+			var ok bool
+			if result, ok = m.match(pattern, id, indexed, now); !ok {
+				continue
+			}
+		}
+
+		result.Entry = m.entry2ExternalEntry(node.Value, false)
+		results = append(results, result)
+	}
+
+	switch {
+	case len(pattern) > 0:
+		sortResults(results)
+	case usedWithin > 0:
+		sort.Slice(results, func(i, j int) bool {
+			a, b := m.usage[results[i].Entry.ID].LastUsed, m.usage[results[j].Entry.ID].LastUsed
+			if !a.Equal(b) {
+				return a.After(b)
+			}
+
+			return results[i].Entry.ID < results[j].Entry.ID
+		})
+	default:
+		sort.Slice(results, func(i, j int) bool {
+			if results[i].Path != results[j].Path {
+				return results[i].Path < results[j].Path
+			}
+
+			return results[i].Entry.ID < results[j].Entry.ID
+		})
+	}
+
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	entries := make([]Entry, len(results))
+	for i := range results {
+		entries[i] = results[i].Entry
+	}
+
+	return entries
+}
@@ -0,0 +1,207 @@
+//nolint:paralleltest,funlen,exhaustruct
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestSmartDirs(t *testing.T) {
+	newManager := func(t *testing.T) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	// newTree creates /ops/backup, /ops/migrate and /psql tagged with the tags.
+	newTree := func(t *testing.T, manager *favorites2.Manager) map[string]int {
+		t.Helper()
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+
+		ids := map[string]int{"ops": ops}
+
+		for _, e := range []struct {
+			name, exec string
+			parentID   int
+			tags       []string
+		}{
+			{"backup", "pg_dump main", ops, []string{"prod", "db"}},
+			{"migrate", "goose up", ops, []string{"prod", "db", "dangerous"}},
+			{"psql", "psql staging", 0, []string{"staging", "db"}},
+		} {
+			id, err := manager.AddCommand(e.name, e.exec, e.parentID, 0)
+			require.NoError(t, err)
+			require.NoError(t, manager.SetTags(id, e.tags))
+
+			ids[e.name] = id
+		}
+
+		return ids
+	}
+
+	t.Run("smart dirs list live results", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager)
+
+		query := favorites2.SmartQuery{Tags: "prod AND NOT dangerous"}
+		prod, err := manager.AddSmartDir("safe prod", query, 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"backup"}, names(manager.ListDirectory(prod)))
+
+		require.NoError(t, manager.SetTags(ids["psql"], []string{"prod"}))
+		require.Equal(t, []string{"backup", "psql"}, names(manager.ListDirectory(prod)))
+
+		require.NoError(t, manager.DeleteCommand(ids["backup"]))
+		require.Equal(t, []string{"psql"}, names(manager.ListDirectory(prod)))
+
+		e, err := manager.GetEntry(prod)
+		require.NoError(t, err)
+		require.True(t, e.IsDir)
+		require.Equal(t, "prod AND NOT dangerous", e.Smart.Tags)
+
+		e.Smart.Tags = "db"
+		require.Equal(t, []string{"psql"}, names(manager.ListDirectory(prod)))
+
+		require.NoError(t, manager.SetSmartQuery(prod, nil))
+		require.NoError(t, manager.Undo())
+
+		e, err = manager.GetEntry(prod)
+		require.NoError(t, err)
+		e.Smart.Tags = "db"
+		require.Equal(t, []string{"psql"}, names(manager.ListDirectory(prod)))
+	})
+
+	t.Run("criteria", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager)
+
+		list := func(query favorites2.SmartQuery) []string {
+			id, err := manager.AddSmartDir("smart", query, 0, 0)
+			require.NoError(t, err)
+
+			defer func() { require.NoError(t, manager.DeleteDir(id)) }()
+
+			return names(manager.ListDirectory(id))
+		}
+
+		require.Equal(t, []string{"psql", "backup", "migrate"}, list(favorites2.SmartQuery{Tags: "db", Text: "ps"}))
+		require.Equal(t, []string{"psql"}, list(favorites2.SmartQuery{Tags: "db", Text: "ps", Limit: 1}))
+		require.Empty(t, list(favorites2.SmartQuery{UsedWithin: "1h"}))
+
+		require.NoError(t, manager.RecordUse(ids["migrate"], ""))
+		require.NoError(t, manager.RecordUse(ids["psql"], ""))
+		require.Equal(t, []string{"psql", "migrate"}, list(favorites2.SmartQuery{UsedWithin: "1h"}))
+
+		future := time.Now().Add(time.Hour)
+		require.Empty(t, list(favorites2.SmartQuery{CreatedAfter: &future}))
+
+		past := time.Now().Add(-time.Hour)
+		require.Equal(t, []string{"backup", "migrate", "psql"},
+			list(favorites2.SmartQuery{CreatedAfter: &past}))
+
+		for _, query := range []favorites2.SmartQuery{
+			{},
+			{Tags: "prod AND"},
+			{UsedWithin: "a week"},
+			{UsedWithin: "-1h"},
+			{Text: "x", Limit: -1},
+		} {
+			_, err := manager.AddSmartDir("smart", query, 0, 0)
+			require.ErrorIs(t, err, favorites2.ErrInvalidSmart, query)
+		}
+	})
+
+	t.Run("mutations of smart dirs are rejected", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager)
+
+		smart, err := manager.AddSmartDir("smart", favorites2.SmartQuery{Tags: "db"}, 0, 0)
+		require.NoError(t, err)
+
+		_, err = manager.AddCommand("x", "true", smart, 0)
+		require.ErrorIs(t, err, favorites2.ErrSmartDir)
+		_, err = manager.AddDir("x", smart, 0)
+		require.ErrorIs(t, err, favorites2.ErrSmartDir)
+		require.ErrorIs(t, manager.MoveEntry(ids["psql"], smart, 0), favorites2.ErrSmartDir)
+		require.ErrorIs(t, manager.ModifyExec(smart, "true"), favorites2.ErrNotACommand)
+		require.ErrorIs(t, manager.Tx(func(tx *favorites2.Tx) error {
+			_, err := tx.AddCommand("x", "true", smart, 0)
+
+			return err
+		}), favorites2.ErrSmartDir)
+
+		// The smart dir itself can be renamed, moved and deleted.
+		require.NoError(t, manager.RenameEntry(smart, "db"))
+		require.NoError(t, manager.MoveEntry(smart, ids["ops"], 0))
+		require.NoError(t, manager.DeleteDir(smart))
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []string{"backup", "migrate", "psql"}, names(manager.ListDirectory(smart)))
+	})
+
+	t.Run("dirs are made smart and plain", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager)
+
+		require.ErrorIs(t, manager.SetSmartQuery(ids["ops"], &favorites2.SmartQuery{Tags: "db"}),
+			favorites2.ErrNotEmpty)
+		require.ErrorIs(t, manager.SetSmartQuery(ids["psql"], &favorites2.SmartQuery{Tags: "db"}),
+			favorites2.ErrNotADirectory)
+
+		dir, err := manager.AddDir("dir", 0, 0)
+		require.NoError(t, err)
+
+		s := manager.Subscribe()
+		defer s.Close()
+
+		require.NoError(t, manager.SetSmartQuery(dir, &favorites2.SmartQuery{Tags: "staging"}))
+		require.Equal(t, []string{"psql"}, names(manager.ListDirectory(dir)))
+		require.Equal(t, favorites2.EventQueryChanged, (<-s.C).Kind)
+
+		require.NoError(t, manager.SetSmartQuery(dir, nil))
+		require.Empty(t, manager.ListDirectory(dir))
+
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []string{"psql"}, names(manager.ListDirectory(dir)))
+	})
+
+	t.Run("smart dirs are stored", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.toml")
+		newFileManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			return manager
+		}
+
+		manager := newFileManager()
+		newTree(t, manager)
+
+		createdAfter := time.Now().Add(-time.Hour).Round(time.Second)
+		query := favorites2.SmartQuery{Tags: "db", Text: "p", UsedWithin: "", CreatedAfter: &createdAfter, Limit: 2}
+		smart, err := manager.AddSmartDir("smart", query, 0, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+
+		manager = newFileManager()
+		e, err := manager.GetEntry(smart)
+		require.NoError(t, err)
+		require.Equal(t, query.Text, e.Smart.Text)
+		require.True(t, createdAfter.Equal(*e.Smart.CreatedAfter))
+		require.Equal(t, []string{"psql", "backup"}, names(manager.ListDirectory(smart)))
+	})
+}
@@ -0,0 +1,171 @@
+package favorites
+
+import "sync"
+
+// Document is the stored tree.
+type Document struct {
+	// Version is the schema version of the encoded document, see SchemaVersion.
+	Version int `yaml:"version" json:"version" toml:"version"`
+	// Metadata is free-form information about the library, like its name or owner.
+	Metadata map[string]string `yaml:"metadata,omitempty" json:"metadata,omitempty" toml:"metadata,omitempty"`
+	// NextID is the ID high-water mark plus one, IDs of deleted entries are not reused.
+	NextID  int     `yaml:"nextId" json:"nextId" toml:"nextId"`
+	Entries []Entry `yaml:"entries" json:"entries" toml:"entries,omitempty"`
+	// Trash is the deleted entries not purged yet.
+	Trash []TrashItem `yaml:"trash,omitempty" json:"trash,omitempty" toml:"trash,omitempty"`
+}
+
+// Store persists the tree of a Manager. A Store serves a single Manager, which serializes the calls.
+type Store interface {
+	// Load returns the stored tree, an empty Document if nothing has been stored yet.
+	// It fails with ErrNotModified if the tree has not changed since the last Load or Save.
+	Load() (Document, error)
+	// Save replaces the stored tree. It fails with ErrModified if the tree has been changed
+	// by someone else since the last Load or Save, the Manager then merges the changes and saves again.
+	Save(doc Document) error
+}
+
+// IncrementalStore is a Store able to apply changes of single entries instead of saving the whole tree.
+type IncrementalStore interface {
+	Store
+	// Apply stores the changes made since the last Load, Save or Apply in their order.
+	// It fails with ErrModified like Save.
+	Apply(changes []Change, nextID int) error
+}
+
+// WatchableStore is a Store reporting changes made by someone else.
+type WatchableStore interface {
+	Store
+	// Watch returns a channel receiving a value after the stored tree changes and a function to stop watching.
+	Watch() (<-chan struct{}, func(), error)
+}
+
+// ChangeKind is the kind of Change.
+type ChangeKind int
+
+const (
+	// ChangePut creates or updates the entry and places it in its directory.
+	ChangePut ChangeKind = iota
+	// ChangeDelete deletes the entry.
+	ChangeDelete
+	// ChangeTrash adds Item to the trash. It comes before the deletes of the entry and its subtree.
+	ChangeTrash
+	// ChangeUntrash removes the trash item of the entry, it has been restored or purged.
+	ChangeUntrash
+)
+
+// Change is a change of a single entry applied by IncrementalStore.
+type Change struct {
+	Kind ChangeKind
+	// Entry is the changed entry without its Entries. Only ID is set for ChangeDelete,
+	// entries of a deleted directory get their own changes before the directory.
+	Entry Entry
+	// NextID is the entry the changed one is placed before, 0 for the end of the directory.
+	NextID int
+	// Item is the trashed entry with its subtree for ChangeTrash.
+	Item *TrashItem
+}
+
+// MemoryStore keeps the tree in memory. It is the Store of Managers created with inMemory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	doc     Document
+	history History
+	usage   []Usage
+	loaded  bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{} //nolint:exhaustruct
+}
+
+func (s *MemoryStore) Load() (Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loaded {
+		return Document{}, ErrNotModified //nolint:exhaustruct
+	}
+
+	s.loaded = true
+
+	return cloneDocument(s.doc), nil
+}
+
+func (s *MemoryStore) Save(doc Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.doc = cloneDocument(doc)
+	s.loaded = true
+
+	return nil
+}
+
+func (s *MemoryStore) LoadHistory() (History, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.history, nil
+}
+
+func (s *MemoryStore) SaveHistory(history History) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history = history
+
+	return nil
+}
+
+func (s *MemoryStore) LoadUsage() ([]Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return AddUsage(nil, s.usage), nil
+}
+
+func (s *MemoryStore) AddUsage(uses []Usage) ([]Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.usage = AddUsage(s.usage, uses)
+
+	return AddUsage(nil, s.usage), nil
+}
+
+func cloneDocument(doc Document) Document {
+	doc.Metadata = cloneMetadata(doc.Metadata)
+	doc.Entries = cloneEntries(doc.Entries)
+	doc.Trash = cloneTrash(doc.Trash)
+
+	return doc
+}
+
+func cloneMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+
+	result := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		result[key] = value
+	}
+
+	return result
+}
+
+func cloneEntries(entries []Entry) []Entry {
+	if entries == nil {
+		return nil
+	}
+
+	result := make([]Entry, len(entries))
+
+	for i := range entries {
+		result[i] = entries[i]
+		result[i].Entries = cloneEntries(entries[i].Entries)
+	}
+
+	return result
+}
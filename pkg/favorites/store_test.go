@@ -0,0 +1,164 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+// recordingStore is an incremental store keeping the calls it gets.
+type recordingStore struct {
+	*favorites2.MemoryStore
+	theirs  *favorites2.Document
+	saves   int
+	changes []favorites2.Change
+	failing bool
+}
+
+func (s *recordingStore) Load() (favorites2.Document, error) {
+	if s.theirs != nil {
+		doc := *s.theirs
+		s.theirs = nil
+
+		return doc, nil
+	}
+
+	return s.MemoryStore.Load() //nolint:wrapcheck
+}
+
+func (s *recordingStore) Save(doc favorites2.Document) error {
+	s.saves++
+
+	return s.MemoryStore.Save(doc) //nolint:wrapcheck
+}
+
+func (s *recordingStore) Apply(changes []favorites2.Change, _ int) error {
+	if s.failing {
+		s.failing = false
+
+		return favorites2.ErrModified
+	}
+
+	s.changes = append(s.changes, changes...)
+
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	newManager := func(store favorites2.Store) *favorites2.Manager {
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40, favorites2.WithStore(store)))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	t.Run("incremental store gets changes", func(t *testing.T) {
+		store := &recordingStore{MemoryStore: favorites2.NewMemoryStore()} //nolint:exhaustruct
+		manager := newManager(store)
+
+		d, err := manager.AddDir("d", 0, 0)
+		require.NoError(t, err)
+		x, err := manager.AddCommand("x", "true", d, 0)
+		require.NoError(t, err)
+		y, err := manager.AddCommand("y", "true", 0, d)
+		require.NoError(t, err)
+		require.NoError(t, manager.ModifyExec(y, "false"))
+		require.NoError(t, manager.DeleteDir(d))
+		manager.SyncOut()
+
+		type change struct {
+			kind       favorites2.ChangeKind
+			id, nextID int
+		}
+
+		var got []change
+		for _, c := range store.changes {
+			got = append(got, change{c.Kind, c.Entry.ID, c.NextID})
+		}
+
+		require.Equal(t, []change{
+			{favorites2.ChangePut, d, 0},
+			{favorites2.ChangePut, x, 0},
+			{favorites2.ChangePut, y, d},
+			{favorites2.ChangePut, y, d},
+			{favorites2.ChangeTrash, d, 0},
+			{favorites2.ChangeDelete, x, 0},
+			{favorites2.ChangeDelete, d, 0},
+		}, got)
+		require.Zero(t, store.saves)
+		require.Equal(t, "false", store.changes[3].Entry.Exec)
+
+		store.changes = nil
+		manager.SyncOut()
+		require.Empty(t, store.changes)
+	})
+
+	t.Run("modified store is merged and saved", func(t *testing.T) {
+		store := &recordingStore{MemoryStore: favorites2.NewMemoryStore()} //nolint:exhaustruct
+		manager := newManager(store)
+
+		_, err := manager.AddCommand("ours", "true", 0, 0)
+		require.NoError(t, err)
+
+		store.failing = true
+		store.theirs = &favorites2.Document{NextID: 101, Entries: []favorites2.Entry{
+			{ID: 100, Name: "theirs", Exec: "true"}, //nolint:exhaustruct
+		}}
+		manager.SyncOut()
+
+		require.Equal(t, 1, store.saves)
+		require.Empty(t, store.changes)
+
+		names := make([]string, 0, 2)
+		for _, e := range manager.ListDirectory(0) {
+			names = append(names, e.Name)
+		}
+
+		require.ElementsMatch(t, []string{"theirs", "ours"}, names)
+	})
+
+	t.Run("file store", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		store := favorites2.NewFileStore(logrus.New(), configPath, 3, favorites2.FormatAuto)
+
+		doc, err := store.Load()
+		require.NoError(t, err)
+		require.Empty(t, doc.Entries)
+
+		_, err = store.Load()
+		require.ErrorIs(t, err, favorites2.ErrNotModified)
+
+		doc.Entries = []favorites2.Entry{{ID: 1, Name: "x", Exec: "true"}} //nolint:exhaustruct
+		require.NoError(t, store.Save(doc))
+
+		_, err = store.Load()
+		require.ErrorIs(t, err, favorites2.ErrNotModified)
+
+		other := favorites2.NewFileStore(logrus.New(), configPath, 3, favorites2.FormatAuto)
+		theirs, err := other.Load()
+		require.NoError(t, err)
+		require.Equal(t, doc.Entries[0].Name, theirs.Entries[0].Name)
+
+		theirs.Entries[0].Name = "theirs"
+		require.NoError(t, other.Save(theirs))
+		require.ErrorIs(t, store.Save(doc), favorites2.ErrModified)
+
+		doc, err = store.Load()
+		require.NoError(t, err)
+		require.Equal(t, "theirs", doc.Entries[0].Name)
+		require.NoError(t, store.Save(doc))
+
+		// A corrupt file is overwritten.
+		require.NoError(t, os.WriteFile(configPath, []byte("entries: ["), 0o600))
+		require.NoError(t, store.Save(doc))
+	})
+}
@@ -0,0 +1,498 @@
+package favorites
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/list"
+)
+
+// Keywords of tag queries, they are not valid tags.
+const (
+	queryAnd = "and"
+	queryOr  = "or"
+	queryNot = "not"
+)
+
+// TagCount is a tag with the number of entries tagged with it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags returns the tags lower case, sorted and without duplicates, nil if there are none.
+// A tag is a word of letters, digits and any of "-_.:/", and not a query keyword.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if err := validateTag(tag); err != nil {
+			return nil, err
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	sort.Strings(result)
+
+	return result, nil
+}
+
+func validateTag(tag string) error {
+	switch tag {
+	case "":
+		return fmt.Errorf("empty tag: %w", ErrInvalidTag)
+	case queryAnd, queryOr, queryNot:
+		return fmt.Errorf("%q is a query keyword: %w", tag, ErrInvalidTag)
+	}
+
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.:/", r) {
+			return fmt.Errorf("%q: unexpected %q: %w", tag, r, ErrInvalidTag)
+		}
+	}
+
+	return nil
+}
+
+func tagsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetTags replaces the tags of the entry, see NormalizeTags.
+func (m *Manager) SetTags(id int, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setTags(id, tags)
+}
+
+func (m *Manager) setTags(id int, tags []string) error {
+	node := m.getEntryByID(id)
+	if node == nil {
+		return fmt.Errorf("entry %d: %w", id, ErrNotFound)
+	}
+
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return fmt.Errorf("entry %d: %w", id, err)
+	}
+
+	if tagsEqual(node.Value.Tags, tags) {
+		return nil
+	}
+
+	defer m.notifySinker()
+
+	before := m.state(node, false)
+	node.Value.Tags = tags
+	m.recordPut(node)
+	m.record(OpSetTags, HistoryChange{Before: before, After: m.state(node, false)}) //nolint:exhaustruct
+
+	return nil
+}
+
+// Tags returns the tags in use with the number of entries of each, sorted by tag.
+func (m *Manager) Tags() []TagCount {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]TagCount, 0, len(m.tagIndex))
+	for tag, ids := range m.tagIndex {
+		result = append(result, TagCount{Tag: tag, Count: len(ids)})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Tag < result[j].Tag })
+
+	return result
+}
+
+// ListByTag returns the entries tagged with the tag, sorted by path. Dirs are returned without
+// their entries.
+func (m *Manager) ListByTag(tag string) []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := m.tagIndex[strings.ToLower(strings.TrimSpace(tag))]
+
+	return m.indexedEntries(func(id int, _ *indexedEntry) bool {
+		_, ok := ids[id]
+
+		return ok
+	})
+}
+
+// QueryTags returns the entries matching the tag query, sorted by path, see ParseTagQuery.
+func (m *Manager) QueryTags(query string) ([]Entry, error) {
+	q, err := ParseTagQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.indexedEntries(func(_ int, indexed *indexedEntry) bool {
+		return q.Match(indexed.tags)
+	}), nil
+}
+
+// indexedEntries returns the entries of the search index matching the filter, sorted by path.
+// mu must be held.
+func (m *Manager) indexedEntries(filter func(id int, indexed *indexedEntry) bool) []Entry {
+	type found struct {
+		path  string
+		entry Entry
+	}
+
+	var matches []found
+
+	for id, indexed := range m.index {
+		if !filter(id, indexed) {
+			continue
+		}
+
+		if node := m.getEntryByID(id); node != nil {
+			matches = append(matches, found{indexed.path, m.resolveLink(m.entry2ExternalEntry(node.Value, false))})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].path != matches[j].path {
+			return matches[i].path < matches[j].path
+		}
+
+		return matches[i].entry.ID < matches[j].entry.ID
+	})
+
+	result := make([]Entry, len(matches))
+	for i := range matches {
+		result[i] = matches[i].entry
+	}
+
+	return result
+}
+
+// RenameTag renames the tag on every entry tagged with it. If an entry is tagged with the new
+// name already, the tags are merged. It is a single operation in the history.
+func (m *Manager) RenameTag(from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mergeTags(to, from)
+}
+
+// MergeTags replaces the tags with into on every entry tagged with any of them, as a single
+// operation in the history.
+func (m *Manager) MergeTags(into string, tags ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mergeTags(into, tags...)
+}
+
+func (m *Manager) mergeTags(into string, tags ...string) error {
+	into = strings.ToLower(strings.TrimSpace(into))
+	if err := validateTag(into); err != nil {
+		return err
+	}
+
+	merged := make(map[string]bool, len(tags))
+	ids := make(map[int]struct{})
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == into {
+			continue
+		}
+
+		if _, ok := m.tagIndex[tag]; !ok {
+			return fmt.Errorf("%q: %w", tag, ErrTagNotFound)
+		}
+
+		merged[tag] = true
+
+		for id := range m.tagIndex[tag] {
+			ids[id] = struct{}{}
+		}
+	}
+
+	nodes := make([]*list.Node[entry], 0, len(ids))
+	for id := range ids {
+		if node := m.getEntryByID(id); node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	defer m.notifySinker()
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Value.ID < nodes[j].Value.ID })
+
+	changes := make([]HistoryChange, 0, len(nodes))
+
+	for _, node := range nodes {
+		tags := make([]string, 0, len(node.Value.Tags))
+		for _, tag := range node.Value.Tags {
+			if merged[tag] {
+				tag = into
+			}
+
+			tags = append(tags, tag)
+		}
+
+		before := m.state(node, false)
+		node.Value.Tags, _ = NormalizeTags(tags)
+		m.recordPut(node)
+		changes = append(changes, HistoryChange{Before: before, After: m.state(node, false)}) //nolint:exhaustruct
+	}
+
+	m.record(OpRenameTag, changes...)
+
+	return nil
+}
+
+// TagQuery is a boolean expression of tags, see ParseTagQuery.
+type TagQuery struct {
+	root queryNode
+}
+
+// queryNode is a node of a parsed query: a tag, or an operator with its operands.
+type queryNode struct {
+	op       string
+	tag      string
+	operands []queryNode
+}
+
+// ParseTagQuery parses a query like "prod AND (db OR cache) AND NOT readonly". Keywords are
+// case-insensitive, NOT binds tighter than AND, AND tighter than OR, and tags next to each
+// other are joined with AND.
+func ParseTagQuery(query string) (*TagQuery, error) {
+	p := queryParser{tokens: tokenizeQuery(query), pos: 0}
+
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty query: %w", ErrInvalidQuery)
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q: %w", p.tokens[p.pos], ErrInvalidQuery)
+	}
+
+	return &TagQuery{root: root}, nil
+}
+
+// Match reports whether the tags, lower case as returned by NormalizeTags, match the query.
+func (q *TagQuery) Match(tags []string) bool {
+	return q.root.match(tags)
+}
+
+func (q *TagQuery) String() string {
+	return q.root.String()
+}
+
+func (n queryNode) match(tags []string) bool {
+	switch n.op {
+	case queryNot:
+		return !n.operands[0].match(tags)
+	case queryAnd:
+		for _, operand := range n.operands {
+			if !operand.match(tags) {
+				return false
+			}
+		}
+
+		return true
+	case queryOr:
+		for _, operand := range n.operands {
+			if operand.match(tags) {
+				return true
+			}
+		}
+
+		return false
+	default:
+		for _, tag := range tags {
+			if tag == n.tag {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func (n queryNode) String() string {
+	switch n.op {
+	case queryNot:
+		return "NOT " + n.operands[0].String()
+	case queryAnd, queryOr:
+		operands := make([]string, len(n.operands))
+		for i, operand := range n.operands {
+			operands[i] = operand.String()
+		}
+
+		return "(" + strings.Join(operands, " "+strings.ToUpper(n.op)+" ") + ")"
+	default:
+		return n.tag
+	}
+}
+
+func tokenizeQuery(query string) []string {
+	var (
+		tokens []string
+		token  strings.Builder
+	)
+
+	flush := func() {
+		if token.Len() > 0 {
+			tokens = append(tokens, token.String())
+			token.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			token.WriteRune(r)
+		}
+	}
+
+	flush()
+
+	return tokens
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+// peek returns the next token, keywords lower case, "" at the end.
+func (p *queryParser) peek() string {
+	if p.pos == len(p.tokens) {
+		return ""
+	}
+
+	token := p.tokens[p.pos]
+	if keyword := strings.ToLower(token); keyword == queryAnd || keyword == queryOr || keyword == queryNot {
+		return keyword
+	}
+
+	return token
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	return p.parseList(queryOr, p.parseAnd)
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	return p.parseList(queryAnd, p.parseNot)
+}
+
+// parseList parses operands joined by the operator. Operands next to each other are joined
+// by AND.
+func (p *queryParser) parseList(op string, parseOperand func() (queryNode, error)) (queryNode, error) {
+	first, err := parseOperand()
+	if err != nil {
+		return first, err
+	}
+
+	operands := []queryNode{first}
+
+	for {
+		switch next := p.peek(); {
+		case next == op:
+			p.pos++
+		case op == queryAnd && next != "" && next != queryOr && next != ")":
+		default:
+			if len(operands) == 1 {
+				return first, nil
+			}
+
+			return queryNode{op: op, tag: "", operands: operands}, nil
+		}
+
+		operand, err := parseOperand()
+		if err != nil {
+			return operand, err
+		}
+
+		operands = append(operands, operand)
+	}
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	switch next := p.peek(); next {
+	case queryNot:
+		p.pos++
+
+		operand, err := p.parseNot()
+		if err != nil {
+			return operand, err
+		}
+
+		return queryNode{op: queryNot, tag: "", operands: []queryNode{operand}}, nil
+	case "(":
+		p.pos++
+
+		node, err := p.parseOr()
+		if err != nil {
+			return node, err
+		}
+
+		if p.peek() != ")" {
+			return node, fmt.Errorf("missing ): %w", ErrInvalidQuery)
+		}
+
+		p.pos++
+
+		return node, nil
+	case "":
+		return queryNode{}, fmt.Errorf("unexpected end: %w", ErrInvalidQuery) //nolint:exhaustruct
+	case ")", queryAnd, queryOr:
+		return queryNode{}, fmt.Errorf("unexpected %q: %w", p.tokens[p.pos], ErrInvalidQuery) //nolint:exhaustruct
+	default:
+		tag := strings.ToLower(next)
+		if err := validateTag(tag); err != nil {
+			return queryNode{}, fmt.Errorf("%w: %v", ErrInvalidQuery, err) //nolint:exhaustruct,errorlint
+		}
+
+		p.pos++
+
+		return queryNode{op: "", tag: tag, operands: nil}, nil
+	}
+}
@@ -0,0 +1,240 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestTags(t *testing.T) {
+	newManager := func(t *testing.T) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	entryNames := func(entries []favorites2.Entry) []string {
+		result := make([]string, 0, len(entries))
+		for _, e := range entries {
+			result = append(result, e.Name)
+		}
+
+		return result
+	}
+
+	// newTree creates commands tagged with the tags.
+	newTree := func(t *testing.T, manager *favorites2.Manager, tags map[string][]string) map[string]int {
+		t.Helper()
+
+		ids := make(map[string]int, len(tags))
+
+		for _, name := range []string{"backup", "migrate", "psql", "flush", "deploy"} {
+			id, err := manager.AddCommand(name, "true", 0, 0)
+			require.NoError(t, err)
+			require.NoError(t, manager.SetTags(id, tags[name]))
+
+			ids[name] = id
+		}
+
+		return ids
+	}
+
+	tags := map[string][]string{
+		"backup":  {"prod", "db", "readonly"},
+		"migrate": {"prod", "db", "dangerous"},
+		"psql":    {"staging", "db"},
+		"flush":   {"prod", "cache", "dangerous"},
+		"deploy":  {"prod"},
+	}
+
+	t.Run("tags are normalized", func(t *testing.T) {
+		manager := newManager(t)
+
+		id, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+
+		require.NoError(t, manager.SetTags(id, []string{" Prod", "db", "prod", "team:ops"}))
+		e, err := manager.GetEntry(id)
+		require.NoError(t, err)
+		require.Equal(t, []string{"db", "prod", "team:ops"}, e.Tags)
+
+		for _, tag := range []string{"", "two words", "and", "NOT", "a(b)"} {
+			require.ErrorIs(t, manager.SetTags(id, []string{tag}), favorites2.ErrInvalidTag, tag)
+		}
+
+		require.ErrorIs(t, manager.SetTags(100, []string{"x"}), favorites2.ErrNotFound)
+
+		require.NoError(t, manager.SetTags(id, nil))
+		e, err = manager.GetEntry(id)
+		require.NoError(t, err)
+		require.Nil(t, e.Tags)
+		require.Empty(t, manager.Tags())
+	})
+
+	t.Run("entries are listed by tag", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager, tags)
+
+		require.Equal(t, []favorites2.TagCount{
+			{Tag: "cache", Count: 1},
+			{Tag: "dangerous", Count: 2},
+			{Tag: "db", Count: 3},
+			{Tag: "prod", Count: 4},
+			{Tag: "readonly", Count: 1},
+			{Tag: "staging", Count: 1},
+		}, manager.Tags())
+
+		require.Equal(t, []string{"backup", "migrate", "psql"}, entryNames(manager.ListByTag("DB")))
+		require.Empty(t, manager.ListByTag("unknown"))
+
+		require.NoError(t, manager.DeleteCommand(ids["psql"]))
+		require.Equal(t, []string{"backup", "migrate"}, entryNames(manager.ListByTag("db")))
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []string{"backup", "migrate", "psql"}, entryNames(manager.ListByTag("db")))
+
+		require.NoError(t, manager.SetTags(ids["psql"], []string{"staging"}))
+		require.Equal(t, []string{"backup", "migrate"}, entryNames(manager.ListByTag("db")))
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []string{"backup", "migrate", "psql"}, entryNames(manager.ListByTag("db")))
+	})
+
+	t.Run("returned tags are copies", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager, tags)
+
+		manager.ListByTag("db")[0].Tags[0] = "changed"
+
+		require.NoError(t, manager.SetTags(ids["psql"], []string{"staging"}))
+		require.NoError(t, manager.Undo())
+
+		e, err := manager.GetEntry(ids["psql"])
+		require.NoError(t, err)
+		e.Tags[0] = "changed"
+
+		for name, id := range ids {
+			e, err := manager.GetEntry(id)
+			require.NoError(t, err)
+			require.ElementsMatch(t, tags[name], e.Tags, name)
+		}
+	})
+
+	t.Run("boolean queries", func(t *testing.T) {
+		manager := newManager(t)
+		newTree(t, manager, tags)
+
+		for query, expected := range map[string][]string{
+			"prod AND db AND NOT readonly": {"migrate"},
+			"prod db not readonly":         {"migrate"},
+			"cache OR staging":             {"flush", "psql"},
+			"prod AND (db OR cache)":       {"backup", "flush", "migrate"},
+			"prod AND db OR cache":         {"backup", "flush", "migrate"},
+			"NOT prod":                     {"psql"},
+			"NOT NOT staging":              {"psql"},
+			"dangerous AND NOT (db)":       {"flush"},
+			"unknown":                      {},
+		} {
+			entries, err := manager.QueryTags(query)
+			require.NoError(t, err, query)
+			require.Equal(t, expected, entryNames(entries), query)
+		}
+
+		for _, query := range []string{"", "prod AND", "(prod", "prod)", "OR prod", "NOT", "a,b"} {
+			_, err := manager.QueryTags(query)
+			require.ErrorIs(t, err, favorites2.ErrInvalidQuery, query)
+		}
+
+		q, err := favorites2.ParseTagQuery("a b or not c")
+		require.NoError(t, err)
+		require.Equal(t, "((a AND b) OR NOT c)", q.String())
+		require.True(t, q.Match([]string{"a", "b", "c"}))
+		require.False(t, q.Match([]string{"a", "c"}))
+		require.True(t, q.Match(nil))
+	})
+
+	t.Run("tags are renamed and merged", func(t *testing.T) {
+		manager := newManager(t)
+		ids := newTree(t, manager, tags)
+
+		require.NoError(t, manager.RenameTag("staging", "Stage"))
+		require.Equal(t, []string{"psql"}, entryNames(manager.ListByTag("stage")))
+		require.Empty(t, manager.ListByTag("staging"))
+
+		require.NoError(t, manager.RenameTag("readonly", "db"))
+		e, err := manager.GetEntry(ids["backup"])
+		require.NoError(t, err)
+		require.Equal(t, []string{"db", "prod"}, e.Tags)
+
+		require.NoError(t, manager.MergeTags("risky", "dangerous", "cache"))
+		require.Equal(t, []string{"flush", "migrate"}, entryNames(manager.ListByTag("risky")))
+		require.Empty(t, manager.ListByTag("cache"))
+
+		require.ErrorIs(t, manager.RenameTag("unknown", "x"), favorites2.ErrTagNotFound)
+		require.ErrorIs(t, manager.RenameTag("db", "and"), favorites2.ErrInvalidTag)
+
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []string{"flush", "migrate"}, entryNames(manager.ListByTag("dangerous")))
+		require.Equal(t, []string{"flush"}, entryNames(manager.ListByTag("cache")))
+		require.Empty(t, manager.ListByTag("risky"))
+		require.Equal(t, favorites2.OpRenameTag, manager.History().Undo[len(manager.History().Undo)-1].Op)
+	})
+
+	t.Run("tag changes are sent as events", func(t *testing.T) {
+		manager := newManager(t)
+
+		id, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+
+		s := manager.Subscribe()
+		defer s.Close()
+
+		require.NoError(t, manager.SetTags(id, []string{"prod"}))
+
+		e := <-s.C
+		require.Equal(t, favorites2.EventTagsChanged, e.Kind)
+		require.Nil(t, e.Before.Tags)
+		require.Equal(t, []string{"prod"}, e.After.Tags)
+	})
+
+	t.Run("tags are stored and merged", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		newFileManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			return manager
+		}
+
+		manager := newFileManager()
+		x, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.SetTags(x, []string{"prod"}))
+		manager.SyncOut()
+
+		ours, theirs := newFileManager(), newFileManager()
+		require.Equal(t, []string{"x"}, entryNames(ours.ListByTag("prod")))
+
+		require.NoError(t, theirs.SetTags(x, []string{"prod", "db"}))
+		theirs.SyncOut()
+		require.NoError(t, ours.RenameEntry(x, "y"))
+		ours.SyncOut()
+
+		e, err := newFileManager().GetEntry(x)
+		require.NoError(t, err)
+		require.Equal(t, "y", e.Name)
+		require.Equal(t, []string{"db", "prod"}, e.Tags)
+		require.Equal(t, []string{"y"}, entryNames(ours.ListByTag("db")))
+	})
+}
@@ -0,0 +1,208 @@
+package favorites
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/list"
+)
+
+// TrashItem is a deleted entry, with its subtree if it is a dir, kept until it is restored or purged.
+type TrashItem struct {
+	Entry Entry `yaml:"entry" json:"entry" toml:"entry"`
+	// NextID is the entry the deleted one was placed before, 0 if it was the last one.
+	NextID    int       `yaml:"nextId" json:"nextId" toml:"nextId"`
+	DeletedAt time.Time `yaml:"deletedAt" json:"deletedAt" toml:"deletedAt"`
+}
+
+// ListTrash returns the deleted entries, the most recently deleted last. Entries deleted
+// more than trashRetention ago are not listed, they are purged on the next sync.
+func (m *Manager) ListTrash() []TrashItem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]TrashItem, 0, len(m.trash))
+
+	for _, item := range m.trash {
+		if !m.expired(item, time.Now()) {
+			item.Entry.Entries = cloneEntries(item.Entry.Entries)
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// Restore brings the deleted entry id with its subtree back to its dir, before the entry it
+// was placed before if that is still there, to the end otherwise. An entry of a dir deleted
+// for good is restored to the root.
+func (m *Manager) Restore(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.restore(id)
+}
+
+func (m *Manager) restore(id int) error {
+	i := m.trashIndex(id)
+	if i < 0 {
+		return fmt.Errorf("trashed entry %d: %w", id, ErrNotFound)
+	}
+
+	item := m.trash[i]
+	if _, err := m.getDir(item.Entry.ParentID); err != nil {
+		item.Entry.ParentID = 0
+	}
+
+	if err := m.restoreEntry(EntryState{Entry: item.Entry, NextID: item.NextID}); err != nil {
+		return err
+	}
+
+	defer m.notifySinker()
+
+	m.record(OpRestore, HistoryChange{After: m.state(m.getEntryByID(id), true), Trash: true}) //nolint:exhaustruct
+
+	return nil
+}
+
+// Purge deletes the deleted entry id for good.
+func (m *Manager) Purge(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.purge(id)
+}
+
+func (m *Manager) purge(id int) error {
+	i := m.trashIndex(id)
+	if i < 0 {
+		return fmt.Errorf("trashed entry %d: %w", id, ErrNotFound)
+	}
+
+	defer m.notifySinker()
+
+	m.untrash(id)
+
+	return nil
+}
+
+// trashEntry moves the entry with its subtree from the tree to the trash. mu must be held.
+func (m *Manager) trashEntry(node *list.Node[entry]) {
+	m.purgeExpired(time.Now())
+
+	state := m.state(node, true)
+	item := TrashItem{Entry: state.Entry, NextID: state.NextID, DeletedAt: time.Now()}
+	m.trash = append(m.trash, item)
+	m.recordTrash(item)
+
+	m.deleteEntry(node)
+}
+
+// untrash removes the entry from the trash if it is there. mu must be held.
+func (m *Manager) untrash(id int) {
+	if i := m.trashIndex(id); i >= 0 {
+		m.trash = append(m.trash[:i:i], m.trash[i+1:]...)
+		m.recordUntrash(id)
+	}
+}
+
+func (m *Manager) trashIndex(id int) int {
+	for i := range m.trash {
+		if m.trash[i].Entry.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// purgeExpired deletes entries kept longer than trashRetention for good. mu must be held.
+func (m *Manager) purgeExpired(now time.Time) {
+	kept := m.trash[:0:0]
+
+	for _, item := range m.trash {
+		if m.expired(item, now) {
+			m.recordUntrash(item.Entry.ID)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+
+	m.trash = kept
+}
+
+func (m *Manager) expired(item TrashItem, now time.Time) bool {
+	return m.opts.trashRetention > 0 && now.Sub(item.DeletedAt) > m.opts.trashRetention
+}
+
+// mergeTrash keeps the items present on both sides and the ones added on either side,
+// an item missing on one side has been restored or purged there. Items of entries that
+// are in the merged tree are dropped.
+func mergeTrash(base, ours, theirs []TrashItem, inTree func(id int) bool) []TrashItem {
+	index := func(items []TrashItem) map[int]bool {
+		ids := make(map[int]bool, len(items))
+		for _, item := range items {
+			ids[item.Entry.ID] = true
+		}
+
+		return ids
+	}
+
+	inBase, inOurs, inTheirs := index(base), index(ours), index(theirs)
+
+	var merged []TrashItem
+
+	for _, item := range theirs {
+		id := item.Entry.ID
+		if (inOurs[id] || !inBase[id]) && !inTree(id) {
+			merged = append(merged, item)
+		}
+	}
+
+	for _, item := range ours {
+		id := item.Entry.ID
+		if !inTheirs[id] && !inBase[id] && !inTree(id) {
+			merged = append(merged, item)
+		}
+	}
+
+	return merged
+}
+
+func sameTrash(a, b []TrashItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Entry.ID != b[i].Entry.ID {
+			return false
+		}
+	}
+
+	return true
+}
+
+func maxTrashID(trash []TrashItem) int {
+	entries := make([]Entry, 0, len(trash))
+	for _, item := range trash {
+		entries = append(entries, item.Entry)
+	}
+
+	return maxEntryID(entries)
+}
+
+func cloneTrash(trash []TrashItem) []TrashItem {
+	if trash == nil {
+		return nil
+	}
+
+	result := make([]TrashItem, len(trash))
+
+	for i := range trash {
+		result[i] = trash[i]
+		result[i].Entry.Entries = cloneEntries(trash[i].Entry.Entries)
+	}
+
+	return result
+}
@@ -0,0 +1,159 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestTrash(t *testing.T) {
+	newManager := func(t *testing.T, opts ...favorites2.OptOptionsSetter) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40, opts...))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	trashIDs := func(manager *favorites2.Manager) []int {
+		var ids []int
+		for _, item := range manager.ListTrash() {
+			ids = append(ids, item.Entry.ID)
+		}
+
+		return ids
+	}
+
+	t.Run("deleted entries are restored in place", func(t *testing.T) {
+		manager := newManager(t)
+
+		a, err := manager.AddCommand("a", "true", 0, 0)
+		require.NoError(t, err)
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("c", "true", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("uptime", "uptime", ops, 0)
+		require.NoError(t, err)
+
+		want := exportTree(manager, 0)
+
+		require.NoError(t, manager.DeleteDir(ops))
+		require.NoError(t, manager.DeleteCommand(a))
+		require.Equal(t, []string{"c"}, names(manager.ListDirectory(0)))
+		require.Equal(t, []int{ops, a}, trashIDs(manager))
+		require.Equal(t, []string{"uptime"}, names(manager.ListTrash()[0].Entry.Entries))
+
+		require.NoError(t, manager.Restore(a))
+		require.NoError(t, manager.Restore(ops))
+		require.Equal(t, want, exportTree(manager, 0))
+		require.Empty(t, manager.ListTrash())
+		require.Empty(t, manager.CheckIntegrity())
+		require.ErrorIs(t, manager.Restore(ops), favorites2.ErrNotFound)
+	})
+
+	t.Run("entries whose place is gone are restored elsewhere", func(t *testing.T) {
+		manager := newManager(t)
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		x, err := manager.AddCommand("x", "true", ops, 0)
+		require.NoError(t, err)
+		y, err := manager.AddCommand("y", "true", ops, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("z", "true", ops, 0)
+		require.NoError(t, err)
+
+		require.NoError(t, manager.DeleteCommand(x))
+		require.NoError(t, manager.DeleteCommand(y))
+		require.NoError(t, manager.Purge(y))
+		require.NoError(t, manager.Restore(x))
+		require.Equal(t, []string{"z", "x"}, names(manager.ListDirectory(ops)))
+
+		require.NoError(t, manager.DeleteCommand(x))
+		require.NoError(t, manager.DeleteDir(ops))
+		require.NoError(t, manager.Purge(ops))
+		require.NoError(t, manager.Restore(x))
+		require.Equal(t, []string{"x"}, names(manager.ListDirectory(0)))
+		require.ErrorIs(t, manager.Purge(ops), favorites2.ErrNotFound)
+	})
+
+	t.Run("old entries are purged", func(t *testing.T) {
+		manager := newManager(t, favorites2.WithTrashRetention(50*time.Millisecond))
+
+		x, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		y, err := manager.AddCommand("y", "true", 0, 0)
+		require.NoError(t, err)
+
+		require.NoError(t, manager.DeleteCommand(x))
+		time.Sleep(100 * time.Millisecond)
+		require.Empty(t, manager.ListTrash())
+
+		require.NoError(t, manager.DeleteCommand(y))
+		require.Equal(t, []int{y}, trashIDs(manager))
+		require.ErrorIs(t, manager.Restore(x), favorites2.ErrNotFound)
+	})
+
+	t.Run("undo takes entries out of the trash", func(t *testing.T) {
+		manager := newManager(t)
+
+		x, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.DeleteCommand(x))
+
+		require.NoError(t, manager.Undo())
+		require.Empty(t, manager.ListTrash())
+		require.NoError(t, manager.Redo())
+		require.Equal(t, []int{x}, trashIDs(manager))
+
+		require.NoError(t, manager.Restore(x))
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []int{x}, trashIDs(manager))
+		require.Empty(t, manager.ListDirectory(0))
+	})
+
+	t.Run("trash is stored and merged", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		newFileManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+			manager.Close()
+
+			return manager
+		}
+
+		ours := newFileManager()
+		x, err := ours.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		y, err := ours.AddCommand("y", "true", 0, 0)
+		require.NoError(t, err)
+		z, err := ours.AddCommand("z", "true", 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, ours.DeleteCommand(x))
+		require.NoError(t, ours.DeleteCommand(y))
+		ours.SyncOut()
+
+		theirs := newFileManager()
+		require.Equal(t, []int{x, y}, trashIDs(theirs))
+		require.NoError(t, theirs.Restore(x))
+		theirs.SyncOut()
+
+		require.NoError(t, ours.DeleteCommand(z))
+		ours.SyncOut()
+
+		require.Equal(t, []int{y, z}, trashIDs(ours))
+		require.Equal(t, []string{"x"}, names(ours.ListDirectory(0)))
+		require.Equal(t, []int{y, z}, trashIDs(newFileManager()))
+	})
+}
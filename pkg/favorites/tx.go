@@ -0,0 +1,291 @@
+package favorites
+
+import "fmt"
+
+// OpTx is the HistoryStep.Op of a transaction, it is undone and redone as a whole.
+const OpTx = "transaction"
+
+// Tx groups mutations made by the function passed to Manager.Tx. Its methods are the ones
+// of the Manager and see the changes made so far. A Tx must not be used after the function returns.
+type Tx struct {
+	m       *Manager
+	changes []HistoryChange
+	done    bool
+}
+
+// txSnapshot is the state a failed transaction is rolled back to.
+type txSnapshot struct {
+	entries  []Entry
+	metadata map[string]string
+	trash    []TrashItem
+	maxID    int
+	pending  int
+	fullSave bool
+}
+
+// Tx runs fn holding the Manager's lock, so other goroutines see either none of its changes or all
+// of them. Every operation is checked as it is applied and the resulting tree is checked as a
+// whole, if either check or fn fails, the tree is rolled back and the error is returned. A
+// committed transaction is synced once and is a single step of the history. fn must use the Tx only,
+// calling the Manager from it deadlocks.
+func (m *Manager) Tx(fn func(tx *Tx) error) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.snapshot()
+	tx := &Tx{m: m} //nolint:exhaustruct
+
+	m.tx = tx
+	m.batching.Store(true)
+
+	committed := false
+
+	defer func() {
+		tx.done, m.tx = true, nil
+		m.batching.Store(false)
+
+		if !committed {
+			m.rollback(snapshot)
+		}
+
+		// A merge may have been made meanwhile, so a failed transaction notifies too.
+		if m.batchNotified.Swap(false) {
+			m.notifySinker()
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = m.validate(); err != nil {
+		return err
+	}
+
+	m.tx = nil
+	committed = true
+
+	if len(tx.changes) > 0 {
+		m.record(OpTx, tx.changes...)
+	}
+
+	return nil
+}
+
+func (m *Manager) snapshot() txSnapshot {
+	return txSnapshot{
+		entries:  m.entries(),
+		metadata: cloneMetadata(m.metadata),
+		trash:    m.trash,
+		maxID:    m.maxID,
+		pending:  len(m.pending),
+		fullSave: m.fullSave,
+	}
+}
+
+func (m *Manager) rollback(s txSnapshot) {
+	m.root, m.EntryIDs = m.buildTree(s.entries)
+	m.metadata = s.metadata
+	m.trash = s.trash
+	m.maxID = s.maxID
+	m.pending = m.pending[:s.pending]
+	m.fullSave = s.fullSave
+	m.reindex()
+}
+
+// validate checks the whole tree like CheckIntegrity.
+func (m *Manager) validate() error {
+	walker := m.newIntegrityWalker()
+	walker.walk()
+
+	if len(walker.issues) > 0 {
+		return fmt.Errorf("%s: %w", walker.issues[0].String(), ErrTxInvalid)
+	}
+
+	return nil
+}
+
+func (t *Tx) check() error {
+	if t.done {
+		return ErrTxDone
+	}
+
+	return nil
+}
+
+func (t *Tx) AddCommand(name, exec string, parentID int, nextID int) (int, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+
+	return t.m.addCommand(name, exec, parentID, nextID)
+}
+
+func (t *Tx) AddDir(name string, parentID int, nextID int) (int, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+
+	return t.m.addDir(name, parentID, nextID)
+}
+
+func (t *Tx) DeleteCommand(id int) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.deleteCommand(id)
+}
+
+func (t *Tx) DeleteDir(id int) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.deleteDirByID(id)
+}
+
+func (t *Tx) ModifyExec(id int, exec string) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.modifyExec(id, exec)
+}
+
+func (t *Tx) RenameEntry(targetID int, name string) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.renameEntry(targetID, name)
+}
+
+func (t *Tx) MoveEntry(targetID, parentID, nextID int) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.moveEntry(targetID, parentID, nextID)
+}
+
+func (t *Tx) SetParams(id int, params []Param) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.setParams(id, params)
+}
+
+func (t *Tx) SetTags(id int, tags []string) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.setTags(id, tags)
+}
+
+func (t *Tx) RenameTag(from, to string) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.mergeTags(to, from)
+}
+
+func (t *Tx) MergeTags(into string, tags ...string) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.mergeTags(into, tags...)
+}
+
+func (t *Tx) AddSmartDir(name string, query SmartQuery, parentID int, nextID int) (int, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+
+	return t.m.addSmartDir(name, query, parentID, nextID)
+}
+
+func (t *Tx) SetSmartQuery(id int, query *SmartQuery) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.setSmartQuery(id, query)
+}
+
+func (t *Tx) AddLink(name string, targetID int, parentID int, nextID int) (int, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+
+	return t.m.addLink(name, targetID, parentID, nextID)
+}
+
+func (t *Tx) CopyEntry(id, parentID, nextID int, opts ...CopyOption) (int, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+
+	cfg := copyConfig{renamePattern: ""}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return t.m.copyEntry(id, parentID, nextID, cfg)
+}
+
+// SetMetadata is Manager.SetMetadata, unlike it fails if the Tx is done.
+func (t *Tx) SetMetadata(key, value string) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	t.m.setMetadata(key, value)
+
+	return nil
+}
+
+func (t *Tx) Restore(id int) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.restore(id)
+}
+
+func (t *Tx) Purge(id int) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	return t.m.purge(id)
+}
+
+func (t *Tx) GetEntry(id int) (Entry, error) {
+	if err := t.check(); err != nil {
+		return Entry{}, err //nolint:exhaustruct
+	}
+
+	return t.m.getEntry(id)
+}
+
+// ListDirectory is Manager.ListDirectory, it returns nil if the Tx is done.
+func (t *Tx) ListDirectory(id int) []Entry {
+	if t.check() != nil {
+		return nil
+	}
+
+	return t.m.listDirectory(id)
+}
+
+func (t *Tx) ResolvePath(p string) (int, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+
+	return t.m.resolvePath(p)
+}
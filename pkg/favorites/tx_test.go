@@ -0,0 +1,216 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestTx(t *testing.T) {
+	newManager := func(t *testing.T) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	t.Run("changes are committed as one step", func(t *testing.T) {
+		manager := newManager(t)
+
+		x, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		before := exportTree(manager, 0)
+
+		var ops int
+
+		require.NoError(t, manager.Tx(func(tx *favorites2.Tx) error {
+			if ops, err = tx.AddDir("ops", 0, 0); err != nil {
+				return err
+			}
+
+			if err = tx.MoveEntry(x, ops, 0); err != nil {
+				return err
+			}
+
+			if err = tx.RenameEntry(x, "y"); err != nil {
+				return err
+			}
+
+			entry, err := tx.GetEntry(x)
+			require.NoError(t, err)
+			require.Equal(t, ops, entry.ParentID)
+			require.Equal(t, []string{"y"}, names(tx.ListDirectory(ops)))
+
+			return tx.SetMetadata("owner", "ops")
+		}))
+
+		require.Equal(t, []string{"y"}, names(manager.ListDirectory(ops)))
+		require.Len(t, manager.History().Undo, 2)
+		require.Equal(t, favorites2.OpTx, manager.History().Undo[1].Op)
+
+		require.NoError(t, manager.Undo())
+		require.Equal(t, before, exportTree(manager, 0))
+		require.Empty(t, manager.Metadata())
+
+		require.NoError(t, manager.Redo())
+		require.Equal(t, []string{"y"}, names(manager.ListDirectory(ops)))
+	})
+
+	t.Run("failed transaction is rolled back", func(t *testing.T) {
+		manager := newManager(t)
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		x, err := manager.AddCommand("x", "true", ops, 0)
+		require.NoError(t, err)
+		manager.SetMetadata("owner", "ops")
+		before := exportTree(manager, 0)
+
+		errStop := errors.New("stop")
+
+		var escaped *favorites2.Tx
+
+		err = manager.Tx(func(tx *favorites2.Tx) error {
+			escaped = tx
+
+			require.NoError(t, tx.DeleteCommand(x))
+			require.NoError(t, tx.DeleteDir(ops))
+			_, err := tx.AddCommand("z", "true", 0, 0)
+			require.NoError(t, err)
+			require.NoError(t, tx.SetMetadata("owner", ""))
+
+			return errStop
+		})
+		require.ErrorIs(t, err, errStop)
+
+		err = manager.Tx(func(tx *favorites2.Tx) error {
+			_, err := tx.AddCommand("z", "true", 0, 0)
+			require.NoError(t, err)
+
+			return tx.MoveEntry(ops, ops, 0)
+		})
+		require.ErrorIs(t, err, favorites2.ErrCycle)
+
+		require.Equal(t, before, exportTree(manager, 0))
+		require.Equal(t, map[string]string{"owner": "ops"}, manager.Metadata())
+		require.Empty(t, manager.ListTrash())
+		require.Len(t, manager.History().Undo, 3)
+		require.Empty(t, manager.CheckIntegrity())
+		require.ErrorIs(t, escaped.RenameEntry(x, "y"), favorites2.ErrTxDone)
+
+		id, err := manager.AddCommand("z", "true", 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, x+1, id)
+	})
+
+	t.Run("tags are indexed as they change", func(t *testing.T) {
+		manager := newManager(t)
+
+		x, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		y, err := manager.AddCommand("y", "true", 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.SetTags(x, []string{"db"}))
+		require.NoError(t, manager.SetTags(y, []string{"db"}))
+
+		require.NoError(t, manager.Tx(func(tx *favorites2.Tx) error {
+			require.NoError(t, tx.DeleteCommand(x))
+			require.NoError(t, tx.RenameTag("db", "sql"))
+			require.NoError(t, tx.SetTags(y, []string{"x"}))
+
+			return tx.RenameTag("x", "y")
+		}))
+
+		require.Equal(t, []favorites2.TagCount{{Tag: "y", Count: 1}}, manager.Tags())
+		require.Equal(t, []int{y}, ids(manager.ListByTag("y")))
+
+		// A rolled back transaction leaves the indexes as they were.
+		require.Error(t, manager.Tx(func(tx *favorites2.Tx) error {
+			require.NoError(t, tx.RenameTag("y", "z"))
+
+			return errors.New("stop")
+		}))
+		require.Equal(t, []int{y}, ids(manager.ListByTag("y")))
+		require.Empty(t, manager.ListByTag("z"))
+
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []int{x, y}, ids(manager.ListByTag("db")))
+		require.Equal(t, []favorites2.TagCount{{Tag: "db", Count: 2}}, manager.Tags())
+	})
+
+	t.Run("readers see all or nothing", func(t *testing.T) {
+		manager := newManager(t)
+
+		ids := make([]int, 0, 10)
+		for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+			id, err := manager.AddCommand(name, "true", 0, 0)
+			require.NoError(t, err)
+
+			ids = append(ids, id)
+		}
+
+		var wg sync.WaitGroup
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 20; i++ {
+				require.NoError(t, manager.Tx(func(tx *favorites2.Tx) error {
+					for _, id := range ids {
+						if err := tx.MoveEntry(id, 0, 0); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				}))
+			}
+		}()
+
+		for i := 0; i < 100; i++ {
+			require.Equal(t, []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}, names(manager.ListDirectory(0)))
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("committed transaction is synced", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40))
+		require.NoError(t, err)
+
+		require.NoError(t, manager.Tx(func(tx *favorites2.Tx) error {
+			for _, name := range []string{"a", "b", "c"} {
+				if _, err := tx.AddCommand(name, "true", 0, 0); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}))
+		manager.Close()
+
+		manager, err = favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40))
+		require.NoError(t, err)
+		manager.Close()
+
+		require.Equal(t, []string{"a", "b", "c"}, names(manager.ListDirectory(0)))
+	})
+}
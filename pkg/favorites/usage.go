@@ -0,0 +1,361 @@
+package favorites
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// maxUsageDirs is the number of working directories a Usage counts, the least used are dropped.
+	maxUsageDirs = 16
+	// dirUseWeight is how much more a use in the directory of the query counts.
+	dirUseWeight = 2
+	// frecencyBonusWeight scales the search bonus of frequently and recently used entries.
+	frecencyBonusWeight = 4
+)
+
+// Weights of the uses by the age of the last one, see Usage.Frecency.
+const (
+	weightHour  = 4
+	weightDay   = 2
+	weightWeek  = 0.5
+	weightOlder = 0.25
+	day         = 24 * time.Hour
+	week        = 7 * day
+)
+
+// Usage is how often, when and where a command has been run.
+type Usage struct {
+	ID       int       `yaml:"id" json:"id" toml:"id"`
+	Count    int       `yaml:"count" json:"count" toml:"count"`
+	LastUsed time.Time `yaml:"lastUsed" json:"lastUsed" toml:"lastUsed"`
+	// Dirs counts the uses by the working directory they were made in.
+	Dirs map[string]int `yaml:"dirs,omitempty" json:"dirs,omitempty" toml:"dirs,omitempty"`
+}
+
+// Add returns the sum of the usages of the same entry.
+func (u Usage) Add(other Usage) Usage {
+	result := Usage{
+		ID:       other.ID,
+		Count:    u.Count + other.Count,
+		LastUsed: u.LastUsed,
+		Dirs:     make(map[string]int, len(u.Dirs)+len(other.Dirs)),
+	}
+
+	if u.ID != 0 {
+		result.ID = u.ID
+	}
+
+	if other.LastUsed.After(result.LastUsed) {
+		result.LastUsed = other.LastUsed
+	}
+
+	for _, dirs := range []map[string]int{u.Dirs, other.Dirs} {
+		for dir, n := range dirs {
+			result.Dirs[dir] += n
+		}
+	}
+
+	result.trimDirs()
+
+	if len(result.Dirs) == 0 {
+		result.Dirs = nil
+	}
+
+	return result
+}
+
+func (u Usage) clone() Usage {
+	if u.Dirs != nil {
+		dirs := make(map[string]int, len(u.Dirs))
+		for dir, n := range u.Dirs {
+			dirs[dir] = n
+		}
+
+		u.Dirs = dirs
+	}
+
+	return u
+}
+
+// trimDirs drops the least used directories above maxUsageDirs.
+func (u *Usage) trimDirs() {
+	if len(u.Dirs) <= maxUsageDirs {
+		return
+	}
+
+	dirs := make([]string, 0, len(u.Dirs))
+	for dir := range u.Dirs {
+		dirs = append(dirs, dir)
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		if u.Dirs[dirs[i]] != u.Dirs[dirs[j]] {
+			return u.Dirs[dirs[i]] > u.Dirs[dirs[j]]
+		}
+
+		return dirs[i] < dirs[j]
+	})
+
+	for _, dir := range dirs[maxUsageDirs:] {
+		delete(u.Dirs, dir)
+	}
+}
+
+// Frecency scores the usage by frequency and recency: the number of uses, those made in dir
+// counted thrice, weighted by the age of the last use from 4 within an hour to 1/4 after a week.
+func (u Usage) Frecency(now time.Time, dir string) float64 {
+	uses := float64(u.Count)
+	if dir != "" {
+		uses += dirUseWeight * float64(u.Dirs[dir])
+	}
+
+	switch age := now.Sub(u.LastUsed); {
+	case age < time.Hour:
+		return uses * weightHour
+	case age < day:
+		return uses * weightDay
+	case age < week:
+		return uses * weightWeek
+	default:
+		return uses * weightOlder
+	}
+}
+
+// frecencyBonus is added to the search score, it grows slowly so a frequently used entry does
+// not outrank much better matches.
+func frecencyBonus(frecency float64) int {
+	return int(math.Log2(1+frecency) * frecencyBonusWeight)
+}
+
+// UsageStore is a Store keeping usage statistics. They are stored apart from the tree,
+// recording a use does not save the tree.
+type UsageStore interface {
+	Store
+	// LoadUsage returns the stored usage of every entry ever used.
+	LoadUsage() ([]Usage, error)
+	// AddUsage adds the uses to the stored usage, keeping the uses added by other processes,
+	// and returns the stored usage.
+	AddUsage(uses []Usage) ([]Usage, error)
+}
+
+// UsefulEntry is an entry ranked by its usage.
+type UsefulEntry struct {
+	Entry    Entry   `json:"entry"`
+	Path     string  `json:"path"`
+	Usage    Usage   `json:"usage"`
+	Frecency float64 `json:"frecency"`
+}
+
+// RecordUse records a use of the command id in the working directory dir, "" if unknown.
+// Run records uses itself. The usage is saved by the syncer apart from the tree.
+func (m *Manager) RecordUse(id int, dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node := m.getEntryByID(id)
+
+	switch {
+	case node == nil:
+		return fmt.Errorf("entry %d: %w", id, ErrNotFound)
+	case node.Value.IsDir:
+		return fmt.Errorf("entry %d: %w", id, ErrNotACommand)
+	}
+
+	use := Usage{ID: id, Count: 1, LastUsed: time.Now(), Dirs: nil}
+	if dir != "" {
+		use.Dirs = map[string]int{dir: 1}
+	}
+
+	if m.uses == nil {
+		m.uses = make(map[int]Usage)
+	}
+
+	m.uses[id] = m.uses[id].Add(use)
+	m.usage[id] = m.usage[id].Add(use)
+
+	m.notifyUsage()
+
+	return nil
+}
+
+// Usage returns the usage of the entry id, false if it has never been used.
+func (m *Manager) Usage(id int) (Usage, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	usage, ok := m.usage[id]
+
+	return usage.clone(), ok
+}
+
+// MostUseful returns the used commands by frecency in the working directory dir, "" for any,
+// the most useful first, at most limit of them unless limit is 0.
+func (m *Manager) MostUseful(limit int, dir string) []UsefulEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]UsefulEntry, 0, len(m.usage))
+
+	for id, usage := range m.usage {
+		// The usage outlives the entries, it may refer to ones deleted or not indexed.
+		node, indexed := m.getEntryByID(id), m.index[id]
+		if node == nil || indexed == nil || node.Value.IsDir {
+			continue
+		}
+
+		result = append(result, UsefulEntry{
+			Entry:    m.entry2ExternalEntry(node.Value, false),
+			Path:     indexed.path,
+			Usage:    usage.clone(),
+			Frecency: usage.Frecency(now, dir),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+
+		switch {
+		case a.Frecency != b.Frecency:
+			return a.Frecency > b.Frecency
+		case !a.Usage.LastUsed.Equal(b.Usage.LastUsed):
+			return a.Usage.LastUsed.After(b.Usage.LastUsed)
+		default:
+			return a.Entry.ID < b.Entry.ID
+		}
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
+
+// notifyUsage asks the syncer to save the usage. mu must be held.
+func (m *Manager) notifyUsage() {
+	if m.opts.inMemory {
+		return
+	}
+
+	select {
+	case m.usageNotification <- struct{}{}:
+	default:
+	}
+}
+
+// loadUsage reads the usage saved by the store.
+func (m *Manager) loadUsage() {
+	var usage []Usage
+
+	if store, ok := m.store.(UsageStore); ok {
+		var err error
+
+		if usage, err = store.LoadUsage(); err != nil {
+			m.log.Warn("store.LoadUsage():", err)
+		}
+	}
+
+	m.mu.Lock()
+	m.usage = usageByID(usage)
+	m.mu.Unlock()
+}
+
+// SyncUsage saves the uses recorded since the last save and reads the uses saved by others.
+func (m *Manager) SyncUsage() {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	m.saveUsage()
+}
+
+// saveUsage adds the recorded uses to the store, if there are any. syncMu must be held.
+func (m *Manager) saveUsage() {
+	store, ok := m.store.(UsageStore)
+	if !ok {
+		return
+	}
+
+	m.mu.Lock()
+	uses := m.uses
+	m.uses = nil
+	m.mu.Unlock()
+
+	if len(uses) == 0 {
+		return
+	}
+
+	usage, err := store.AddUsage(usageList(uses))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.log.Warn("store.AddUsage():", err)
+
+		// The uses recorded meanwhile are already in m.uses.
+		for id, use := range uses {
+			if m.uses == nil {
+				m.uses = make(map[int]Usage)
+			}
+
+			m.uses[id] = m.uses[id].Add(use)
+		}
+
+		return
+	}
+
+	m.usage = usageByID(usage)
+	for id, use := range m.uses {
+		m.usage[id] = m.usage[id].Add(use)
+	}
+}
+
+// AddUsage returns the sum of the usage and the uses sorted by ID, for UsageStore implementations.
+func AddUsage(usage, uses []Usage) []Usage {
+	byID := usageByID(usage)
+	for _, use := range uses {
+		byID[use.ID] = byID[use.ID].Add(use)
+	}
+
+	return usageList(byID)
+}
+
+func usageByID(usage []Usage) map[int]Usage {
+	result := make(map[int]Usage, len(usage))
+	for _, u := range usage {
+		result[u.ID] = result[u.ID].Add(u)
+	}
+
+	return result
+}
+
+func usageList(byID map[int]Usage) []Usage {
+	result := make([]Usage, 0, len(byID))
+	for id, u := range byID {
+		u.ID = id
+		result = append(result, u)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result
+}
+
+// useDir is the working directory a command run in dir is used in, the current one if dir is "".
+func useDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	return wd
+}
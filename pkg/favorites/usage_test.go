@@ -0,0 +1,146 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestUsage(t *testing.T) {
+	newManager := func(t *testing.T) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(true, "rubbish", time.Minute, 40))
+		require.NoError(t, err)
+
+		return manager
+	}
+
+	paths := func(entries []favorites2.UsefulEntry) []string {
+		result := make([]string, 0, len(entries))
+		for _, e := range entries {
+			result = append(result, e.Path)
+		}
+
+		return result
+	}
+
+	t.Run("frecency weights uses by recency", func(t *testing.T) {
+		now := time.Now()
+		usage := favorites2.Usage{ID: 1, Count: 4, LastUsed: now, Dirs: map[string]int{"/src": 1}}
+
+		require.InDelta(t, 16.0, usage.Frecency(now, ""), 1e-9)
+		require.InDelta(t, 24.0, usage.Frecency(now, "/src"), 1e-9)
+		require.InDelta(t, 8.0, usage.Frecency(now.Add(2*time.Hour), ""), 1e-9)
+		require.InDelta(t, 2.0, usage.Frecency(now.Add(48*time.Hour), ""), 1e-9)
+		require.InDelta(t, 1.0, usage.Frecency(now.Add(30*24*time.Hour), ""), 1e-9)
+	})
+
+	t.Run("uses are recorded", func(t *testing.T) {
+		manager := newManager(t)
+
+		ops, err := manager.AddDir("ops", 0, 0)
+		require.NoError(t, err)
+		x, err := manager.AddCommand("x", "true", ops, 0)
+		require.NoError(t, err)
+		y, err := manager.AddCommand("y", "true", 0, 0)
+		require.NoError(t, err)
+
+		_, ok := manager.Usage(x)
+		require.False(t, ok)
+		require.Empty(t, manager.MostUseful(0, ""))
+
+		require.ErrorIs(t, manager.RecordUse(ops, ""), favorites2.ErrNotACommand)
+		require.ErrorIs(t, manager.RecordUse(100, ""), favorites2.ErrNotFound)
+
+		require.NoError(t, manager.RecordUse(x, "/src"))
+		require.NoError(t, manager.RecordUse(y, "/tmp"))
+		require.NoError(t, manager.RecordUse(y, ""))
+
+		usage, ok := manager.Usage(y)
+		require.True(t, ok)
+		require.Equal(t, y, usage.ID)
+		require.Equal(t, 2, usage.Count)
+		require.Equal(t, map[string]int{"/tmp": 1}, usage.Dirs)
+		require.WithinDuration(t, time.Now(), usage.LastUsed, time.Minute)
+
+		usage.Dirs["/tmp"] = 10
+		usage, _ = manager.Usage(y)
+		require.Equal(t, 1, usage.Dirs["/tmp"])
+
+		require.Equal(t, []string{"/y", "/ops/x"}, paths(manager.MostUseful(0, "")))
+		require.Equal(t, []string{"/ops/x", "/y"}, paths(manager.MostUseful(0, "/src")))
+		require.Equal(t, []string{"/y"}, paths(manager.MostUseful(1, "")))
+
+		require.NoError(t, manager.DeleteCommand(y))
+		require.Equal(t, []string{"/ops/x"}, paths(manager.MostUseful(0, "")))
+		require.NoError(t, manager.Undo())
+		require.Equal(t, []string{"/y", "/ops/x"}, paths(manager.MostUseful(0, "")))
+	})
+
+	t.Run("used entries rank higher in search", func(t *testing.T) {
+		manager := newManager(t)
+
+		_, err := manager.AddCommand("deploy staging", "true", 0, 0)
+		require.NoError(t, err)
+		prod, err := manager.AddCommand("deploy prod", "true", 0, 0)
+		require.NoError(t, err)
+
+		require.Equal(t, "/deploy prod", manager.Search("deploy", 0)[0].Path)
+
+		staging := manager.Search("deploy", 0)[1].Entry.ID
+		require.NotEqual(t, prod, staging)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, manager.RecordUse(staging, ""))
+		}
+
+		require.Equal(t, "/deploy staging", manager.Search("deploy", 0)[0].Path)
+	})
+
+	t.Run("usage is stored apart from the config", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		newFileManager := func() *favorites2.Manager {
+			manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+				favorites2.NewOptions(false, configPath, time.Minute, 40))
+			require.NoError(t, err)
+
+			return manager
+		}
+
+		manager := newFileManager()
+		x, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		manager.Close()
+
+		// Saving the tree without any uses leaves the usage alone.
+		require.NoFileExists(t, configPath+".usage.lock")
+
+		config, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+
+		ours, theirs := newFileManager(), newFileManager()
+		require.NoError(t, ours.RecordUse(x, "/src"))
+		require.NoError(t, theirs.RecordUse(x, "/src"))
+		ours.Close()
+		theirs.Close()
+
+		usage, ok := newFileManager().Usage(x)
+		require.True(t, ok)
+		require.Equal(t, 2, usage.Count)
+		require.Equal(t, map[string]int{"/src": 2}, usage.Dirs)
+
+		after, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		require.Equal(t, config, after)
+	})
+}
@@ -0,0 +1,72 @@
+package favorites
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch reports changes of the file. The directory is watched rather than the file, as editors
+// and Save replace the file by renaming another one over it. Fails if the platform or
+// the file system does not support watching.
+func (s *FileStore) Watch() (<-chan struct{}, func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, fmt.Errorf("fsnotify.NewWatcher(): %w", err)
+	}
+
+	dir, name := filepath.Split(filepath.Clean(s.path))
+	if dir == "" {
+		dir = "."
+	}
+
+	if err = watcher.Add(dir); err != nil {
+		_ = watcher.Close()
+
+		return nil, nil, fmt.Errorf("watcher.Add(dir): %w", err)
+	}
+
+	changes := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		defer close(done)
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Base(event.Name) == name && event.Has(fsnotify.Write|fsnotify.Create) {
+					notify()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				// Events may have been lost, the file is checked anyway.
+				s.log.Warn("watcher:", err)
+				notify()
+			}
+		}
+	}()
+
+	return changes, func() {
+		if err := watcher.Close(); err != nil {
+			s.log.Warn("watcher.Close():", err)
+		}
+
+		<-done
+	}, nil
+}
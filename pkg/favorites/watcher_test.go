@@ -0,0 +1,130 @@
+//nolint:paralleltest,funlen
+package favorites_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	favorites2 "github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+func TestWatcher(t *testing.T) {
+	newManager := func(t *testing.T, configPath string, period time.Duration,
+		opts ...favorites2.OptOptionsSetter,
+	) *favorites2.Manager {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, period, 40, opts...))
+		require.NoError(t, err)
+		t.Cleanup(manager.Close)
+
+		return manager
+	}
+
+	// external edits the config with another manager.
+	external := func(t *testing.T, configPath, name string) {
+		t.Helper()
+
+		manager, err := favorites2.NewManager(context.Background(), logrus.New(),
+			favorites2.NewOptions(false, configPath, time.Minute, 40))
+		require.NoError(t, err)
+		manager.Close()
+
+		_, err = manager.AddCommand(name, "true", 0, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+	}
+
+	has := func(manager *favorites2.Manager, name string) func() bool {
+		return func() bool {
+			_, err := manager.ResolvePath("/" + name)
+
+			return err == nil
+		}
+	}
+
+	t.Run("file changes are picked up without polling", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		manager := newManager(t, configPath, time.Hour)
+
+		_, err := manager.AddCommand("ours", "true", 0, 0)
+		require.NoError(t, err)
+		// Saved before the external edit, so that they do not add entries with the same ID.
+		manager.SyncOut()
+
+		external(t, configPath, "first")
+		require.Eventually(t, has(manager, "first"), 5*time.Second, 10*time.Millisecond)
+
+		for _, name := range []string{"second", "third", "fourth"} {
+			external(t, configPath, name)
+		}
+
+		require.Eventually(t, has(manager, "fourth"), 5*time.Second, 10*time.Millisecond)
+		require.True(t, has(manager, "ours")())
+		require.Empty(t, manager.Conflicts())
+	})
+
+	t.Run("file changes are merged with unsaved changes", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		manager := newManager(t, configPath, time.Hour)
+
+		// The transaction holds the save back until the external edit is done, so both add entry 1.
+		require.NoError(t, manager.Tx(func(tx *favorites2.Tx) error {
+			if _, err := tx.AddCommand("ours", "true", 0, 0); err != nil {
+				return err
+			}
+
+			external(t, configPath, "theirs")
+
+			return nil
+		}))
+
+		require.Eventually(t, has(manager, "theirs"), 5*time.Second, 10*time.Millisecond)
+		require.True(t, has(manager, "ours")())
+
+		conflicts := manager.Conflicts()
+		require.Len(t, conflicts, 1)
+		require.Contains(t, conflicts[0].String(), "added on both sides")
+	})
+
+	t.Run("editors replacing the file", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "favorites.yaml")
+		manager := newManager(t, configPath, time.Hour)
+
+		_, err := manager.AddCommand("ours", "true", 0, 0)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(configPath)
+
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+
+		for i, name := range []string{"first", "second"} {
+			swap := filepath.Join(dir, ".favorites.yaml.swp")
+			content := fmt.Sprintf("nextId: 200\nentries:\n"+
+				"  - {id: 1, name: ours, exec: 'true'}\n"+
+				"  - {id: %d, name: %s, exec: 'true'}\n", 100+i, name)
+
+			require.NoError(t, os.WriteFile(swap, []byte(content), 0o600))
+			require.NoError(t, os.Rename(swap, configPath))
+			require.Eventually(t, has(manager, name), 5*time.Second, 10*time.Millisecond)
+		}
+	})
+
+	t.Run("polling fallback", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "favorites.yaml")
+		manager := newManager(t, configPath, 10*time.Millisecond, favorites2.WithDisableWatch(true))
+
+		external(t, configPath, "first")
+		require.Eventually(t, has(manager, "first"), 5*time.Second, 10*time.Millisecond)
+	})
+}
@@ -86,7 +86,13 @@ func (l *DeLinkedList[T]) insertLast(value T) *Node[T] {
 func (l *DeLinkedList[T]) insertNodeLast(node *Node[T]) {
 	node.Prev = l.Tail
 	node.Next = nil
-	l.Tail.Next = node
+
+	if l.Tail != nil {
+		l.Tail.Next = node
+	} else {
+		l.Head = node
+	}
+
 	l.Tail = node
 }
 
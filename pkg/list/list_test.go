@@ -132,6 +132,12 @@ func TestDeLinkedList(t *testing.T) {
 		require.Equal(t, 1, l.Len())
 	})
 
+	t.Run("move the only one to last", func(t *testing.T) {
+		l.MoveItem(l.Head, nil, nil)
+		require.Equal(t, []int{3}, l.List())
+		require.Equal(t, l.Head, l.Tail)
+	})
+
 	t.Run("delete the last one", func(t *testing.T) {
 		l.DeleteElement(l.Tail)
 		require.Equal(t, 0, l.Len())
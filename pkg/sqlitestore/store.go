@@ -0,0 +1,784 @@
+// Package sqlitestore keeps the favorites tree in an SQLite database, one row per entry,
+// so changes of single entries do not rewrite the whole tree.
+package sqlitestore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the driver
+
+	"github.com/gerladeno/favorites-mechanics/pkg/favorites"
+)
+
+// positionStep is the gap between positions of siblings, an entry is placed in the middle of
+// the gap between its neighbours. Siblings are renumbered when a gap is used up.
+const positionStep = 1 << 16
+
+const schema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS entries (
+	id         INTEGER PRIMARY KEY,
+	uid        TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	exec       TEXT NOT NULL,
+	params     TEXT NOT NULL,
+	tags       TEXT NOT NULL DEFAULT '',
+	smart      TEXT NOT NULL DEFAULT '',
+	link       INTEGER NOT NULL DEFAULT 0,
+	parent_id  INTEGER NOT NULL,
+	position   INTEGER NOT NULL,
+	is_dir     INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS entries_order ON entries (parent_id, position);
+CREATE TABLE IF NOT EXISTS metadata (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS trash (
+	id       INTEGER PRIMARY KEY,
+	position INTEGER NOT NULL,
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS history (
+	id   INTEGER PRIMARY KEY CHECK (id = 1),
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS usage (
+	id   INTEGER PRIMARY KEY,
+	data TEXT NOT NULL
+);
+`
+
+const (
+	keyRevision = "revision"
+	keyNextID   = "nextId"
+)
+
+// Store is a favorites.IncrementalStore of an SQLite database. Every Save and Apply is a single
+// transaction incrementing the revision of the database, which tells Load and other Stores of
+// the same database whether the tree has changed.
+type Store struct {
+	db       *sql.DB
+	mu       sync.Mutex
+	revision int64
+	loaded   bool
+}
+
+var (
+	_ favorites.IncrementalStore = (*Store)(nil)
+	_ favorites.HistoryStore     = (*Store)(nil)
+	_ favorites.UsageStore       = (*Store)(nil)
+)
+
+// New opens the database at path, creating it if needed.
+func New(path string) (*Store, error) {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + //nolint:exhaustruct
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open(sqlite, dsn): %w", err)
+	}
+
+	if _, err = db.Exec(schema); err != nil {
+		_ = db.Close()
+
+		return nil, fmt.Errorf("db.Exec(schema): %w", err)
+	}
+
+	if err = migrate(db); err != nil {
+		_ = db.Close()
+
+		return nil, err
+	}
+
+	return &Store{db: db}, nil //nolint:exhaustruct
+}
+
+// migrate adds the columns missing in databases created by older versions.
+func migrate(db *sql.DB) error {
+	for _, column := range []struct{ name, definition string }{
+		{"tags", `TEXT NOT NULL DEFAULT ''`},
+		{"smart", `TEXT NOT NULL DEFAULT ''`},
+		{"link", `INTEGER NOT NULL DEFAULT 0`},
+	} {
+		var exists bool
+
+		err := db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info('entries') WHERE name = ?`, column.name).
+			Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("select entries columns: %w", err)
+		}
+
+		if exists {
+			continue
+		}
+
+		if _, err = db.Exec(`ALTER TABLE entries ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+			return fmt.Errorf("add %s column: %w", column.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close() //nolint:wrapcheck
+}
+
+func (s *Store) Load() (favorites.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var doc favorites.Document
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		revision, err := getMeta(tx, keyRevision)
+		if err != nil {
+			return err
+		}
+
+		if s.loaded && revision == s.revision {
+			return favorites.ErrNotModified
+		}
+
+		nextID, err := getMeta(tx, keyNextID)
+		if err != nil {
+			return err
+		}
+
+		metadata, err := loadMetadata(tx)
+		if err != nil {
+			return err
+		}
+
+		entries, err := loadEntries(tx)
+		if err != nil {
+			return err
+		}
+
+		trash, err := loadTrash(tx)
+		if err != nil {
+			return err
+		}
+
+		doc = favorites.Document{
+			Version:  favorites.SchemaVersion,
+			Metadata: metadata,
+			NextID:   int(nextID),
+			Entries:  entries,
+			Trash:    trash,
+		}
+		s.revision, s.loaded = revision, true
+
+		return nil
+	})
+
+	return doc, err
+}
+
+// Save replaces all the rows with the tree.
+func (s *Store) Save(doc favorites.Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(doc.NextID, func(tx *sql.Tx) error {
+		for _, table := range []string{"entries", "metadata", "trash"} {
+			if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+				return fmt.Errorf("delete %s: %w", table, err)
+			}
+		}
+
+		for key, value := range doc.Metadata {
+			if _, err := tx.Exec(`INSERT INTO metadata (key, value) VALUES (?, ?)`, key, value); err != nil {
+				return fmt.Errorf("insert metadata %s: %w", key, err)
+			}
+		}
+
+		for _, item := range doc.Trash {
+			if err := insertTrash(tx, item); err != nil {
+				return err
+			}
+		}
+
+		return insertEntries(tx, doc.Entries)
+	})
+}
+
+// Apply updates the rows of the changed entries in a single transaction.
+func (s *Store) Apply(changes []favorites.Change, nextID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(nextID, func(tx *sql.Tx) error {
+		for _, change := range changes {
+			var err error
+
+			switch change.Kind {
+			case favorites.ChangePut:
+				err = putEntry(tx, change.Entry, change.NextID)
+			case favorites.ChangeDelete:
+				_, err = tx.Exec(`DELETE FROM entries WHERE id = ?`, change.Entry.ID)
+			case favorites.ChangeTrash:
+				err = insertTrash(tx, *change.Item)
+			case favorites.ChangeUntrash:
+				_, err = tx.Exec(`DELETE FROM trash WHERE id = ?`, change.Entry.ID)
+			default:
+				err = fmt.Errorf("change kind %d: %w", change.Kind, favorites.ErrUnsupported)
+			}
+
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", change.Entry.ID, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// LoadHistory returns the history kept as a single JSON row.
+func (s *Store) LoadHistory() (favorites.History, error) {
+	var (
+		history favorites.History
+		data    string
+	)
+
+	err := s.db.QueryRow(`SELECT data FROM history WHERE id = 1`).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return history, nil
+		}
+
+		return history, fmt.Errorf("select history: %w", err)
+	}
+
+	if err = json.Unmarshal([]byte(data), &history); err != nil {
+		return history, fmt.Errorf("json.Unmarshal(data, &history): %w", err)
+	}
+
+	return history, nil
+}
+
+// SaveHistory replaces the history. It does not change the revision, the tree is the same.
+func (s *Store) SaveHistory(history favorites.History) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("json.Marshal(history): %w", err)
+	}
+
+	if _, err = s.db.Exec(`INSERT OR REPLACE INTO history (id, data) VALUES (1, ?)`, string(data)); err != nil {
+		return fmt.Errorf("update history: %w", err)
+	}
+
+	return nil
+}
+
+// LoadUsage returns the usage kept as a JSON row per entry.
+func (s *Store) LoadUsage() ([]favorites.Usage, error) {
+	var usage []favorites.Usage
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		var err error
+
+		usage, err = loadUsage(tx)
+
+		return err
+	})
+
+	return usage, err
+}
+
+// AddUsage adds the uses to the rows of their entries in a single transaction. It does not
+// change the revision, the tree is the same.
+func (s *Store) AddUsage(uses []favorites.Usage) ([]favorites.Usage, error) {
+	var usage []favorites.Usage
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		for _, use := range uses {
+			var (
+				stored favorites.Usage
+				data   string
+			)
+
+			err := tx.QueryRow(`SELECT data FROM usage WHERE id = ?`, use.ID).Scan(&data)
+
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+			case err != nil:
+				return fmt.Errorf("select usage %d: %w", use.ID, err)
+			default:
+				if err = json.Unmarshal([]byte(data), &stored); err != nil {
+					return fmt.Errorf("usage %d: %w", use.ID, err)
+				}
+			}
+
+			encoded, err := json.Marshal(stored.Add(use))
+			if err != nil {
+				return fmt.Errorf("json.Marshal(usage): %w", err)
+			}
+
+			if _, err = tx.Exec(`INSERT OR REPLACE INTO usage (id, data) VALUES (?, ?)`, use.ID, string(encoded)); err != nil {
+				return fmt.Errorf("update usage %d: %w", use.ID, err)
+			}
+		}
+
+		var err error
+
+		usage, err = loadUsage(tx)
+
+		return err
+	})
+
+	return usage, err
+}
+
+func loadUsage(tx *sql.Tx) ([]favorites.Usage, error) {
+	rows, err := tx.Query(`SELECT data FROM usage ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("select usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []favorites.Usage
+
+	for rows.Next() {
+		var (
+			u    favorites.Usage
+			data string
+		)
+
+		if err = rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("rows.Scan(): %w", err)
+		}
+
+		if err = json.Unmarshal([]byte(data), &u); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal(data, &u): %w", err)
+		}
+
+		usage = append(usage, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(): %w", err)
+	}
+
+	return usage, nil
+}
+
+// write runs fn in a transaction unless the database has been changed since the last
+// Load or Save, and increments the revision. s.mu must be held.
+func (s *Store) write(nextID int, fn func(tx *sql.Tx) error) error {
+	var revision int64
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		var err error
+
+		if revision, err = getMeta(tx, keyRevision); err != nil {
+			return err
+		}
+
+		if revision != s.revision {
+			return favorites.ErrModified
+		}
+
+		if err = fn(tx); err != nil {
+			return err
+		}
+
+		revision++
+
+		if err = setMeta(tx, keyRevision, revision); err != nil {
+			return err
+		}
+
+		return setMeta(tx, keyNextID, int64(nextID))
+	})
+	if err != nil {
+		return err
+	}
+
+	s.revision, s.loaded = revision, true
+
+	return nil
+}
+
+func (s *Store) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("db.Begin(): %w", err)
+	}
+
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("tx.Commit(): %w", err)
+	}
+
+	return nil
+}
+
+func getMeta(tx *sql.Tx, key string) (int64, error) {
+	var value int64
+
+	err := tx.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("select %s: %w", key, err)
+	}
+
+	return value, nil
+}
+
+func setMeta(tx *sql.Tx, key string, value int64) error {
+	_, err := tx.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)`, key, value)
+	if err != nil {
+		return fmt.Errorf("update %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func loadMetadata(tx *sql.Tx) (map[string]string, error) {
+	rows, err := tx.Query(`SELECT key, value FROM metadata`)
+	if err != nil {
+		return nil, fmt.Errorf("select metadata: %w", err)
+	}
+	defer rows.Close()
+
+	var metadata map[string]string
+
+	for rows.Next() {
+		var key, value string
+		if err = rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("rows.Scan(): %w", err)
+		}
+
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+
+		metadata[key] = value
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(): %w", err)
+	}
+
+	return metadata, nil
+}
+
+// insertTrash appends the item to the trash.
+func insertTrash(tx *sql.Tx, item favorites.TrashItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("json.Marshal(item): %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO trash (id, position, data)
+		VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM trash), ?)`, item.Entry.ID, string(data))
+	if err != nil {
+		return fmt.Errorf("insert trash %d: %w", item.Entry.ID, err)
+	}
+
+	return nil
+}
+
+// loadTrash returns the trash items kept as JSON rows in their order.
+func loadTrash(tx *sql.Tx) ([]favorites.TrashItem, error) {
+	rows, err := tx.Query(`SELECT data FROM trash ORDER BY position`)
+	if err != nil {
+		return nil, fmt.Errorf("select trash: %w", err)
+	}
+	defer rows.Close()
+
+	var trash []favorites.TrashItem
+
+	for rows.Next() {
+		var (
+			data string
+			item favorites.TrashItem
+		)
+
+		if err = rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("rows.Scan(): %w", err)
+		}
+
+		if err = json.Unmarshal([]byte(data), &item); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal(data, &item): %w", err)
+		}
+
+		trash = append(trash, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(): %w", err)
+	}
+
+	return trash, nil
+}
+
+// loadEntries builds the tree of the rows. Entries not reachable from the root, like ones
+// of a missing parent, are appended to the root, so the Manager's integrity check reports them.
+func loadEntries(tx *sql.Tx) ([]favorites.Entry, error) {
+	rows, err := tx.Query(`SELECT id, uid, name, exec, params, tags, smart, link, parent_id, is_dir, created_at,
+		updated_at FROM entries ORDER BY parent_id, position`)
+	if err != nil {
+		return nil, fmt.Errorf("select entries: %w", err)
+	}
+	defer rows.Close()
+
+	var all []favorites.Entry
+
+	children := make(map[int][]int)
+
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		children[e.ParentID] = append(children[e.ParentID], len(all))
+		all = append(all, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(): %w", err)
+	}
+
+	visited := make([]bool, len(all))
+
+	var build func(parentID int) []favorites.Entry
+
+	build = func(parentID int) []favorites.Entry {
+		var result []favorites.Entry
+
+		for _, i := range children[parentID] {
+			if visited[i] {
+				continue
+			}
+
+			visited[i] = true
+			e := all[i]
+			e.Entries = build(e.ID)
+			result = append(result, e)
+		}
+
+		return result
+	}
+
+	root := build(0)
+
+	for i := range all {
+		if !visited[i] {
+			visited[i] = true
+			e := all[i]
+			e.Entries = build(e.ID)
+			root = append(root, e)
+		}
+	}
+
+	return root, nil
+}
+
+func scanEntry(rows *sql.Rows) (favorites.Entry, error) {
+	var (
+		e                    favorites.Entry
+		params, tags, smart  string
+		createdAt, updatedAt string
+	)
+
+	err := rows.Scan(&e.ID, &e.UID, &e.Name, &e.Exec, &params, &tags, &smart, &e.Link, &e.ParentID, &e.IsDir,
+		&createdAt, &updatedAt)
+	if err != nil {
+		return e, fmt.Errorf("rows.Scan(): %w", err)
+	}
+
+	if params != "" {
+		if err = json.Unmarshal([]byte(params), &e.Params); err != nil {
+			return e, fmt.Errorf("entry %d: params: %w", e.ID, err)
+		}
+	}
+
+	if tags != "" {
+		if err = json.Unmarshal([]byte(tags), &e.Tags); err != nil {
+			return e, fmt.Errorf("entry %d: tags: %w", e.ID, err)
+		}
+	}
+
+	if smart != "" {
+		if err = json.Unmarshal([]byte(smart), &e.Smart); err != nil {
+			return e, fmt.Errorf("entry %d: smart: %w", e.ID, err)
+		}
+	}
+
+	if e.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return e, fmt.Errorf("entry %d: createdAt: %w", e.ID, err)
+	}
+
+	if e.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+		return e, fmt.Errorf("entry %d: updatedAt: %w", e.ID, err)
+	}
+
+	return e, nil
+}
+
+func insertEntries(tx *sql.Tx, entries []favorites.Entry) error {
+	for i, e := range entries {
+		if err := insertEntry(tx, e, int64(i+1)*positionStep); err != nil {
+			return err
+		}
+
+		if err := insertEntries(tx, e.Entries); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func insertEntry(tx *sql.Tx, e favorites.Entry, position int64) error {
+	var params, tags, smart []byte
+
+	if len(e.Params) > 0 {
+		var err error
+		if params, err = json.Marshal(e.Params); err != nil {
+			return fmt.Errorf("entry %d: params: %w", e.ID, err)
+		}
+	}
+
+	if len(e.Tags) > 0 {
+		var err error
+		if tags, err = json.Marshal(e.Tags); err != nil {
+			return fmt.Errorf("entry %d: tags: %w", e.ID, err)
+		}
+	}
+
+	if e.Smart != nil {
+		var err error
+		if smart, err = json.Marshal(e.Smart); err != nil {
+			return fmt.Errorf("entry %d: smart: %w", e.ID, err)
+		}
+	}
+
+	_, err := tx.Exec(`INSERT OR REPLACE INTO entries
+		(id, uid, name, exec, params, tags, smart, link, parent_id, position, is_dir, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.UID, e.Name, e.Exec, string(params), string(tags), string(smart), e.Link, e.ParentID, position,
+		e.IsDir, e.CreatedAt.Format(time.RFC3339Nano), e.UpdatedAt.Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("insert entry %d: %w", e.ID, err)
+	}
+
+	return nil
+}
+
+// putEntry writes the entry before the sibling nextID, or at the end if nextID is 0
+// or not a sibling. Rows of the entries in a moved dir stay as they are.
+func putEntry(tx *sql.Tx, e favorites.Entry, nextID int) error {
+	position, err := placement(tx, e.ID, e.ParentID, nextID)
+	if err != nil {
+		return err
+	}
+
+	return insertEntry(tx, e, position)
+}
+
+// placement returns a free position for the entry id in the parentID dir before nextID.
+func placement(tx *sql.Tx, id, parentID, nextID int) (int64, error) {
+	var next int64
+
+	if nextID != 0 {
+		err := tx.QueryRow(`SELECT position FROM entries WHERE id = ? AND parent_id = ?`, nextID, parentID).
+			Scan(&next)
+		if errors.Is(err, sql.ErrNoRows) {
+			nextID = 0
+		} else if err != nil {
+			return 0, fmt.Errorf("select position: %w", err)
+		}
+	}
+
+	if nextID == 0 {
+		var last sql.NullInt64
+
+		err := tx.QueryRow(`SELECT MAX(position) FROM entries WHERE parent_id = ? AND id != ?`, parentID, id).
+			Scan(&last)
+		if err != nil {
+			return 0, fmt.Errorf("select last position: %w", err)
+		}
+
+		return last.Int64 + positionStep, nil
+	}
+
+	var prev sql.NullInt64
+
+	err := tx.QueryRow(`SELECT MAX(position) FROM entries WHERE parent_id = ? AND position < ? AND id != ?`,
+		parentID, next, id).Scan(&prev)
+	if err != nil {
+		return 0, fmt.Errorf("select previous position: %w", err)
+	}
+
+	switch {
+	case !prev.Valid:
+		return next - positionStep, nil
+	case next-prev.Int64 > 1:
+		return prev.Int64 + (next-prev.Int64)/2, nil
+	}
+
+	if err = renumber(tx, id, parentID); err != nil {
+		return 0, err
+	}
+
+	return placement(tx, id, parentID, nextID)
+}
+
+// renumber spreads the positions of the entries in the parentID dir except id evenly.
+func renumber(tx *sql.Tx, id, parentID int) error {
+	rows, err := tx.Query(`SELECT id FROM entries WHERE parent_id = ? AND id != ? ORDER BY position`,
+		parentID, id)
+	if err != nil {
+		return fmt.Errorf("select siblings: %w", err)
+	}
+
+	var siblings []int
+
+	for rows.Next() {
+		var sibling int
+		if err = rows.Scan(&sibling); err != nil {
+			rows.Close()
+
+			return fmt.Errorf("rows.Scan(): %w", err)
+		}
+
+		siblings = append(siblings, sibling)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("rows.Err(): %w", err)
+	}
+
+	for i, sibling := range siblings {
+		_, err = tx.Exec(`UPDATE entries SET position = ? WHERE id = ?`, int64(i+1)*positionStep, sibling)
+		if err != nil {
+			return fmt.Errorf("update position: %w", err)
+		}
+	}
+
+	return nil
+}
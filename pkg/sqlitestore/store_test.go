@@ -0,0 +1,272 @@
+//nolint:paralleltest,funlen
+package sqlitestore_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gerladeno/favorites-mechanics/pkg/favorites"
+	"github.com/gerladeno/favorites-mechanics/pkg/sqlitestore"
+)
+
+func TestStore(t *testing.T) {
+	newManager := func(t *testing.T, path string) *favorites.Manager {
+		t.Helper()
+
+		store, err := sqlitestore.New(path)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+		manager, err := favorites.NewManager(context.Background(), logrus.New(),
+			favorites.NewOptions(false, path, time.Minute, 40, favorites.WithStore(store)))
+		require.NoError(t, err)
+		manager.Close()
+
+		return manager
+	}
+
+	names := func(manager *favorites.Manager, id int) []string {
+		var result []string
+		for _, e := range manager.ListDirectory(id) {
+			result = append(result, e.Name)
+		}
+
+		return result
+	}
+
+	t.Run("changes are stored", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "favorites.db")
+		manager := newManager(t, path)
+
+		d, err := manager.AddDir("d", 0, 0)
+		require.NoError(t, err)
+		x, err := manager.AddCommand("x", "true", 0, d)
+		require.NoError(t, err)
+		y, err := manager.AddCommand("y", "true", d, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.SetParams(y, []favorites.Param{{Name: "p", Default: "1"}})) //nolint:exhaustruct
+		manager.SyncOut()
+
+		require.NoError(t, manager.MoveEntry(x, d, y))
+		_, err = manager.AddCommand("z", "true", 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.RenameEntry(d, "dir"))
+		manager.SetMetadata("name", "library")
+		manager.SyncOut()
+
+		reopened := newManager(t, path)
+		require.Equal(t, []string{"dir", "z"}, names(reopened, 0))
+		require.Equal(t, []string{"x", "y"}, names(reopened, d))
+		require.Equal(t, map[string]string{"name": "library"}, reopened.Metadata())
+
+		entry, err := reopened.GetEntry(y)
+		require.NoError(t, err)
+		require.Equal(t, []favorites.Param{{Name: "p", Default: "1"}}, entry.Params) //nolint:exhaustruct
+
+		require.NoError(t, manager.DeleteDir(d))
+		manager.SyncOut()
+		reopened.SyncIn()
+		require.Equal(t, []string{"z"}, names(reopened, 0))
+		require.Empty(t, reopened.CheckIntegrity())
+
+		_, err = reopened.GetEntry(x)
+		require.ErrorIs(t, err, favorites.ErrNotFound)
+	})
+
+	t.Run("sibling order survives used up gaps", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "favorites.db")
+		manager := newManager(t, path)
+
+		_, err := manager.AddCommand("first", "true", 0, 0)
+		require.NoError(t, err)
+		last, err := manager.AddCommand("last", "true", 0, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+
+		// Every command goes right before the last one, halving the same gap.
+		want := []string{"first"}
+
+		for i := 0; i < 40; i++ {
+			name := string(rune('a' + i%26))
+			_, err = manager.AddCommand(name, "true", 0, last)
+			require.NoError(t, err)
+
+			want = append(want, name)
+		}
+
+		want = append(want, "last")
+
+		require.NoError(t, manager.MoveEntry(last, 0, 0))
+		require.NoError(t, manager.MoveEntry(last, 0, manager.ListDirectory(0)[1].ID))
+		want = append(want[:1], append([]string{"last"}, want[1:len(want)-1]...)...)
+		manager.SyncOut()
+
+		require.Equal(t, want, names(manager, 0))
+		require.Equal(t, want, names(newManager(t, path), 0))
+	})
+
+	t.Run("concurrent writers are merged", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "favorites.db")
+		ours, theirs := newManager(t, path), newManager(t, path)
+
+		_, err := theirs.AddCommand("theirs", "true", 0, 0)
+		require.NoError(t, err)
+		theirs.SyncOut()
+
+		_, err = ours.AddCommand("ours", "true", 0, 0)
+		require.NoError(t, err)
+		ours.SyncOut()
+
+		require.ElementsMatch(t, []string{"theirs", "ours"}, names(ours, 0))
+		require.Empty(t, ours.CheckIntegrity())
+
+		theirs.SyncIn()
+		require.Equal(t, names(ours, 0), names(theirs, 0))
+		require.Equal(t, names(ours, 0), names(newManager(t, path), 0))
+	})
+	t.Run("trash is stored", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "favorites.db")
+		manager := newManager(t, path)
+
+		d, err := manager.AddDir("d", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("x", "true", d, 0)
+		require.NoError(t, err)
+		y, err := manager.AddCommand("y", "true", 0, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+
+		require.NoError(t, manager.DeleteDir(d))
+		require.NoError(t, manager.DeleteCommand(y))
+		manager.SyncOut()
+		require.NoError(t, manager.Purge(y))
+		manager.SyncOut()
+
+		manager = newManager(t, path)
+		trash := manager.ListTrash()
+		require.Len(t, trash, 1)
+		require.Equal(t, d, trash[0].Entry.ID)
+
+		require.NoError(t, manager.Restore(d))
+		manager.SyncOut()
+		require.Equal(t, []string{"x"}, names(newManager(t, path), d))
+		require.Empty(t, newManager(t, path).ListTrash())
+	})
+
+	t.Run("history is stored", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "favorites.db")
+		manager := newManager(t, path)
+
+		d, err := manager.AddDir("d", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("x", "true", d, 0)
+		require.NoError(t, err)
+		require.NoError(t, manager.DeleteDir(d))
+		manager.SyncOut()
+
+		manager = newManager(t, path)
+		require.Len(t, manager.History().Undo, 3)
+		require.NoError(t, manager.Undo())
+		manager.SyncOut()
+
+		require.Equal(t, []string{"x"}, names(newManager(t, path), d))
+	})
+
+	t.Run("usage is stored apart from the tree", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "favorites.db")
+		manager := newManager(t, path)
+
+		x, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+
+		ours, theirs := newManager(t, path), newManager(t, path)
+		s := ours.Subscribe()
+
+		defer s.Close()
+
+		require.NoError(t, ours.RecordUse(x, "/src"))
+		require.NoError(t, theirs.RecordUse(x, "/tmp"))
+		ours.SyncUsage()
+		theirs.SyncUsage()
+
+		usage, ok := newManager(t, path).Usage(x)
+		require.True(t, ok)
+		require.Equal(t, 2, usage.Count)
+		require.Equal(t, map[string]int{"/src": 1, "/tmp": 1}, usage.Dirs)
+
+		// Saving the usage does not change the revision of the tree.
+		ours.SyncIn()
+		require.Empty(t, s.C)
+	})
+
+	t.Run("tags are stored", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "favorites.db")
+
+		// A database of a version without tags gets the column.
+		db, err := sql.Open("sqlite", path)
+		require.NoError(t, err)
+		_, err = db.Exec(`CREATE TABLE entries (
+			id INTEGER PRIMARY KEY, uid TEXT NOT NULL, name TEXT NOT NULL, exec TEXT NOT NULL,
+			params TEXT NOT NULL, parent_id INTEGER NOT NULL, position INTEGER NOT NULL,
+			is_dir INTEGER NOT NULL, created_at TEXT NOT NULL, updated_at TEXT NOT NULL)`)
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO entries VALUES (1, '', 'x', 'true', '', 0, 1, 0,
+			'2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z')`)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		manager := newManager(t, path)
+		require.Equal(t, []string{"x"}, names(manager, 0))
+		require.NoError(t, manager.SetTags(1, []string{"prod", "db"}))
+		manager.SyncOut()
+
+		e, err := newManager(t, path).GetEntry(1)
+		require.NoError(t, err)
+		require.Equal(t, []string{"db", "prod"}, e.Tags)
+	})
+	t.Run("links are stored", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "favorites.db")
+		manager := newManager(t, path)
+
+		x, err := manager.AddCommand("x", "true", 0, 0)
+		require.NoError(t, err)
+		dir, err := manager.AddDir("dir", 0, 0)
+		require.NoError(t, err)
+		link, err := manager.AddLink("", x, dir, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+
+		e, err := newManager(t, path).GetEntry(link)
+		require.NoError(t, err)
+		require.Equal(t, x, e.Link)
+		require.Equal(t, "x", e.Name)
+		require.Equal(t, "true", e.Exec)
+	})
+	t.Run("copies are stored", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "favorites.db")
+		manager := newManager(t, path)
+
+		dir, err := manager.AddDir("dir", 0, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("a", "true", dir, 0)
+		require.NoError(t, err)
+		_, err = manager.AddCommand("b", "true", dir, 0)
+		require.NoError(t, err)
+		manager.SyncOut()
+
+		copied, err := manager.CopyEntry(dir, 0, 0, favorites.CopyWithRename("{name} ({n})"))
+		require.NoError(t, err)
+		manager.SyncOut()
+
+		manager = newManager(t, path)
+		require.Equal(t, []string{"dir", "dir (2)"}, names(manager, 0))
+		require.Equal(t, []string{"a", "b"}, names(manager, copied))
+	})
+}